@@ -6,24 +6,76 @@ package v1
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
+// LogArtifactName is the reserved artifact name for exporting the log directory by ExportArtifacts.
+// The directory contains kubetest.log and keys directory that has the log file of each strategy key.
+const LogArtifactName = "kubetest-log"
+
 type ArtifactManager struct {
 	nameToLocalDirs  map[string]string
 	nameToLocalFiles map[string]string
+	nameToMergeTypes map[string]ArtifactMergeType
+	nameToMergedDirs map[string]string
 	exports          []ExportArtifact
+	tokenMgr         *TokenManager
+	jobName          string
+	runID            string
+	// containerNameToKey strategy key of the container that created the artifact.
+	containerNameToKey   map[string]string
+	containerNameToKeyMu sync.Mutex
+	reports              []*ReportArtifact
 }
 
-func NewArtifactManager(exports []ExportArtifact) *ArtifactManager {
+func NewArtifactManager(exports []ExportArtifact, tokenMgr *TokenManager) *ArtifactManager {
 	return &ArtifactManager{
-		nameToLocalDirs:  map[string]string{},
-		nameToLocalFiles: map[string]string{},
-		exports:          exports,
+		nameToLocalDirs:    map[string]string{},
+		nameToLocalFiles:   map[string]string{},
+		nameToMergeTypes:   map[string]ArtifactMergeType{},
+		nameToMergedDirs:   map[string]string{},
+		exports:            exports,
+		tokenMgr:           tokenMgr,
+		containerNameToKey: map[string]string{},
 	}
 }
 
+// SetRun sets TestJob name and the run id used by the prefix of the uploaded artifacts.
+func (m *ArtifactManager) SetRun(jobName, runID string) {
+	m.jobName = jobName
+	m.runID = runID
+}
+
+// SetContainerKey sets the strategy key that the container ran.
+func (m *ArtifactManager) SetContainerKey(containerName, key string) {
+	m.containerNameToKeyMu.Lock()
+	defer m.containerNameToKeyMu.Unlock()
+	m.containerNameToKey[containerName] = key
+}
+
+func (m *ArtifactManager) containerKey(containerName string) string {
+	m.containerNameToKeyMu.Lock()
+	defer m.containerNameToKeyMu.Unlock()
+	if key, exists := m.containerNameToKey[containerName]; exists {
+		return key
+	}
+	return containerName
+}
+
+// Reports returns the results of exporting artifacts.
+func (m *ArtifactManager) Reports() []*ReportArtifact {
+	return m.reports
+}
+
 func (m *ArtifactManager) AddArtifacts(artifacts []ArtifactSpec) error {
 	for _, artifact := range artifacts {
 		dir, err := os.MkdirTemp("", "artifact")
@@ -31,11 +83,18 @@ func (m *ArtifactManager) AddArtifacts(artifacts []ArtifactSpec) error {
 			return fmt.Errorf("kubetest: failed to create temporary directory for artifact: %w", err)
 		}
 		m.nameToLocalDirs[artifact.Name] = dir
-		m.nameToLocalFiles[artifact.Name] = filepath.Base(artifact.Container.Path)
+		m.nameToLocalFiles[artifact.Name] = artifactLocalFileName(artifact)
+		if artifact.Merge != "" {
+			m.nameToMergeTypes[artifact.Name] = artifact.Merge
+		}
 	}
 	return nil
 }
 
+func (m *ArtifactManager) AddLogArtifact(logDir string) {
+	m.nameToLocalDirs[LogArtifactName] = logDir
+}
+
 func (m *ArtifactManager) ExportPathByName(name string) (string, error) {
 	dir, exists := m.nameToLocalDirs[name]
 	if !exists {
@@ -60,6 +119,13 @@ func (m *ArtifactManager) LocalPathByName(ctx context.Context, name string) (str
 	if len(containerNames) == 0 {
 		return "", fmt.Errorf("kubetest: couldn't find local path for artifact %s", name)
 	}
+	if _, exists := m.nameToMergeTypes[name]; exists {
+		mergedDir, err := m.mergeArtifact(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(mergedDir, file), nil
+	}
 	if len(containerNames) > 1 {
 		LoggerFromContext(ctx).Info(
 			"multiple paths to artifact were found. As for the copy destination path, %s ~ %s directories are placed as an intermediate directory",
@@ -72,6 +138,38 @@ func (m *ArtifactManager) LocalPathByName(ctx context.Context, name string) (str
 	return filepath.Join(dir, containerName, file), nil
 }
 
+// mergeArtifact merges the artifacts copied from all containers by the merge strategy of the artifact,
+// and returns the directory that has the merged artifact.
+// The artifact is merged again at every call because the containers that run after the previous call may add the artifact.
+func (m *ArtifactManager) mergeArtifact(ctx context.Context, name string) (string, error) {
+	dir, exists := m.nameToLocalDirs[name]
+	if !exists {
+		return "", fmt.Errorf("kubetest: failed to find local artifact directory by %s", name)
+	}
+	mergedDir, exists := m.nameToMergedDirs[name]
+	if exists {
+		if err := os.RemoveAll(mergedDir); err != nil {
+			return "", fmt.Errorf("kubetest: failed to remove merged artifact %s: %w", name, err)
+		}
+		if err := os.Mkdir(mergedDir, 0755); err != nil {
+			return "", fmt.Errorf("kubetest: failed to create directory for merged artifact %s: %w", name, err)
+		}
+	} else {
+		d, err := os.MkdirTemp("", "merged-artifact")
+		if err != nil {
+			return "", fmt.Errorf("kubetest: failed to create temporary directory for merged artifact: %w", err)
+		}
+		mergedDir = d
+		m.nameToMergedDirs[name] = mergedDir
+	}
+	mergeType := m.nameToMergeTypes[name]
+	LoggerFromContext(ctx).Debug("merge artifact %s by %s", name, mergeType)
+	if err := mergeArtifacts(ctx, mergeType, dir, mergedDir); err != nil {
+		return "", err
+	}
+	return mergedDir, nil
+}
+
 func (m *ArtifactManager) LocalPathByNameAndContainerName(name, containerName string) (string, error) {
 	dir, exists := m.nameToLocalDirs[name]
 	if !exists {
@@ -91,25 +189,547 @@ func (m *ArtifactManager) ExportArtifacts(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("kubetest: failed to get src path to export artifact: %w", err)
 		}
-		dst := export.Path
-		if err := os.MkdirAll(dst, 0755); err != nil {
-			return fmt.Errorf("kubetest: failed to create %s directory for export artifact: %w", dst, err)
+		if _, exists := m.nameToMergeTypes[export.Name]; exists {
+			mergedDir, err := m.mergeArtifact(ctx, export.Name)
+			if err != nil {
+				return err
+			}
+			src = mergedDir
 		}
-		paths, err := filepath.Glob(filepath.Join(src, "*"))
+		if export.Path != "" {
+			if err := m.exportToLocal(ctx, src, export.Path, m.hasContainerDirs(export.Name)); err != nil {
+				return err
+			}
+		}
+		if export.S3 != nil {
+			urls, err := m.exportToS3(ctx, export.Name, src, export.S3)
+			if err != nil {
+				return err
+			}
+			m.reports = append(m.reports, &ReportArtifact{Name: export.Name, URLs: urls})
+		}
+	}
+	return nil
+}
+
+// hasContainerDirs returns true if the exported artifact has the directory of each container.
+// The log artifact and the merged artifact don't have it.
+func (m *ArtifactManager) hasContainerDirs(name string) bool {
+	_, hasFile := m.nameToLocalFiles[name]
+	_, merged := m.nameToMergeTypes[name]
+	return hasFile && !merged
+}
+
+// exportToLocal copies the artifact to dst, and writes the SHA-256 manifest next to each exported artifact.
+func (m *ArtifactManager) exportToLocal(ctx context.Context, src, dst string, hasContainerDirs bool) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return fmt.Errorf("kubetest: failed to create %s directory for export artifact: %w", dst, err)
+	}
+	paths, err := filepath.Glob(filepath.Join(src, "*"))
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to get src path to export artifact: %w", err)
+	}
+	for _, path := range paths {
+		src := path
+		dst := filepath.Join(dst, filepath.Base(path))
+		LoggerFromContext(ctx).Debug(
+			"export artifact: copy from %s to %s",
+			src, dst,
+		)
+		if err := localCopy(src, dst); err != nil {
+			return err
+		}
+		if !hasContainerDirs {
+			if err := writeArtifactManifest(dst); err != nil {
+				return err
+			}
+			continue
+		}
+		artifactPaths, err := filepath.Glob(filepath.Join(src, "*"))
 		if err != nil {
 			return fmt.Errorf("kubetest: failed to get src path to export artifact: %w", err)
 		}
-		for _, path := range paths {
-			src := path
-			dst := filepath.Join(dst, filepath.Base(path))
-			LoggerFromContext(ctx).Debug(
-				"export artifact: copy from %s to %s",
-				src, dst,
-			)
-			if err := localCopy(src, dst); err != nil {
+		for _, artifactPath := range artifactPaths {
+			if err := writeArtifactManifest(filepath.Join(dst, filepath.Base(artifactPath))); err != nil {
 				return err
 			}
 		}
 	}
 	return nil
 }
+
+// exportToS3 uploads the artifact to S3 compatible object storage and returns the urls of the uploaded objects.
+// The artifact copied from each container is uploaded with the prefix rendered by the container.
+func (m *ArtifactManager) exportToS3(ctx context.Context, name, src string, dest *S3ExportDestination) ([]string, error) {
+	credential, err := m.s3Credential(ctx, dest.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newS3Client(dest, credential)
+	if err != nil {
+		return nil, err
+	}
+	type uploadDir struct {
+		dir   string
+		param *s3PrefixParam
+	}
+	var dirs []*uploadDir
+	if m.hasContainerDirs(name) {
+		containerDirs, err := filepath.Glob(filepath.Join(src, "*"))
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to get src path to export artifact: %w", err)
+		}
+		for _, dir := range containerDirs {
+			containerName := filepath.Base(dir)
+			dirs = append(dirs, &uploadDir{
+				dir: dir,
+				param: &s3PrefixParam{
+					Name:      m.jobName,
+					RunID:     m.runID,
+					Key:       m.containerKey(containerName),
+					Artifact:  name,
+					Container: containerName,
+				},
+			})
+		}
+	} else {
+		// the log artifact and the merged artifact don't have the directory of each container.
+		dirs = append(dirs, &uploadDir{
+			dir: src,
+			param: &s3PrefixParam{
+				Name:     m.jobName,
+				RunID:    m.runID,
+				Artifact: name,
+			},
+		})
+	}
+	var urls []string
+	for _, dir := range dirs {
+		prefix, err := renderS3Prefix(dest.Prefix, dir.param)
+		if err != nil {
+			return nil, err
+		}
+		uploaded, err := client.uploadDir(ctx, dir.dir, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to upload artifact %s: %w", name, err)
+		}
+		urls = append(urls, uploaded...)
+	}
+	LoggerFromContext(ctx).Info("uploaded %d files of artifact %s to s3 bucket %s", len(urls), name, dest.Bucket)
+	return urls, nil
+}
+
+// s3Credential returns the credential by TokenSpec or secrets. If credentials isn't specified, the environment variables are used.
+func (m *ArtifactManager) s3Credential(ctx context.Context, creds *S3Credentials) (*s3Credential, error) {
+	var credential s3Credential
+	switch {
+	case creds == nil:
+		credential.accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		credential.secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		credential.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		if credential.accessKeyID == "" || credential.secretAccessKey == "" {
+			return nil, fmt.Errorf("kubetest: s3 credentials or $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY must be specified")
+		}
+	case creds.Token != "":
+		token, err := m.tokenMgr.TokenByName(ctx, creds.Token)
+		if err != nil {
+			return nil, err
+		}
+		accessKeyID, secretAccessKey, found := strings.Cut(strings.TrimSpace(token.Value), ":")
+		if !found || accessKeyID == "" || secretAccessKey == "" {
+			return nil, fmt.Errorf("kubetest: s3 credentials token %s must be <access key id>:<secret access key>", creds.Token)
+		}
+		credential.accessKeyID = accessKeyID
+		credential.secretAccessKey = secretAccessKey
+	default:
+		accessKeyID, err := m.tokenMgr.cli.secretData(ctx, creds.AccessKeyID)
+		if err != nil {
+			return nil, err
+		}
+		secretAccessKey, err := m.tokenMgr.cli.secretData(ctx, creds.SecretAccessKey)
+		if err != nil {
+			return nil, err
+		}
+		credential.accessKeyID = strings.TrimSpace(string(accessKeyID))
+		credential.secretAccessKey = strings.TrimSpace(string(secretAccessKey))
+	}
+	addTokenMasks(ctx, credential.secretAccessKey)
+	if credential.sessionToken != "" {
+		addTokenMasks(ctx, credential.sessionToken)
+	}
+	return &credential, nil
+}
+
+// artifactPaths returns all paths to the artifacts specified by Path and Paths.
+func (c ArtifactContainer) artifactPaths() []string {
+	paths := make([]string, 0, len(c.Paths)+1)
+	if c.Path != "" {
+		paths = append(paths, c.Path)
+	}
+	return append(paths, c.Paths...)
+}
+
+// usesPattern returns true if the artifact is collected by the multiple paths, glob patterns or filters.
+// Otherwise, the artifact is the single file or directory specified by Path.
+func (c ArtifactContainer) usesPattern() bool {
+	paths := c.artifactPaths()
+	if len(paths) != 1 || len(c.Include) != 0 || len(c.Exclude) != 0 {
+		return true
+	}
+	return hasGlobMeta(paths[0])
+}
+
+// artifactLocalFileName returns the name of the copied artifact.
+// The artifact collected by patterns is the directory named by the artifact name.
+func artifactLocalFileName(artifact ArtifactSpec) string {
+	if artifact.Container.usesPattern() {
+		return artifact.Name
+	}
+	return filepath.Base(artifact.Container.Path)
+}
+
+const artifactKeeperContainerName = "kubetest-artifact-keeper"
+
+func isArtifactKeeper(exec JobExecutor) bool {
+	return exec.Container().Name == artifactKeeperContainerName
+}
+
+// needsToCollect returns true if the artifact is collected by the status of the test.
+func (p ArtifactPolicy) needsToCollect(status TaskResultStatus) bool {
+	switch p {
+	case ArtifactPolicyOnSuccess:
+		return status == TaskResultSuccess
+	case ArtifactPolicyOnFailure:
+		return status != TaskResultSuccess
+	}
+	return true
+}
+
+// artifactVolumeMounts returns the volume mounts of the container that have the artifacts collected when the test failed.
+// The volumes for kubetest ( e.g. repo or token ) are ignored because they are copied to the container.
+func artifactVolumeMounts(spec TestJobPodSpec, container TestJobContainer) []corev1.VolumeMount {
+	volumes := map[string]struct{}{}
+	for _, volume := range spec.Volumes {
+		source := volume.TestJobVolumeSource
+		if source.Repo != nil || source.Artifact != nil || source.Token != nil || source.Log != nil || source.Report != nil {
+			continue
+		}
+		volumes[volume.Name] = struct{}{}
+	}
+	var mounts []corev1.VolumeMount
+	added := map[string]struct{}{}
+	for _, artifact := range spec.Artifacts {
+		if artifact.Container.Name != container.Name || artifact.Policy == ArtifactPolicyOnSuccess {
+			continue
+		}
+		for _, p := range artifact.Container.artifactPaths() {
+			if !path.IsAbs(p) {
+				p = path.Join(container.WorkingDir, p)
+			}
+			mount := volumeMountByPath(container.VolumeMounts, globRoot(path.Clean(p)))
+			if mount == nil {
+				continue
+			}
+			if _, exists := volumes[mount.Name]; !exists {
+				continue
+			}
+			if _, exists := added[mount.MountPath]; exists {
+				continue
+			}
+			added[mount.MountPath] = struct{}{}
+			m := *mount.DeepCopy()
+			m.ReadOnly = true
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
+
+// volumeMountByPath returns the volume mount that has the path. If multiple volume mounts have the path, the innermost one is used.
+func volumeMountByPath(mounts []corev1.VolumeMount, p string) *corev1.VolumeMount {
+	var found *corev1.VolumeMount
+	for idx := range mounts {
+		mountPath := path.Clean(mounts[idx].MountPath)
+		if p != mountPath && !strings.HasPrefix(p, strings.TrimSuffix(mountPath, "/")+"/") {
+			continue
+		}
+		if found == nil || len(mountPath) > len(path.Clean(found.MountPath)) {
+			found = &mounts[idx]
+		}
+	}
+	return found
+}
+
+// copyArtifactFromContainer copies the artifact from the container to localPath.
+func copyArtifactFromContainer(ctx context.Context, exec JobExecutor, artifact ArtifactSpec, localPath string, enabledAgent bool) error {
+	transfer := newArtifactTransfer(artifact)
+	container := artifact.Container
+	if !container.usesPattern() {
+		// artifact.Container.Path and localPath has same Base name.
+		return transfer.copyFrom(ctx, exec, container.Path, localPath, enabledAgent)
+	}
+	collector, err := newArtifactCollector(container, exec.Container().WorkingDir)
+	if err != nil {
+		return err
+	}
+	return collector.collect(ctx, exec, transfer, localPath, enabledAgent)
+}
+
+// artifactCollector collects the files matched by the paths of the artifact.
+// The executor cannot expand glob patterns on the container, so the collector copies the static directory of each pattern
+// ( the directory before the first wildcard ) and keeps only the matched files under the common base directory.
+type artifactCollector struct {
+	// baseDir is the common base directory of the paths on the container.
+	baseDir string
+	// patterns are relative to baseDir.
+	patterns []string
+	// roots are the paths on the container to copy.
+	roots   []string
+	include []string
+	exclude []string
+}
+
+func newArtifactCollector(container ArtifactContainer, workingDir string) (*artifactCollector, error) {
+	var (
+		paths    []string
+		bases    []string
+		roots    []string
+		absCount int
+	)
+	for _, p := range container.artifactPaths() {
+		if !path.IsAbs(p) && workingDir != "" {
+			p = path.Join(workingDir, p)
+		}
+		p = path.Clean(p)
+		root := globRoot(p)
+		if root == "." {
+			return nil, fmt.Errorf("kubetest: artifact path %s requires the working directory of %s container", p, container.Name)
+		}
+		base := root
+		if root == p {
+			// the static path is a file or a directory, so the parent directory is the base to keep the name.
+			base = path.Dir(p)
+		}
+		if path.IsAbs(p) {
+			absCount++
+		}
+		paths = append(paths, p)
+		bases = append(bases, base)
+		roots = append(roots, root)
+	}
+	if absCount != 0 && absCount != len(paths) {
+		return nil, fmt.Errorf("kubetest: artifact paths of %s container must be all absolute or all relative", container.Name)
+	}
+	baseDir := commonDir(bases)
+	patterns := make([]string, 0, len(paths))
+	for _, p := range paths {
+		patterns = append(patterns, relPath(baseDir, p))
+	}
+	return &artifactCollector{
+		baseDir:  baseDir,
+		patterns: patterns,
+		roots:    outermostPaths(roots),
+		include:  container.Include,
+		exclude:  container.Exclude,
+	}, nil
+}
+
+func (c *artifactCollector) collect(ctx context.Context, exec JobExecutor, transfer *artifactTransfer, localPath string, enabledAgent bool) error {
+	if err := os.MkdirAll(localPath, 0o755); err != nil {
+		return fmt.Errorf("kubetest: failed to create directory for artifact: %w", err)
+	}
+	stageDir, err := os.MkdirTemp("", "artifact-stage")
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to create temporary directory for artifact: %w", err)
+	}
+	defer os.RemoveAll(stageDir)
+
+	var collected int
+	for idx, root := range c.roots {
+		stagePath := filepath.Join(stageDir, strconv.Itoa(idx), path.Base(root))
+		if err := os.MkdirAll(filepath.Dir(stagePath), 0o755); err != nil {
+			return fmt.Errorf("kubetest: failed to create directory for artifact: %w", err)
+		}
+		if err := transfer.copyFrom(ctx, exec, root, stagePath, enabledAgent); err != nil {
+			return err
+		}
+		rootRelPath := relPath(c.baseDir, root)
+		if err := filepath.WalkDir(stagePath, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(stagePath, p)
+			if err != nil {
+				return err
+			}
+			artifactPath := path.Join(rootRelPath, filepath.ToSlash(rel))
+			if !c.matches(artifactPath) {
+				return nil
+			}
+			dst := filepath.Join(localPath, filepath.FromSlash(artifactPath))
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+				return err
+			}
+			if err := os.Rename(p, dst); err != nil {
+				return err
+			}
+			collected++
+			return nil
+		}); err != nil {
+			return fmt.Errorf("kubetest: failed to collect artifact files from %s: %w", root, err)
+		}
+	}
+	LoggerFromContext(ctx).Debug("collected %d artifact files from %s container", collected, exec.Container().Name)
+	if collected == 0 {
+		LoggerFromContext(ctx).Warn("no artifact files matched %s", strings.Join(c.patterns, ","))
+	}
+	return nil
+}
+
+// matches returns true if the path relative to the base directory is the artifact file.
+func (c *artifactCollector) matches(p string) bool {
+	matched := false
+	for _, pattern := range c.patterns {
+		if matchPathOrParent(pattern, p) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	if len(c.include) != 0 && !matchFilters(c.include, p) {
+		return false
+	}
+	return !matchFilters(c.exclude, p)
+}
+
+// matchFilters returns true if the path matches any of the filter patterns.
+// The pattern without '/' matches the name of the file or the parent directories.
+func matchFilters(filters []string, p string) bool {
+	for _, filter := range filters {
+		if !strings.Contains(filter, "/") {
+			for _, name := range strings.Split(p, "/") {
+				if matched, _ := path.Match(filter, name); matched {
+					return true
+				}
+			}
+			continue
+		}
+		if matchPathOrParent(filter, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathOrParent returns true if the path or any of the parent directories matches the pattern.
+func matchPathOrParent(pattern, p string) bool {
+	patterns := strings.Split(pattern, "/")
+	names := strings.Split(p, "/")
+	for i := 1; i <= len(names); i++ {
+		if matchPathSegments(patterns, names[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathSegments matches the path segments by the pattern segments. `**` matches zero or more segments.
+func matchPathSegments(patterns, names []string) bool {
+	if len(patterns) == 0 {
+		return len(names) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if matchPathSegments(patterns[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(patterns[0], names[0]); !matched {
+		return false
+	}
+	return matchPathSegments(patterns[1:], names[1:])
+}
+
+func validateArtifactPattern(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// globRoot returns the static directory before the first segment that has wildcards.
+// If the path doesn't have wildcards, returns the path itself.
+func globRoot(p string) string {
+	segments := strings.Split(p, "/")
+	for idx, segment := range segments {
+		if hasGlobMeta(segment) {
+			root := strings.Join(segments[:idx], "/")
+			if root == "" {
+				if path.IsAbs(p) {
+					return "/"
+				}
+				return "."
+			}
+			return root
+		}
+	}
+	return p
+}
+
+// commonDir returns the longest common directory of the directories.
+func commonDir(dirs []string) string {
+	common := strings.Split(dirs[0], "/")
+	for _, dir := range dirs[1:] {
+		segments := strings.Split(dir, "/")
+		n := 0
+		for n < len(common) && n < len(segments) && common[n] == segments[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	dir := strings.Join(common, "/")
+	if dir == "" && strings.HasPrefix(dirs[0], "/") {
+		return "/"
+	}
+	return dir
+}
+
+// outermostPaths returns the paths that aren't under the other paths.
+func outermostPaths(paths []string) []string {
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+	var ret []string
+	for _, p := range sorted {
+		if len(ret) != 0 {
+			last := ret[len(ret)-1]
+			if p == last || strings.HasPrefix(p, strings.TrimSuffix(last, "/")+"/") {
+				continue
+			}
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+func relPath(base, p string) string {
+	if base == "" || base == "." {
+		return p
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(p, base), "/")
+}
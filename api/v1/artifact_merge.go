@@ -0,0 +1,279 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mergeArtifacts merges the artifact of each container placed under srcDir ( e.g. srcDir/<container>/<file> ) into dstDir.
+// The files that have the same relative path from the container directory are merged by mergeType.
+func mergeArtifacts(ctx context.Context, mergeType ArtifactMergeType, srcDir, dstDir string) error {
+	containerDirs, err := filepath.Glob(filepath.Join(srcDir, "*"))
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to find artifact to merge: %w", err)
+	}
+	sort.Strings(containerDirs)
+	relToFiles := map[string][]string{}
+	for _, containerDir := range containerDirs {
+		if err := filepath.WalkDir(containerDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(containerDir, path)
+			if err != nil {
+				return err
+			}
+			relToFiles[rel] = append(relToFiles[rel], path)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("kubetest: failed to find artifact to merge: %w", err)
+		}
+	}
+	rels := make([]string, 0, len(relToFiles))
+	for rel := range relToFiles {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		dst := filepath.Join(dstDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("kubetest: failed to create directory for merged artifact: %w", err)
+		}
+		if err := mergeArtifactFiles(ctx, mergeType, relToFiles[rel], dst); err != nil {
+			return fmt.Errorf("kubetest: failed to merge artifact %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+func mergeArtifactFiles(ctx context.Context, mergeType ArtifactMergeType, srcs []string, dst string) error {
+	switch mergeType {
+	case ArtifactMergeTypeConcat:
+		return concatFiles(srcs, dst)
+	case ArtifactMergeTypeGoCoverage:
+		merged, err := mergeGoCoverProfiles(srcs)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, merged, 0644)
+	case ArtifactMergeTypeJUnit:
+		merged, err := mergeJUnitReports(srcs)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, merged, 0644)
+	case ArtifactMergeTypeUnion:
+		return unionFiles(ctx, srcs, dst)
+	}
+	return fmt.Errorf("kubetest: unknown artifact merge type %s", mergeType)
+}
+
+func concatFiles(srcs []string, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, src := range srcs {
+		if err := func() error {
+			srcFile, err := os.Open(src)
+			if err != nil {
+				return err
+			}
+			defer srcFile.Close()
+			_, err = io.Copy(f, srcFile)
+			return err
+		}(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unionFiles uses the first file. If the other files have different contents, they are ignored with warning.
+func unionFiles(ctx context.Context, srcs []string, dst string) error {
+	first, err := os.ReadFile(srcs[0])
+	if err != nil {
+		return err
+	}
+	for _, src := range srcs[1:] {
+		content, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(first, content) {
+			LoggerFromContext(ctx).Warn("artifact %s conflicts with %s. use %s", src, srcs[0], srcs[0])
+		}
+	}
+	return os.WriteFile(dst, first, 0644)
+}
+
+// mergeGoCoverProfiles merges the coverage profiles created by `go test -coverprofile`.
+// The counts of the same block are summed. If the mode is set, the block is covered if any profile covers it.
+func mergeGoCoverProfiles(srcs []string) ([]byte, error) {
+	var (
+		mode   string
+		blocks []string
+	)
+	blockToCount := map[string]int64{}
+	for _, src := range srcs {
+		if err := func() error {
+			f, err := os.Open(src)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+				if strings.HasPrefix(line, "mode:") {
+					m := strings.TrimSpace(strings.TrimPrefix(line, "mode:"))
+					if mode != "" && mode != m {
+						return fmt.Errorf("kubetest: coverage mode mismatch: %s and %s", mode, m)
+					}
+					mode = m
+					continue
+				}
+				idx := strings.LastIndex(line, " ")
+				if idx < 0 {
+					return fmt.Errorf("kubetest: invalid coverage profile line %q in %s", line, src)
+				}
+				block := line[:idx]
+				count, err := strconv.ParseInt(line[idx+1:], 10, 64)
+				if err != nil {
+					return fmt.Errorf("kubetest: invalid coverage profile line %q in %s: %w", line, src, err)
+				}
+				current, exists := blockToCount[block]
+				if !exists {
+					blocks = append(blocks, block)
+				}
+				if mode == "set" {
+					if count > 0 {
+						current = 1
+					}
+					blockToCount[block] = current
+					continue
+				}
+				blockToCount[block] = current + count
+			}
+			return scanner.Err()
+		}(); err != nil {
+			return nil, err
+		}
+	}
+	if mode == "" {
+		return nil, fmt.Errorf("kubetest: coverage profile must start with mode line")
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "mode: %s\n", mode)
+	for _, block := range blocks {
+		fmt.Fprintf(&b, "%s %d\n", block, blockToCount[block])
+	}
+	return b.Bytes(), nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Attrs   []xml.Attr       `xml:",any,attr"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	XMLName xml.Name   `xml:"testsuite"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+func (s *junitTestSuite) attr(name string) string {
+	for _, attr := range s.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// mergeJUnitReports merges JUnit XML files into one testsuites element.
+// The root element of each file can be testsuites or testsuite, and the totals of testsuites are recalculated by the merged testsuite elements.
+func mergeJUnitReports(srcs []string) ([]byte, error) {
+	var suites []junitTestSuite
+	for _, src := range srcs {
+		content, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		root, err := junitRootElementName(content)
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to parse junit xml %s: %w", src, err)
+		}
+		switch root {
+		case "testsuites":
+			var v junitTestSuites
+			if err := xml.Unmarshal(content, &v); err != nil {
+				return nil, fmt.Errorf("kubetest: failed to parse junit xml %s: %w", src, err)
+			}
+			suites = append(suites, v.Suites...)
+		case "testsuite":
+			var v junitTestSuite
+			if err := xml.Unmarshal(content, &v); err != nil {
+				return nil, fmt.Errorf("kubetest: failed to parse junit xml %s: %w", src, err)
+			}
+			suites = append(suites, v)
+		default:
+			return nil, fmt.Errorf("kubetest: unexpected root element %s of junit xml %s", root, src)
+		}
+	}
+	merged := junitTestSuites{Suites: suites}
+	var elapsedTime float64
+	counts := map[string]int{}
+	for _, suite := range suites {
+		for _, name := range []string{"tests", "failures", "errors", "skipped"} {
+			count, _ := strconv.Atoi(suite.attr(name))
+			counts[name] += count
+		}
+		t, _ := strconv.ParseFloat(suite.attr("time"), 64)
+		elapsedTime += t
+	}
+	for _, name := range []string{"tests", "failures", "errors", "skipped"} {
+		merged.Attrs = append(merged.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: strconv.Itoa(counts[name])})
+	}
+	merged.Attrs = append(merged.Attrs, xml.Attr{Name: xml.Name{Local: "time"}, Value: strconv.FormatFloat(elapsedTime, 'f', 3, 64)})
+	b, err := xml.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to encode merged junit xml: %w", err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func junitRootElementName(content []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		if elem, ok := tok.(xml.StartElement); ok {
+			return elem.Name.Local, nil
+		}
+	}
+}
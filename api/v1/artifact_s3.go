@@ -0,0 +1,286 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	defaultS3Prefix = "{{ .Name }}/{{ .RunID }}/{{ .Artifact }}/{{ .Key }}"
+)
+
+// s3PrefixParam is the parameter of the template for the prefix of the object key.
+type s3PrefixParam struct {
+	// Name of TestJob.
+	Name  string
+	RunID string
+	// Key is the strategy key. If the artifact isn't created by strategy key, the container name is used.
+	Key       string
+	Artifact  string
+	Container string
+}
+
+func renderS3Prefix(prefix string, param *s3PrefixParam) (string, error) {
+	if prefix == "" {
+		prefix = defaultS3Prefix
+	}
+	tmpl, err := template.New("").Parse(prefix)
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to parse s3 prefix template %s: %w", prefix, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, param); err != nil {
+		return "", fmt.Errorf("kubetest: failed to render s3 prefix template %s: %w", prefix, err)
+	}
+	return strings.Trim(path.Clean("/"+b.String()), "/"), nil
+}
+
+// s3Credential is the credential to sign the request by AWS Signature Version 4.
+type s3Credential struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// s3Client uploads objects by S3 compatible API.
+// see also: https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObject.html
+type s3Client struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	pathStyle  bool
+	credential *s3Credential
+	now        func() time.Time
+}
+
+func newS3Client(dest *S3ExportDestination, credential *s3Credential) (*s3Client, error) {
+	region := dest.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	endpoint := dest.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: invalid s3 endpoint %s: %w", endpoint, err)
+	}
+	return &s3Client{
+		endpoint:   u,
+		region:     region,
+		bucket:     dest.Bucket,
+		pathStyle:  dest.PathStyle,
+		credential: credential,
+		now:        time.Now,
+	}, nil
+}
+
+// objectURL returns the url of the object.
+func (c *s3Client) objectURL(key string) *url.URL {
+	u := *c.endpoint
+	objectPath := "/" + key
+	if c.pathStyle {
+		objectPath = "/" + c.bucket + objectPath
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	u.Path = c.endpoint.Path + objectPath
+	u.RawPath = s3EscapePath(c.endpoint.Path) + s3EscapePath(objectPath)
+	return &u
+}
+
+// uploadDir uploads all files under the directory with the prefix, and returns the urls of the uploaded objects.
+func (c *s3Client) uploadDir(ctx context.Context, dir, prefix string) ([]string, error) {
+	var urls []string
+	if err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		key := path.Join(prefix, filepath.ToSlash(rel))
+		u, err := c.putObject(ctx, key, p)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, u)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// putObject uploads the file as the object, and returns the url of the object.
+func (c *s3Client) putObject(ctx context.Context, key, file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to open artifact file %s: %w", file, err)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to read artifact file %s: %w", file, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("kubetest: failed to read artifact file %s: %w", file, err)
+	}
+	u := c.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), f)
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to create s3 request: %w", err)
+	}
+	req.ContentLength = size
+	if size == 0 {
+		// http.Request treats the body of zero length as unknown length.
+		req.Body = http.NoBody
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	c.sign(req, hex.EncodeToString(hash.Sum(nil)))
+
+	LoggerFromContext(ctx).Debug("upload artifact %s to %s", file, u.String())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to upload artifact to %s: %w", u.String(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("kubetest: failed to upload artifact to %s: status %d: %s", u.String(), resp.StatusCode, string(b))
+	}
+	return u.String(), nil
+}
+
+// sign signs the request by AWS Signature Version 4.
+// The host and all headers of the request are signed.
+// see also: https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (c *s3Client) sign(req *http.Request, payloadHash string) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.credential.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.credential.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, c.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashText(canonicalRequest),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(s3SigningKey(c.credential.secretAccessKey, date, c.region, "s3"), stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.credential.accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func s3SigningKey(secretAccessKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// s3EscapePath escapes each segment of the path by URI encoding of AWS Signature Version 4.
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for idx, segment := range segments {
+		segments[idx] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3Escape escapes all characters except the unreserved characters of RFC 3986.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,382 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// artifactTransfer copies the artifact from the container with the size limit and the compression of the artifact.
+// The size is accumulated for all paths of the artifact copied from the container.
+type artifactTransfer struct {
+	name        string
+	maxSize     *resource.Quantity
+	compression ArtifactCompressionType
+	size        int64
+}
+
+func newArtifactTransfer(artifact ArtifactSpec) *artifactTransfer {
+	return &artifactTransfer{
+		name:        artifact.Name,
+		maxSize:     artifact.MaxSize,
+		compression: artifact.Compression,
+	}
+}
+
+// usesArchive returns true if the artifact is transferred as the archive stream to check the size or to compress it.
+func (t *artifactTransfer) usesArchive() bool {
+	return t.maxSize != nil || t.compression != ""
+}
+
+func (t *artifactTransfer) exceedsMaxSize() bool {
+	return t.maxSize != nil && t.size > t.maxSize.Value()
+}
+
+func (t *artifactTransfer) errExceedsMaxSize() error {
+	return fmt.Errorf("kubetest: artifact %s exceeds max size %s", t.name, t.maxSize.String())
+}
+
+// copyFrom copies src on the container to dst.
+// If the artifact doesn't need the archive stream or the executor doesn't support it, copies by JobExecutor.CopyFrom.
+// In that case, the size is checked by du command on the container before copying, and checked again after copying.
+// If du command cannot be run on the container, the size is checked only after copying, so maxSize doesn't protect the local disk.
+// If the transfer failed, dst is removed.
+func (t *artifactTransfer) copyFrom(ctx context.Context, exec JobExecutor, src, dst string, enabledAgent bool) error {
+	if t.usesArchive() {
+		if archiver, ok := exec.(archiveJobExecutor); ok {
+			err := t.copyArchiveFrom(ctx, archiver, src, dst)
+			if !errors.Is(err, errArchiveUnsupported) {
+				if err != nil {
+					_ = os.RemoveAll(dst)
+				}
+				return err
+			}
+		}
+	}
+	if t.maxSize != nil {
+		size, err := t.sizeOnContainer(ctx, exec, src)
+		if err != nil {
+			LoggerFromContext(ctx).Warn("failed to get size of artifact %s on container. the size is checked after copying: %s", t.name, err)
+		} else if t.size+size > t.maxSize.Value() {
+			return t.errExceedsMaxSize()
+		}
+	}
+	copyPath := dst
+	if enabledAgent {
+		// If enabled kubetest-agent, the artifact is copied into the directory.
+		// So, trim last path.
+		copyPath = filepath.Dir(dst)
+	}
+	if err := exec.CopyFrom(ctx, src, copyPath); err != nil {
+		return err
+	}
+	if t.maxSize == nil {
+		return nil
+	}
+	if err := filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		t.size += info.Size()
+		return nil
+	}); err != nil {
+		return fmt.Errorf("kubetest: failed to get size of artifact %s: %w", t.name, err)
+	}
+	if t.exceedsMaxSize() {
+		_ = os.RemoveAll(dst)
+		return t.errExceedsMaxSize()
+	}
+	return nil
+}
+
+// sizeOnContainer returns the total size of the files of src on the container by du command.
+func (t *artifactTransfer) sizeOnContainer(ctx context.Context, exec JobExecutor, src string) (int64, error) {
+	out, err := exec.PrepareCommand(ctx, []string{"du", "-sb", src})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", strings.TrimSpace(string(out)), err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected output of du: %q", out)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output of du: %q", out)
+	}
+	return size, nil
+}
+
+func (t *artifactTransfer) copyArchiveFrom(ctx context.Context, archiver archiveJobExecutor, src, dst string) error {
+	// stop the transfer on the container when the copy finishes with error.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, err := archiver.CopyArchiveFrom(ctx, src, t.compression == ArtifactCompressionTypeGzip)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := t.extract(r, path.Base(src), dst); err != nil {
+		return err
+	}
+	// read the rest of the stream to receive the error of the command.
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("kubetest: artifact %s is truncated: %w", t.name, err)
+	}
+	return nil
+}
+
+// extract extracts the archive whose entries start with base to dst.
+// The entries are never written through the symbolic links, and the symbolic links must not point outside dst.
+func (t *artifactTransfer) extract(r io.Reader, base, dst string) error {
+	if t.compression == ArtifactCompressionTypeGzip {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("kubetest: artifact %s is truncated: %w", t.name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	links := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return t.verifySymlinks(dst, links)
+		}
+		if err != nil {
+			return fmt.Errorf("kubetest: artifact %s is truncated: %w", t.name, err)
+		}
+		name := path.Clean(hdr.Name)
+		var rel string
+		switch {
+		case name == base:
+		case strings.HasPrefix(name, base+"/"):
+			rel = strings.TrimPrefix(name, base+"/")
+		default:
+			return fmt.Errorf("kubetest: unexpected entry %s in archive of artifact %s", hdr.Name, t.name)
+		}
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("kubetest: unexpected entry %s in archive of artifact %s", hdr.Name, t.name)
+		}
+		if err := t.checkNoSymlink(dst, rel); err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if !isInDir(dst, resolveSymlink(target, hdr.Linkname)) {
+				return fmt.Errorf("kubetest: symbolic link %s in archive of artifact %s points outside the artifact: %s", hdr.Name, t.name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			links = append(links, target)
+		case tar.TypeReg:
+			t.size += hdr.Size
+			if t.exceedsMaxSize() {
+				return t.errExceedsMaxSize()
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := writeArchiveFile(tr, target, hdr.FileInfo().Mode()); err != nil {
+				return fmt.Errorf("kubetest: artifact %s is truncated: %w", t.name, err)
+			}
+		}
+	}
+}
+
+// checkNoSymlink returns error if dst/rel or its parent directories under dst are the symbolic links.
+func (t *artifactTransfer) checkNoSymlink(dst, rel string) error {
+	if rel == "" {
+		return nil
+	}
+	p := dst
+	for _, elem := range strings.Split(rel, "/") {
+		p = filepath.Join(p, elem)
+		info, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("kubetest: entry %s in archive of artifact %s is written through symbolic link", rel, t.name)
+		}
+	}
+	return nil
+}
+
+// verifySymlinks checks that the extracted symbolic links don't point outside dst after resolving all links.
+// The link that points outside dst through the other links cannot be detected by its name only.
+func (t *artifactTransfer) verifySymlinks(dst string, links []string) error {
+	if len(links) == 0 {
+		return nil
+	}
+	resolvedDst, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		resolved, err := filepath.EvalSymlinks(link)
+		if errors.Is(err, fs.ErrNotExist) {
+			// dangling link has already been checked by its name.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("kubetest: failed to resolve symbolic link %s of artifact %s: %w", link, t.name, err)
+		}
+		if !isInDir(resolvedDst, resolved) {
+			return fmt.Errorf("kubetest: symbolic link %s of artifact %s points outside the artifact", link, t.name)
+		}
+	}
+	return nil
+}
+
+// resolveSymlink returns the path that the symbolic link at p points to without accessing the filesystem.
+func resolveSymlink(p, linkname string) string {
+	if path.IsAbs(linkname) {
+		return filepath.Clean(filepath.FromSlash(linkname))
+	}
+	return filepath.Join(filepath.Dir(p), filepath.FromSlash(linkname))
+}
+
+func isInDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func writeArchiveFile(r io.Reader, target string, mode os.FileMode) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeArchive writes the tar archive of src to w. The entries start with the base name of src.
+func writeArchive(w io.Writer, src string, compressed bool) error {
+	if compressed {
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	baseDir := filepath.Dir(src)
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(p)
+			if err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+const artifactManifestExt = ".sha256"
+
+// writeArtifactManifest writes the SHA-256 manifest of the file or the directory next to it ( e.g. <path>.sha256 ).
+// The format is the same as sha256sum, so it can be verified by `sha256sum -c` in the parent directory.
+func writeArtifactManifest(p string) error {
+	var b strings.Builder
+	baseDir := filepath.Dir(p)
+	if err := filepath.WalkDir(p, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.ToSlash(rel))
+		return nil
+	}); err != nil {
+		return fmt.Errorf("kubetest: failed to create manifest of %s: %w", p, err)
+	}
+	if err := os.WriteFile(p+artifactManifestExt, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("kubetest: failed to write manifest of %s: %w", p, err)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -61,6 +62,10 @@ func TestDeepCopy(t *testing.T) {
 			PreSteps: []PreStep{
 				{
 					Name: "prestep1",
+					RetryPolicy: &RetryPolicy{
+						MaxAttempts: 5,
+						RetryOn:     []RetryErrorClass{RetryErrorClassEviction},
+					},
 					Template: TestJobTemplateSpec{
 						ObjectMeta: metav1.ObjectMeta{
 							Name: "prestep1",
@@ -119,6 +124,11 @@ func TestDeepCopy(t *testing.T) {
 				},
 			},
 			MainStep: MainStep{
+				RetryPolicy: &RetryPolicy{
+					Backoff:    "5s",
+					MaxBackoff: "5m",
+					RetryOn:    []RetryErrorClass{RetryErrorClassNodeLost, RetryErrorClassImagePull},
+				},
 				Strategy: &Strategy{
 					Key: StrategyKeySpec{
 						Env: "TEST",
@@ -146,6 +156,22 @@ func TestDeepCopy(t *testing.T) {
 					},
 					Scheduler: Scheduler{
 						MaxContainersPerPod: 10,
+						Resources: &SchedulerResources{
+							PerKey: &corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+							},
+							NodeSize: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("8")},
+						},
+					},
+					Placement: &Placement{
+						Spread: &PlacementSpread{Type: PlacementSpreadTypeAntiAffinity},
+						NodeSelectors: []KeyNodeSelector{
+							{
+								Pattern:      "^integration/",
+								NodeSelector: map[string]string{"pool": "heavy"},
+								Tolerations:  []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+							},
+						},
 					},
 				},
 				Template: TestJobTemplateSpec{
@@ -206,6 +232,21 @@ func TestDeepCopy(t *testing.T) {
 					"key": "value",
 				},
 			},
+			PreInit: PreInitSpec{
+				Parallelism: 8,
+				Timeout: PreInitTimeout{
+					Repo: "30m",
+				},
+				Retry: PreInitRetry{
+					Limit:   func(v int32) *int32 { return &v }(5),
+					Backoff: "2s",
+				},
+			},
+			SharedStorage: &SharedStorageSpec{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: "kubetest-cache",
+				},
+			},
 		},
 	}
 	orig, err := json.Marshal(job)
@@ -243,6 +284,7 @@ func TestDeepCopy(t *testing.T) {
 	}
 	for _, prestep := range job.Spec.PreSteps {
 		_ = prestep.DeepCopy()
+		_ = prestep.RetryPolicy.DeepCopy()
 		for _, artifact := range prestep.Template.Spec.Artifacts {
 			_ = artifact.DeepCopy()
 			_ = artifact.Container.DeepCopy()
@@ -260,11 +302,15 @@ func TestDeepCopy(t *testing.T) {
 			}
 		}
 	}
+	_ = job.Spec.MainStep.DeepCopy()
+	_ = job.Spec.MainStep.RetryPolicy.DeepCopy()
 	_ = job.Spec.MainStep.Strategy.DeepCopy()
 	_ = job.Spec.MainStep.Strategy.Key.DeepCopy()
 	_ = job.Spec.MainStep.Strategy.Key.Source.DeepCopy()
 	_ = job.Spec.MainStep.Strategy.Key.Source.Dynamic.DeepCopy()
 	_ = job.Spec.MainStep.Strategy.Scheduler.DeepCopy()
+	_ = job.Spec.MainStep.Strategy.Scheduler.Resources.DeepCopy()
+	_ = job.Spec.MainStep.Strategy.Placement.DeepCopy()
 	_ = job.Spec.MainStep.Template.DeepCopy()
 	_ = job.Spec.MainStep.Template.Spec.DeepCopy()
 	for _, volume := range job.Spec.MainStep.Template.Spec.Volumes {
@@ -283,4 +329,6 @@ func TestDeepCopy(t *testing.T) {
 		_ = artifact.DeepCopy()
 	}
 	_ = job.Spec.Log.DeepCopy()
+	_ = job.Spec.PreInit.DeepCopy()
+	_ = job.Spec.SharedStorage.DeepCopy()
 }
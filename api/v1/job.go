@@ -4,18 +4,27 @@
 package v1
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/goccy/kubejob"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
 )
 
 type PreInitCallback func(context.Context, JobExecutor) error
@@ -29,6 +38,8 @@ type Job interface {
 
 type JobExecutor interface {
 	Output(context.Context) ([]byte, error)
+	// OutputStream runs the command like Output, and also writes the output to the writer as it arrives.
+	OutputStream(context.Context, io.Writer) ([]byte, error)
 	ExecAsync(context.Context)
 	TerminationLog(context.Context, string) error
 	Stop(context.Context) error
@@ -39,11 +50,26 @@ type JobExecutor interface {
 	PrepareCommand(context.Context, []string) ([]byte, error)
 }
 
+// archiveJobExecutor is implemented by JobExecutor that can transfer the file or the directory on the container as the tar archive stream.
+// The entries of the archive start with the base name of src.
+type archiveJobExecutor interface {
+	CopyArchiveFrom(ctx context.Context, src string, compressed bool) (io.ReadCloser, error)
+}
+
+// runningJobExecutor is implemented by JobExecutor that can tell whether the container is still running.
+type runningJobExecutor interface {
+	isRunning(ctx context.Context) (bool, error)
+}
+
+// errArchiveUnsupported is returned by CopyArchiveFrom if the executor cannot transfer the archive stream ( e.g. kubetest-agent is used ).
+var errArchiveUnsupported = errors.New("kubetest: archive stream is unsupported")
+
 type JobBuilder struct {
-	cfg       *rest.Config
-	namespace string
-	runMode   RunMode
-	finalizer *corev1.Container
+	cfg                    *rest.Config
+	namespace              string
+	runMode                RunMode
+	finalizer              *corev1.Container
+	detectImagePullFailure bool
 }
 
 func NewJobBuilder(cfg *rest.Config, namespace string, runMode RunMode) *JobBuilder {
@@ -58,6 +84,12 @@ func (b *JobBuilder) SetFinalizer(finalizer *corev1.Container) {
 	b.finalizer = finalizer
 }
 
+// EnableImagePullFailureDetection fails the job if the container of the pod cannot pull the image.
+// It's used on kubernetes only.
+func (b *JobBuilder) EnableImagePullFailureDetection() {
+	b.detectImagePullFailure = true
+}
+
 func (b *JobBuilder) BuildWithJob(jobSpec *batchv1.Job, containerNameToInstalledPathMap map[string]string, sharedAgentSpec *TestAgentSpec) (Job, error) {
 	switch b.runMode {
 	case RunModeKubernetes:
@@ -87,7 +119,11 @@ func (b *JobBuilder) BuildWithJob(jobSpec *batchv1.Job, containerNameToInstalled
 			job.UseAgent(cfg)
 			agentConfig = cfg
 		}
-		return newKubernetesJob(job, b.finalizer, agentConfig), nil
+		kjob := newKubernetesJob(b.cfg, job, b.finalizer, agentConfig)
+		if b.detectImagePullFailure {
+			kjob.imagePullWatcher = newImagePullWatcher(b.cfg, b.namespace, jobSpec.Spec.Template.Labels[kubejob.SelectorLabel])
+		}
+		return kjob, nil
 	case RunModeLocal:
 		rootDir, err := os.MkdirTemp("", "root")
 		if err != nil {
@@ -101,16 +137,19 @@ func (b *JobBuilder) BuildWithJob(jobSpec *batchv1.Job, containerNameToInstalled
 }
 
 type kubernetesJob struct {
-	job           *kubejob.Job
-	finalizer     *corev1.Container
-	agentConfig   *kubejob.AgentConfig
-	mountCallback func(context.Context, JobExecutor, bool) error
+	cfg              *rest.Config
+	job              *kubejob.Job
+	finalizer        *corev1.Container
+	agentConfig      *kubejob.AgentConfig
+	mountCallback    func(context.Context, JobExecutor, bool) error
+	imagePullWatcher *imagePullWatcher
 }
 
 var defaultMountCallback = func(context.Context, JobExecutor, bool) error { return nil }
 
-func newKubernetesJob(job *kubejob.Job, finalizer *corev1.Container, agentConfig *kubejob.AgentConfig) *kubernetesJob {
+func newKubernetesJob(cfg *rest.Config, job *kubejob.Job, finalizer *corev1.Container, agentConfig *kubejob.AgentConfig) *kubernetesJob {
 	return &kubernetesJob{
+		cfg:           cfg,
 		job:           job,
 		finalizer:     finalizer,
 		agentConfig:   agentConfig,
@@ -124,7 +163,7 @@ func (j *kubernetesJob) Spec() batchv1.JobSpec {
 
 func (j *kubernetesJob) PreInit(c TestJobContainer, cb PreInitCallback) {
 	j.job.PreInit(c.Container, func(ctx context.Context, exec *kubejob.JobExecutor) error {
-		return cb(ctx, &kubernetesJobExecutor{exec: exec})
+		return cb(ctx, &kubernetesJobExecutor{cfg: j.cfg, exec: exec})
 	})
 }
 
@@ -136,7 +175,7 @@ func (j *kubernetesJob) RunWithExecutionHandler(ctx context.Context, handler fun
 	j.job.DisableInitContainerLog()
 	j.job.SetPendingPhaseTimeout(10 * time.Minute)
 	j.job.SetInitContainerExecutionHandler(func(ctx context.Context, exec *kubejob.JobExecutor) error {
-		e := &kubernetesJobExecutor{exec: exec}
+		e := &kubernetesJobExecutor{cfg: j.cfg, exec: exec}
 		if err := j.mountCallback(ctx, e, true); err != nil {
 			return err
 		}
@@ -148,14 +187,20 @@ func (j *kubernetesJob) RunWithExecutionHandler(ctx context.Context, handler fun
 		finalizer = &kubejob.JobFinalizer{
 			Container: *j.finalizer,
 			Handler: func(ctx context.Context, exec *kubejob.JobExecutor) error {
-				return finalizerHandler(ctx, &kubernetesJobExecutor{exec: exec})
+				return finalizerHandler(ctx, &kubernetesJobExecutor{cfg: j.cfg, exec: exec})
 			},
 		}
 	}
-	return j.job.RunWithExecutionHandler(ctx, func(ctx context.Context, execs []*kubejob.JobExecutor) error {
+	if j.imagePullWatcher != nil {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		go j.imagePullWatcher.watch(ctx, cancel)
+	}
+	err := j.job.RunWithExecutionHandler(ctx, func(ctx context.Context, execs []*kubejob.JobExecutor) error {
 		converted := make([]JobExecutor, 0, len(execs))
 		for _, exec := range execs {
-			e := &kubernetesJobExecutor{exec: exec}
+			e := &kubernetesJobExecutor{cfg: j.cfg, exec: exec}
 			if err := j.mountCallback(ctx, e, false); err != nil {
 				return err
 			}
@@ -163,10 +208,70 @@ func (j *kubernetesJob) RunWithExecutionHandler(ctx context.Context, handler fun
 		}
 		return handler(ctx, converted)
 	}, finalizer)
+	var podErr *podFailureError
+	if errors.As(context.Cause(ctx), &podErr) {
+		return podErr
+	}
+	return err
+}
+
+const imagePullWatchInterval = 5 * time.Second
+
+// imagePullWatcher watches the pod of the job, and cancels the job if the container cannot pull the image.
+// kubejob waits for the pending pod that cannot pull the image of the main container without timeout.
+type imagePullWatcher struct {
+	cfg       *rest.Config
+	namespace string
+	selector  string
+}
+
+func newImagePullWatcher(cfg *rest.Config, namespace, labelID string) *imagePullWatcher {
+	return &imagePullWatcher{
+		cfg:       cfg,
+		namespace: namespace,
+		selector:  fmt.Sprintf("%s=%s", kubejob.SelectorLabel, labelID),
+	}
+}
+
+func (w *imagePullWatcher) watch(ctx context.Context, cancel context.CancelCauseFunc) {
+	clientset, err := kubernetes.NewForConfig(w.cfg)
+	if err != nil {
+		LoggerFromContext(ctx).Warn("failed to create clientset to watch image pull: %s", err)
+		return
+	}
+	ticker := time.NewTicker(imagePullWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pods, err := clientset.CoreV1().Pods(w.namespace).List(ctx, metav1.ListOptions{LabelSelector: w.selector})
+		if err != nil {
+			LoggerFromContext(ctx).Debug("failed to get pods to watch image pull: %s", err)
+			continue
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.Status.Phase != corev1.PodPending {
+				continue
+			}
+			if podErr := newPodFailureError(pod); podErr != nil && podErr.class == RetryErrorClassImagePull {
+				cancel(podErr)
+				return
+			}
+		}
+	}
 }
 
 type kubernetesJobExecutor struct {
+	cfg  *rest.Config
 	exec *kubejob.JobExecutor
+	// streamed whether the command has been run by OutputStream without kubejob's executor.
+	streamed bool
+	// exitStatus the exit status of the command run by OutputStream.
+	exitStatus int
 }
 
 func (e *kubernetesJobExecutor) PrepareCommand(ctx context.Context, cmd []string) ([]byte, error) {
@@ -177,12 +282,159 @@ func (e *kubernetesJobExecutor) Output(ctx context.Context) ([]byte, error) {
 	return e.exec.ExecOnly(ctx)
 }
 
+// OutputStream runs the command on its own exec stream and writes stdout/stderr to the writer as they arrive,
+// because kubejob's executor buffers the output until the command exits.
+// The agent doesn't support the exec stream, so the output is written after the command is finished if it's enabled.
+func (e *kubernetesJobExecutor) OutputStream(ctx context.Context, w io.Writer) ([]byte, error) {
+	if e.exec.EnabledAgent() {
+		out, err := e.exec.ExecOnly(ctx)
+		if len(out) != 0 {
+			_, _ = w.Write(out)
+		}
+		return out, err
+	}
+	// kubejob doesn't know the result of the command, so the exit status is written by TerminationLog.
+	e.streamed = true
+	container := e.exec.Container
+	cmd := append(append([]string{}, container.Command...), container.Args...)
+	executor, err := e.newExecutor([]string{"sh", "-c", shellCommand(cmd)})
+	if err != nil {
+		return nil, &kubejob.FailedJob{Pod: e.exec.Pod, Reason: err}
+	}
+	out, err := streamExec(ctx, executor, w)
+	if err != nil {
+		e.exitStatus = exitStatus(err)
+		return out, &kubejob.FailedJob{Pod: e.exec.Pod, Reason: err}
+	}
+	return out, nil
+}
+
+// exitStatus returns the exit status of the command error returned by streamExec.
+// If the command couldn't be run, returns 1 as well as kubejob.
+func exitStatus(err error) int {
+	var cmdErr *kubejob.CommandError
+	if !errors.As(err, &cmdErr) {
+		return 1
+	}
+	var exitErr interface{ ExitStatus() int }
+	if errors.As(cmdErr.WriterErr, &exitErr) && exitErr.ExitStatus() != 0 {
+		return exitErr.ExitStatus()
+	}
+	return 1
+}
+
+// streamExec streams the output of the executor to the writer and returns the whole output.
+// If it cannot connect to the container, retries as long as nothing has been written.
+func streamExec(ctx context.Context, executor remotecommand.Executor, w io.Writer) ([]byte, error) {
+	var buf bytes.Buffer
+	out := &streamWriter{w: io.MultiWriter(&buf, w)}
+	var err error
+	for retry := 0; ; retry++ {
+		err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+			Stdout: out,
+			Stderr: out,
+		})
+		if err == nil {
+			return buf.Bytes(), nil
+		}
+		cmdErr := &kubejob.CommandError{WriterErr: err}
+		if cmdErr.IsExitError() || out.written() || retry >= kubejob.ExecRetryCount || ctx.Err() != nil {
+			return buf.Bytes(), cmdErr
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// streamWriter serializes the writes of stdout and stderr copied concurrently.
+type streamWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	n  int
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.w.Write(p)
+	w.n += n
+	return n, err
+}
+
+func (w *streamWriter) written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n != 0
+}
+
+// shellCommand returns the command text for sh -c in the same way as kubejob.
+// The argument that contains white spaces is passed through the variable so as not to be split.
+func shellCommand(cmd []string) string {
+	normalized := make([]string, 0, len(cmd))
+	vars := []string{}
+	for idx, c := range cmd {
+		c = strings.Trim(c, " ")
+		if strings.Contains(c, " ") {
+			vars = append(vars, fmt.Sprintf("VAR%d=$(cat <<-'EOS'\n%s\nEOS\n)", idx, c))
+			normalized = append(normalized, fmt.Sprintf(`"$VAR%d"`, idx))
+		} else {
+			normalized = append(normalized, c)
+		}
+	}
+	text := strings.Join(normalized, " ")
+	if len(vars) == 0 {
+		return text
+	}
+	return fmt.Sprintf("%s; %s", strings.Join(vars, ";"), text)
+}
+
 func (e *kubernetesJobExecutor) ExecAsync(ctx context.Context) {
 	e.exec.ExecAsync(ctx)
 }
 
+const kubejobStatusPath = "/tmp/kubejob-status"
+
 func (e *kubernetesJobExecutor) TerminationLog(ctx context.Context, log string) error {
-	return e.exec.TerminationLog(log)
+	if !e.streamed {
+		return e.exec.TerminationLog(log)
+	}
+	// kubejob's executor doesn't know the command has been run, so write the log and the exit status by itself.
+	// kubejob's Stop always writes success status, so the status file is pointed to /dev/null while stopping it,
+	// and then the real status is put there at once. The container keeps waiting until the status file is a regular file.
+	// The context isn't canceled here so that the container certainly gets the status to exit like kubejob's Stop.
+	ctx = context.WithoutCancel(ctx)
+	path := e.exec.Container.TerminationMessagePath
+	if path == "" {
+		path = corev1.TerminationMessagePathDefault
+	}
+	if err := e.execQuietly(ctx, fmt.Sprintf(
+		"%s && ln -sf /dev/null %s",
+		shellCommand([]string{"echo", log, ">", path}), kubejobStatusPath,
+	)); err != nil {
+		return fmt.Errorf("kubetest: failed to write termination log: %w", err)
+	}
+	if err := e.exec.Stop(); err != nil {
+		return fmt.Errorf("kubetest: failed to stop container: %w", err)
+	}
+	if err := e.execQuietly(ctx, fmt.Sprintf(
+		"echo %[1]d > %[2]s.tmp && mv -f %[2]s.tmp %[2]s",
+		e.exitStatus, kubejobStatusPath,
+	)); err != nil {
+		return fmt.Errorf("kubetest: failed to write exit status: %w", err)
+	}
+	return nil
+}
+
+// execQuietly runs the shell command without writing the command and its output to stdout
+// so as not to be mixed into the log of the test command.
+func (e *kubernetesJobExecutor) execQuietly(ctx context.Context, cmd string) error {
+	executor, err := e.newExecutor([]string{"sh", "-c", cmd})
+	if err != nil {
+		return err
+	}
+	if _, err := streamExec(ctx, executor, io.Discard); err != nil {
+		return err
+	}
+	return nil
 }
 
 func (e *kubernetesJobExecutor) Stop(_ context.Context) error {
@@ -203,6 +455,79 @@ func (e *kubernetesJobExecutor) CopyFrom(ctx context.Context, src string, dst st
 	return e.exec.CopyFromPod(ctx, src, dst)
 }
 
+// CopyArchiveFrom runs tar on the container and returns the stream of the archive.
+// The error of the command is returned when the stream is read to the end.
+func (e *kubernetesJobExecutor) CopyArchiveFrom(ctx context.Context, src string, compressed bool) (io.ReadCloser, error) {
+	if e.exec.EnabledAgent() {
+		return nil, errArchiveUnsupported
+	}
+	flags := "cf"
+	if compressed {
+		flags = "czf"
+	}
+	executor, err := e.newExecutor([]string{"tar", flags, "-", "-C", path.Dir(src), path.Base(src)})
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to create executor to copy %s: %w", src, err)
+	}
+	pod := e.exec.Pod
+	LoggerFromContext(ctx).Debug(
+		"copy archive of %s on container(%s) in %s pod (compressed: %t)",
+		src, e.exec.Container.Name, pod.Status.PodIP, compressed,
+	)
+	r, w := io.Pipe()
+	go func() {
+		var stderr bytes.Buffer
+		if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+			Stdout: w,
+			Stderr: &stderr,
+		}); err != nil {
+			w.CloseWithError(fmt.Errorf("kubetest: failed to archive %s: %s: %w", src, strings.TrimSpace(stderr.String()), err))
+			return
+		}
+		w.Close()
+	}()
+	return r, nil
+}
+
+// newExecutor creates the executor of the command on the container through the exec subresource.
+func (e *kubernetesJobExecutor) newExecutor(cmd []string) (remotecommand.Executor, error) {
+	clientset, err := kubernetes.NewForConfig(e.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to create clientset: %w", err)
+	}
+	pod := e.exec.Pod
+	req := clientset.CoreV1().RESTClient().Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: e.exec.Container.Name,
+			Command:   cmd,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	return remotecommand.NewSPDYExecutor(e.cfg, "POST", req.URL())
+}
+
+// isRunning gets the current status of the container from the pod.
+func (e *kubernetesJobExecutor) isRunning(ctx context.Context) (bool, error) {
+	clientset, err := kubernetes.NewForConfig(e.cfg)
+	if err != nil {
+		return false, fmt.Errorf("kubetest: failed to create clientset: %w", err)
+	}
+	pod, err := clientset.CoreV1().Pods(e.exec.Pod.Namespace).Get(ctx, e.exec.Pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("kubetest: failed to get pod %s: %w", e.exec.Pod.Name, err)
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == e.exec.Container.Name {
+			return status.State.Running != nil, nil
+		}
+	}
+	return false, nil
+}
+
 func (e *kubernetesJobExecutor) CopyTo(ctx context.Context, src string, dst string) error {
 	containerName := e.exec.Container.Name
 	addr := e.exec.Pod.Status.PodIP
@@ -339,6 +664,23 @@ func (e *localJobExecutor) Output(_ context.Context) ([]byte, error) {
 	return cmd.CombinedOutput()
 }
 
+func (e *localJobExecutor) OutputStream(_ context.Context, w io.Writer) ([]byte, error) {
+	cmdarr := append(e.container.Command, e.container.Args...)
+	if len(cmdarr) == 0 {
+		return nil, fmt.Errorf("kubetest: invalid command. command is empty")
+	}
+	cmd, err := e.cmd(cmdarr)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	out := io.MultiWriter(&buf, w)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err = cmd.Run()
+	return buf.Bytes(), err
+}
+
 func (e *localJobExecutor) ExecAsync(_ context.Context) {
 	cmdarr := append(e.container.Command, e.container.Args...)
 	if len(cmdarr) == 0 {
@@ -373,9 +715,27 @@ func (e *localJobExecutor) CopyFrom(ctx context.Context, src string, dst string)
 	return localCopy(src, dst)
 }
 
+func (e *localJobExecutor) CopyArchiveFrom(ctx context.Context, src string, compressed bool) (io.ReadCloser, error) {
+	src = filepath.Join(e.rootDir, src)
+	if _, err := os.Lstat(src); err != nil {
+		return nil, err
+	}
+	LoggerFromContext(ctx).Debug("copy archive of %s on local (compressed: %t)", src, compressed)
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeArchive(w, src, compressed))
+	}()
+	return r, nil
+}
+
 func (e *localJobExecutor) CopyTo(ctx context.Context, src string, dst string) error {
 	dst = filepath.Join(e.rootDir, dst)
-	if filepath.Base(src) != filepath.Base(dst) {
+	if existsFile(dst) {
+		// overwrite the existing file in the same way as copying to the container.
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	} else if filepath.Base(src) != filepath.Base(dst) {
 		dst = filepath.Join(dst, filepath.Base(src))
 	}
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
@@ -437,6 +797,12 @@ func (e *dryRunJobExecutor) Output(_ context.Context) ([]byte, error) {
 	return []byte("( dry running .... )"), nil
 }
 
+func (e *dryRunJobExecutor) OutputStream(ctx context.Context, w io.Writer) ([]byte, error) {
+	out, err := e.Output(ctx)
+	_, _ = w.Write(out)
+	return out, err
+}
+
 func (e *dryRunJobExecutor) ExecAsync(_ context.Context)                      {}
 func (e *dryRunJobExecutor) TerminationLog(_ context.Context, _ string) error { return nil }
 func (e *dryRunJobExecutor) Stop(_ context.Context) error                     { return nil }
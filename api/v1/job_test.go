@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/goccy/kubejob"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// exitError implements the exit error of the command returned by the exec stream.
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string   { return "command terminated with non-zero exit code" }
+func (e exitError) String() string  { return e.Error() }
+func (e exitError) Exited() bool    { return true }
+func (e exitError) ExitStatus() int { return e.code }
+
+// stepExecutor writes the lines one by one, and waits for the signal before writing the next line.
+type stepExecutor struct {
+	lines []string
+	next  chan struct{}
+	err   error
+}
+
+func (e *stepExecutor) Stream(options remotecommand.StreamOptions) error {
+	return e.StreamWithContext(context.Background(), options)
+}
+
+func (e *stepExecutor) StreamWithContext(ctx context.Context, options remotecommand.StreamOptions) error {
+	for idx, line := range e.lines {
+		if idx != 0 {
+			<-e.next
+		}
+		w := options.Stdout
+		if idx%2 == 1 {
+			w = options.Stderr
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return e.err
+}
+
+type notifyWriter struct {
+	written chan string
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	w.written <- string(p)
+	return len(p), nil
+}
+
+func TestStreamExec(t *testing.T) {
+	t.Run("output arrives before exit", func(t *testing.T) {
+		executor := &stepExecutor{
+			lines: []string{"first\n", "second\n"},
+			next:  make(chan struct{}),
+			err:   exitError{code: 2},
+		}
+		w := &notifyWriter{written: make(chan string, 2)}
+		type result struct {
+			out []byte
+			err error
+		}
+		done := make(chan result)
+		go func() {
+			out, err := streamExec(context.Background(), executor, w)
+			done <- result{out: out, err: err}
+		}()
+		select {
+		case line := <-w.written:
+			if line != "first\n" {
+				t.Fatalf("unexpected output: %q", line)
+			}
+		case <-done:
+			t.Fatal("command exited before the output arrives")
+		case <-time.After(5 * time.Second):
+			t.Fatal("output doesn't arrive")
+		}
+		close(executor.next)
+		res := <-done
+		if string(res.out) != "first\nsecond\n" {
+			t.Fatalf("unexpected output: %q", res.out)
+		}
+		var cmdErr *kubejob.CommandError
+		if !errors.As(res.err, &cmdErr) || !cmdErr.IsExitError() {
+			t.Fatalf("expected exit error but got %v", res.err)
+		}
+		if status := exitStatus(res.err); status != 2 {
+			t.Fatalf("failed to get exit status: %d", status)
+		}
+	})
+}
@@ -6,10 +6,13 @@ package v1
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Logger interface {
@@ -19,17 +22,132 @@ type Logger interface {
 	Warn(format string, args ...interface{})
 	Error(format string, args ...interface{})
 	AddMask(mask string)
+	// AddMaskPattern adds pattern to mask the matched text.
+	// If the pattern has a capturing group, only the first group is masked.
+	AddMaskPattern(pattern *regexp.Regexp)
+	// Mask returns the text whose secrets are masked.
+	Mask(text string) string
 	Group() Logger
+	GroupWithFields(fields LogFields) Logger
 	LogGroup(group Logger)
+	// Writer returns writer to log the written text line by line.
+	// Close must be called to flush the last line that doesn't end with a newline.
+	Writer() io.WriteCloser
+}
+
+// LogFields describes where a log record comes from.
+type LogFields struct {
+	Step      StepType `json:"step,omitempty"`
+	Task      string   `json:"task,omitempty"`
+	Key       string   `json:"key,omitempty"`
+	Container string   `json:"container,omitempty"`
+	Pod       string   `json:"pod,omitempty"`
+}
+
+func (f LogFields) merge(fields LogFields) LogFields {
+	if fields.Step != "" {
+		f.Step = fields.Step
+	}
+	if fields.Task != "" {
+		f.Task = fields.Task
+	}
+	if fields.Key != "" {
+		f.Key = fields.Key
+	}
+	if fields.Container != "" {
+		f.Container = fields.Container
+	}
+	if fields.Pod != "" {
+		f.Pod = fields.Pod
+	}
+	return f
+}
+
+type logRecord struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	LogFields
+	Msg string `json:"msg"`
+
+	// raw is true if the record was written by Log ( without level prefix ).
+	raw bool
+}
+
+func newLogRecord(level LogLevel, msg string, fields LogFields) *logRecord {
+	return &logRecord{
+		Time:      time.Now(),
+		Level:     level.String(),
+		LogFields: fields,
+		Msg:       msg,
+	}
+}
+
+func newRawLogRecord(msg string, fields LogFields) *logRecord {
+	record := newLogRecord(LogLevelInfo, msg, fields)
+	record.raw = true
+	return record
+}
+
+func (r *logRecord) text() string {
+	if r.raw {
+		return r.Msg
+	}
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(r.Level), r.Msg)
+}
+
+// streamText returns text prefixed by strategy key ( or container name ) to distinguish the output of concurrently running subtasks.
+func (r *logRecord) streamText() string {
+	prefix := r.Key
+	if prefix == "" {
+		prefix = r.Container
+	}
+	if prefix == "" {
+		return r.text()
+	}
+	return fmt.Sprintf("[%s] %s", prefix, r.text())
+}
+
+type logWriter struct {
+	log func(string)
+	buf []byte
+	mu  sync.Mutex
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		w.log(string(w.buf[:idx]))
+		w.buf = w.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (w *logWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) != 0 {
+		w.log(string(w.buf))
+		w.buf = nil
+	}
+	return nil
 }
 
 type mainLogger struct {
-	masks  []string
+	masker *logMasker
 	level  LogLevel
+	format LogFormatType
+	stream bool
 	out    io.Writer
 	buf    *bytes.Buffer
-	maskMu sync.RWMutex
-	logMu  sync.Mutex
+	// keyBufs keeps the grouped output for each strategy key.
+	keyBufs map[string]*bytes.Buffer
+	logMu   sync.Mutex
 }
 
 type loggerKey struct{}
@@ -43,34 +161,102 @@ func LoggerFromContext(ctx context.Context) Logger {
 }
 
 func NewLogger(out io.Writer, level LogLevel) Logger {
+	return NewLoggerWithFormat(out, level, LogFormatTypeText)
+}
+
+// NewLoggerWithFormat creates logger that writes records by specified format.
+// If LogFormatTypeJSON is specified, each record is written as a single JSON line.
+func NewLoggerWithFormat(out io.Writer, level LogLevel, format LogFormatType) Logger {
+	return NewLoggerWithSpec(out, LogSpec{Level: level, Format: format})
+}
+
+// NewLoggerWithSpec creates logger by LogSpec.
+// If spec.Level is LogLevelNone, LogLevelInfo is used.
+func NewLoggerWithSpec(out io.Writer, spec LogSpec) Logger {
+	level := spec.Level
+	if level == LogLevelNone {
+		level = LogLevelInfo
+	}
+	format := spec.Format
+	if format == "" {
+		format = LogFormatTypeText
+	}
 	return &mainLogger{
-		level: level,
-		out:   out,
-		buf:   bytes.NewBuffer([]byte{}),
+		masker:  newLogMasker(spec.MaskPatterns),
+		level:   level,
+		format:  format,
+		stream:  spec.Stream,
+		out:     out,
+		buf:     bytes.NewBuffer([]byte{}),
+		keyBufs: map[string]*bytes.Buffer{},
 	}
 }
 
 func (l *mainLogger) AddMask(mask string) {
-	l.maskMu.Lock()
-	l.masks = append(l.masks, mask)
-	l.maskMu.Unlock()
+	l.masker.addMask(mask)
+}
+
+func (l *mainLogger) AddMaskPattern(pattern *regexp.Regexp) {
+	l.masker.addPattern(pattern)
+}
+
+func (l *mainLogger) Mask(text string) string {
+	return l.masker.mask(text)
 }
 
 func (l *mainLogger) Group() Logger {
-	return &groupLogger{
-		level: l.level,
+	return l.GroupWithFields(LogFields{})
+}
+
+func (l *mainLogger) GroupWithFields(fields LogFields) Logger {
+	g := &groupLogger{
+		masker: l.masker,
+		level:  l.level,
+		fields: fields,
 	}
+	if l.stream {
+		g.stream = l.writeStream
+	}
+	return g
+}
+
+func (l *mainLogger) Writer() io.WriteCloser {
+	return &logWriter{log: l.Log}
 }
 
 type groupLogger struct {
-	level LogLevel
-	msgs  []string
+	// masker is shared with the main logger.
+	masker  *logMasker
+	level   LogLevel
+	fields  LogFields
+	records []*logRecord
+	// stream is called for each record as soon as it is logged.
+	stream func(*logRecord)
+	mu     sync.Mutex
+}
+
+func (g *groupLogger) AddMask(mask string) {
+	g.masker.addMask(mask)
+}
+
+func (g *groupLogger) AddMaskPattern(pattern *regexp.Regexp) {
+	g.masker.addPattern(pattern)
+}
+
+func (g *groupLogger) Mask(text string) string {
+	return g.masker.mask(text)
 }
 
-func (g *groupLogger) AddMask(mask string) {}
 func (g *groupLogger) Group() Logger {
+	return g.GroupWithFields(LogFields{})
+}
+
+func (g *groupLogger) GroupWithFields(fields LogFields) Logger {
 	return &groupLogger{
-		level: g.level,
+		masker: g.masker,
+		level:  g.level,
+		fields: g.fields.merge(fields),
+		stream: g.stream,
 	}
 }
 
@@ -79,110 +265,195 @@ func (g *groupLogger) LogGroup(group Logger) {
 	if !ok {
 		return
 	}
-	g.msgs = append(g.msgs, subgroup.msgs...)
+	records := subgroup.getRecords()
+	g.mu.Lock()
+	g.records = append(g.records, records...)
+	g.mu.Unlock()
+}
+
+func (g *groupLogger) Writer() io.WriteCloser {
+	return &logWriter{
+		log: func(line string) {
+			// keep empty lines to preserve the original output.
+			g.append(newRawLogRecord(line, g.fields))
+		},
+	}
 }
 
 func (g *groupLogger) Log(msg string) {
-	g.log(msg)
+	g.log(newRawLogRecord(msg, g.fields))
 }
 
 func (g *groupLogger) Debug(format string, args ...interface{}) {
 	if g.level < LogLevelDebug {
 		return
 	}
-	g.log("[DEBUG] " + fmt.Sprintf(format, args...))
+	g.log(newLogRecord(LogLevelDebug, fmt.Sprintf(format, args...), g.fields))
 }
 
 func (g *groupLogger) Info(format string, args ...interface{}) {
 	if g.level < LogLevelInfo {
 		return
 	}
-	g.log("[INFO] " + fmt.Sprintf(format, args...))
+	g.log(newLogRecord(LogLevelInfo, fmt.Sprintf(format, args...), g.fields))
 }
 
 func (g *groupLogger) Warn(format string, args ...interface{}) {
 	if g.level < LogLevelWarn {
 		return
 	}
-	g.log("[WARN] " + fmt.Sprintf(format, args...))
+	g.log(newLogRecord(LogLevelWarn, fmt.Sprintf(format, args...), g.fields))
 }
 
 func (g *groupLogger) Error(format string, args ...interface{}) {
 	if g.level < LogLevelError {
 		return
 	}
-	g.log("[ERROR] " + fmt.Sprintf(format, args...))
+	g.log(newLogRecord(LogLevelError, fmt.Sprintf(format, args...), g.fields))
 }
 
-func (g *groupLogger) log(msg string) {
-	if msg == "" {
+func (g *groupLogger) log(record *logRecord) {
+	if record.Msg == "" {
 		return
 	}
-	g.msgs = append(g.msgs, msg)
+	g.append(record)
+}
+
+func (g *groupLogger) append(record *logRecord) {
+	g.mu.Lock()
+	g.records = append(g.records, record)
+	g.mu.Unlock()
+	if g.stream != nil {
+		g.stream(record)
+	}
+}
+
+func (g *groupLogger) getRecords() []*logRecord {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*logRecord{}, g.records...)
 }
 
 func (g *groupLogger) buf() string {
-	return strings.Join(g.msgs, "\n")
+	records := g.getRecords()
+	msgs := make([]string, 0, len(records))
+	for _, record := range records {
+		msgs = append(msgs, record.text())
+	}
+	return strings.Join(msgs, "\n")
 }
 
+// LogGroup writes all records of the group at once.
+// If streaming is enabled, the records have already been written to the output as they arrived,
+// so they are written to the log buffer only ( the grouped output is kept in the log file ).
 func (l *mainLogger) LogGroup(group Logger) {
 	g, ok := group.(*groupLogger)
 	if !ok {
 		return
 	}
-	l.log(g.buf())
+	out := l.out
+	if l.stream {
+		out = io.Discard
+	}
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+	if key := g.fields.Key; key != "" {
+		keyBuf, exists := l.keyBufs[key]
+		if !exists {
+			keyBuf = new(bytes.Buffer)
+			l.keyBufs[key] = keyBuf
+		}
+		out = io.MultiWriter(out, keyBuf)
+	}
+	if l.format != LogFormatTypeJSON {
+		text := g.buf()
+		if text == "" {
+			return
+		}
+		l.writeTo(out, newRawLogRecord(text, LogFields{}))
+		return
+	}
+	for _, record := range g.getRecords() {
+		l.writeTo(out, record)
+	}
+}
+
+// keyLogs returns the grouped output for each strategy key.
+func (l *mainLogger) keyLogs() map[string][]byte {
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+	logs := make(map[string][]byte, len(l.keyBufs))
+	for key, buf := range l.keyBufs {
+		logs[key] = append([]byte{}, buf.Bytes()...)
+	}
+	return logs
 }
 
 func (l *mainLogger) Log(msg string) {
-	l.log(msg)
+	l.log(newRawLogRecord(msg, LogFields{}))
 }
 
 func (l *mainLogger) Debug(format string, args ...interface{}) {
 	if l.level < LogLevelDebug {
 		return
 	}
-	l.log("[DEBUG] " + fmt.Sprintf(format, args...))
+	l.log(newLogRecord(LogLevelDebug, fmt.Sprintf(format, args...), LogFields{}))
 }
 
 func (l *mainLogger) Info(format string, args ...interface{}) {
 	if l.level < LogLevelInfo {
 		return
 	}
-	l.log("[INFO] " + fmt.Sprintf(format, args...))
+	l.log(newLogRecord(LogLevelInfo, fmt.Sprintf(format, args...), LogFields{}))
 }
 
 func (l *mainLogger) Warn(format string, args ...interface{}) {
 	if l.level < LogLevelWarn {
 		return
 	}
-	l.log("[WARN] " + fmt.Sprintf(format, args...))
+	l.log(newLogRecord(LogLevelWarn, fmt.Sprintf(format, args...), LogFields{}))
 }
 
 func (l *mainLogger) Error(format string, args ...interface{}) {
 	if l.level < LogLevelError {
 		return
 	}
-	l.log("[ERROR] " + fmt.Sprintf(format, args...))
+	l.log(newLogRecord(LogLevelError, fmt.Sprintf(format, args...), LogFields{}))
 }
 
-func (l *mainLogger) log(msg string) {
-	if msg == "" {
+func (l *mainLogger) log(record *logRecord) {
+	if record.Msg == "" {
 		return
 	}
 	l.logMu.Lock()
 	defer l.logMu.Unlock()
-	maskedMsg := l.mask(msg)
-	fmt.Fprintln(l.out, maskedMsg)
-	fmt.Fprintln(l.buf, maskedMsg)
+	l.writeTo(l.out, record)
+}
+
+// writeTo writes record to out and log buffer. This must be called with logMu held.
+func (l *mainLogger) writeTo(out io.Writer, record *logRecord) {
+	line := l.encode(record, record.text())
+	fmt.Fprintln(out, line)
+	fmt.Fprintln(l.buf, line)
+}
+
+// writeStream writes record of the group to the output only.
+func (l *mainLogger) writeStream(record *logRecord) {
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+	fmt.Fprintln(l.out, l.encode(record, record.streamText()))
 }
 
-func (l *mainLogger) mask(msg string) string {
-	l.maskMu.RLock()
-	defer l.maskMu.RUnlock()
-	maskedMsg := msg
-	for _, m := range l.masks {
-		genMaskText := strings.Repeat("*", len(m))
-		maskedMsg = strings.Replace(maskedMsg, m, genMaskText, -1)
+func (l *mainLogger) encode(record *logRecord, text string) string {
+	if l.format != LogFormatTypeJSON {
+		return l.Mask(text)
+	}
+	masked := *record
+	masked.Msg = l.Mask(record.Msg)
+	b, err := json.Marshal(&masked)
+	if err != nil {
+		// encoding logRecord never fails, but fallback to text format just in case.
+		return masked.text()
 	}
-	return maskedMsg
+	return string(b)
 }
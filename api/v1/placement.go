@@ -0,0 +1,137 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"fmt"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultPlacementMaxSkew = 1
+	// preferredAntiAffinityWeight the weight of the preferred anti-affinity in the range 1-100.
+	preferredAntiAffinityWeight = 100
+)
+
+// podPlacement places the pod that runs the strategy keys.
+type podPlacement struct {
+	spread       *PlacementSpread
+	nodeSelector *KeyNodeSelector
+}
+
+// placementKeyGroup the keys placed on the same nodes.
+// The keys of the different groups aren't scheduled on the same pod.
+type placementKeyGroup struct {
+	keys      []string
+	placement *podPlacement
+}
+
+// placementKeyGroups groups the keys by the node selector that matches them.
+// The keys that aren't pinned come first, and the pinned keys follow in order of the node selectors.
+func placementKeyGroups(placement *Placement, keys []string) ([]*placementKeyGroup, error) {
+	if placement == nil {
+		return []*placementKeyGroup{{keys: keys}}, nil
+	}
+	patterns := make([]*regexp.Regexp, 0, len(placement.NodeSelectors))
+	for _, selector := range placement.NodeSelectors {
+		pattern, err := regexp.Compile(selector.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to compile pattern of node selector %q: %w", selector.Pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	groups := make([]*placementKeyGroup, len(patterns)+1)
+	groups[0] = &placementKeyGroup{placement: &podPlacement{spread: placement.Spread}}
+	for idx := range placement.NodeSelectors {
+		groups[idx+1] = &placementKeyGroup{
+			placement: &podPlacement{spread: placement.Spread, nodeSelector: &placement.NodeSelectors[idx]},
+		}
+	}
+	for _, key := range keys {
+		group := groups[0]
+		for idx, pattern := range patterns {
+			if pattern.MatchString(key) {
+				group = groups[idx+1]
+				break
+			}
+		}
+		group.keys = append(group.keys, key)
+	}
+	filtered := []*placementKeyGroup{}
+	for _, group := range groups {
+		if len(group.keys) == 0 {
+			continue
+		}
+		filtered = append(filtered, group)
+	}
+	if len(filtered) == 0 {
+		return groups[:1], nil
+	}
+	return filtered, nil
+}
+
+// apply adds the node selector and the spreading of the pods of the run to the pod spec.
+func (p *podPlacement) apply(spec *corev1.PodSpec, runID string) {
+	if p == nil {
+		return
+	}
+	if p.nodeSelector != nil {
+		nodeSelector := map[string]string{}
+		for k, v := range spec.NodeSelector {
+			nodeSelector[k] = v
+		}
+		for k, v := range p.nodeSelector.NodeSelector {
+			nodeSelector[k] = v
+		}
+		spec.NodeSelector = nodeSelector
+		spec.Tolerations = append(spec.Tolerations, p.nodeSelector.Tolerations...)
+	}
+	if p.spread == nil {
+		return
+	}
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{runLabel: runID}}
+	topologyKey := p.spread.TopologyKey
+	if topologyKey == "" {
+		topologyKey = corev1.LabelHostname
+	}
+	switch p.spread.Type {
+	case PlacementSpreadTypeAntiAffinity:
+		if spec.Affinity == nil {
+			spec.Affinity = &corev1.Affinity{}
+		}
+		if spec.Affinity.PodAntiAffinity == nil {
+			spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		antiAffinity := spec.Affinity.PodAntiAffinity
+		term := corev1.PodAffinityTerm{LabelSelector: selector, TopologyKey: topologyKey}
+		if p.spread.Required {
+			antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+				antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term,
+			)
+		} else {
+			antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+				corev1.WeightedPodAffinityTerm{Weight: preferredAntiAffinityWeight, PodAffinityTerm: term},
+			)
+		}
+	default:
+		maxSkew := p.spread.MaxSkew
+		if maxSkew == 0 {
+			maxSkew = defaultPlacementMaxSkew
+		}
+		whenUnsatisfiable := corev1.ScheduleAnyway
+		if p.spread.Required {
+			whenUnsatisfiable = corev1.DoNotSchedule
+		}
+		spec.TopologySpreadConstraints = append(spec.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           maxSkew,
+			TopologyKey:       topologyKey,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     selector,
+		})
+	}
+}
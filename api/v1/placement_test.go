@@ -0,0 +1,187 @@
+package v1
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestPlacement(t *testing.T) {
+	t.Run("group keys by node selector", func(t *testing.T) {
+		groups, err := placementKeyGroups(&Placement{
+			NodeSelectors: []KeyNodeSelector{
+				{Pattern: "^integration/", NodeSelector: map[string]string{"pool": "heavy"}},
+				{Pattern: "^e2e/", NodeSelector: map[string]string{"pool": "e2e"}},
+			},
+		}, []string{"unit/a", "integration/b", "unit/c", "integration/d"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 2 {
+			t.Fatalf("expected 2 groups but got %d", len(groups))
+		}
+		if strings.Join(groups[0].keys, ",") != "unit/a,unit/c" || groups[0].placement.nodeSelector != nil {
+			t.Fatalf("unexpected unpinned group: %v", groups[0].keys)
+		}
+		if strings.Join(groups[1].keys, ",") != "integration/b,integration/d" || groups[1].placement.nodeSelector.NodeSelector["pool"] != "heavy" {
+			t.Fatalf("unexpected pinned group: %v", groups[1].keys)
+		}
+	})
+	t.Run("distribute pods to groups", func(t *testing.T) {
+		newGroups := func(keyNums ...int) []*placementKeyGroup {
+			groups := []*placementKeyGroup{}
+			for _, num := range keyNums {
+				groups = append(groups, &placementKeyGroup{keys: make([]string, num)})
+			}
+			return groups
+		}
+		for _, test := range []struct {
+			maxPodNum int
+			keyNums   []int
+			expected  []int
+		}{
+			{maxPodNum: 4, keyNums: []int{10}, expected: []int{4}},
+			{maxPodNum: 4, keyNums: []int{6, 2}, expected: []int{3, 1}},
+			{maxPodNum: 3, keyNums: []int{98, 1, 1}, expected: []int{1, 1, 1}},
+			{maxPodNum: 5, keyNums: []int{5, 3, 2}, expected: []int{2, 2, 1}},
+		} {
+			nums, err := groupPodNums(test.maxPodNum, newGroups(test.keyNums...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			total := 0
+			for idx, num := range nums {
+				if num != test.expected[idx] {
+					t.Fatalf("expected %v pods for %v keys but got %v", test.expected, test.keyNums, nums)
+				}
+				total += num
+			}
+			if total > test.maxPodNum {
+				t.Fatalf("total number of pods %d exceeds maxPodNum %d", total, test.maxPodNum)
+			}
+		}
+		if _, err := groupPodNums(2, newGroups(1, 1, 1)); err == nil {
+			t.Fatal("expected error for more groups than maxPodNum")
+		}
+	})
+	t.Run("topologySpread", func(t *testing.T) {
+		spec := corev1.PodSpec{}
+		(&podPlacement{spread: &PlacementSpread{}}).apply(&spec, "run")
+		if len(spec.TopologySpreadConstraints) != 1 {
+			t.Fatalf("expected a topology spread constraint but got %d", len(spec.TopologySpreadConstraints))
+		}
+		constraint := spec.TopologySpreadConstraints[0]
+		if constraint.TopologyKey != corev1.LabelHostname || constraint.MaxSkew != 1 || constraint.WhenUnsatisfiable != corev1.ScheduleAnyway {
+			t.Fatalf("unexpected topology spread constraint: %+v", constraint)
+		}
+		if constraint.LabelSelector.MatchLabels[runLabel] != "run" {
+			t.Fatalf("pods must be selected by the run label: %v", constraint.LabelSelector.MatchLabels)
+		}
+	})
+	t.Run("antiAffinity", func(t *testing.T) {
+		spec := corev1.PodSpec{}
+		(&podPlacement{spread: &PlacementSpread{
+			Type:        PlacementSpreadTypeAntiAffinity,
+			TopologyKey: corev1.LabelTopologyZone,
+			Required:    true,
+		}}).apply(&spec, "run")
+		terms := spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		if len(terms) != 1 {
+			t.Fatalf("expected a required anti-affinity term but got %d", len(terms))
+		}
+		if terms[0].TopologyKey != corev1.LabelTopologyZone || terms[0].LabelSelector.MatchLabels[runLabel] != "run" {
+			t.Fatalf("unexpected anti-affinity term: %+v", terms[0])
+		}
+	})
+}
+
+func TestSchedulePlacement(t *testing.T) {
+	ctx := WithLogger(context.Background(), NewLogger(io.Discard, LogLevelInfo))
+	testjob := TestJob{
+		ObjectMeta: testjobObjectMeta(),
+		Spec: TestJobSpec{
+			MainStep: MainStep{
+				Strategy: &Strategy{
+					Key: StrategyKeySpec{
+						Env: "TEST",
+						Source: StrategyKeySource{
+							Static: []string{"unit/a", "integration/b", "unit/c", "integration/d", "unit/e"},
+						},
+					},
+					Scheduler: Scheduler{
+						MaxContainersPerPod:    2,
+						MaxConcurrentNumPerPod: 2,
+					},
+					Placement: &Placement{
+						Spread: &PlacementSpread{},
+						NodeSelectors: []KeyNodeSelector{
+							{
+								Pattern:      "^integration/",
+								NodeSelector: map[string]string{"pool": "heavy"},
+								Tolerations: []corev1.Toleration{
+									{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "heavy", Effect: corev1.TaintEffectNoSchedule},
+								},
+							},
+						},
+					},
+				},
+				Template: TestJobTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"},
+					Main:       "test",
+					Spec: TestJobPodSpec{
+						Containers: []TestJobContainer{
+							{Container: corev1.Container{Name: "test", Image: "alpine", Command: []string{"echo"}}},
+						},
+					},
+				},
+			},
+		},
+	}
+	clientset, err := kubernetes.NewForConfig(getConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resourceMgr := NewResourceManager(clientset, testjob)
+	builder := NewTaskBuilder(getConfig(), resourceMgr, "default", RunModeDryRun)
+	taskGroup, err := NewTaskScheduler(testjob.Spec.MainStep).Schedule(ctx, builder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unit keys are scheduled on 2 pods and integration keys are scheduled on a pod.
+	if len(taskGroup.tasks) != 3 {
+		t.Fatalf("expected 3 pods but got %d", len(taskGroup.tasks))
+	}
+	containerNames := map[string]struct{}{}
+	for _, task := range taskGroup.tasks {
+		template := task.job.Spec().Template
+		if template.Labels[runLabel] != resourceMgr.RunID() {
+			t.Fatalf("pod must have the run label: %v", template.Labels)
+		}
+		if len(template.Spec.TopologySpreadConstraints) != 1 {
+			t.Fatalf("pod must be spread across the nodes")
+		}
+		pinned := strings.HasPrefix(task.strategyKey.Keys[0], "integration/")
+		for _, key := range task.strategyKey.Keys {
+			if strings.HasPrefix(key, "integration/") != pinned {
+				t.Fatalf("pinned keys must not be mixed with the other keys: %v", task.strategyKey.Keys)
+			}
+		}
+		if pinned && (template.Spec.NodeSelector["pool"] != "heavy" || len(template.Spec.Tolerations) != 1) {
+			t.Fatalf("pinned pod must have the node selector and the tolerations: %+v", template.Spec)
+		}
+		if !pinned && len(template.Spec.NodeSelector) != 0 {
+			t.Fatalf("unexpected node selector: %v", template.Spec.NodeSelector)
+		}
+		for _, container := range template.Spec.Containers {
+			if _, exists := containerNames[container.Name]; exists {
+				t.Fatalf("container name %s is duplicated", container.Name)
+			}
+			containerNames[container.Name] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultPreInitParallelism  = 4
+	defaultPreInitCopyTimeout  = 10 * time.Minute
+	defaultPreInitRetryLimit   = 3
+	defaultPreInitRetryBackoff = time.Second
+	maxPreInitRetryBackoff     = 30 * time.Second
+)
+
+type preInitCopyType string
+
+const (
+	preInitCopyTypeRepo     preInitCopyType = "repo"
+	preInitCopyTypeToken    preInitCopyType = "token"
+	preInitCopyTypeArtifact preInitCopyType = "artifact"
+	preInitCopyTypeLog      preInitCopyType = "log"
+	preInitCopyTypeReport   preInitCopyType = "report"
+)
+
+type preInitCopyPath struct {
+	typ preInitCopyType
+	src string
+	dst string
+}
+
+// preInitCopier copies the local files into the pod through the preinit container.
+// The copies are executed concurrently, and the failed copy is retried with backoff.
+type preInitCopier struct {
+	parallelism  int
+	timeouts     map[preInitCopyType]time.Duration
+	retryLimit   int
+	retryBackoff time.Duration
+}
+
+func newPreInitCopier(spec PreInitSpec) (*preInitCopier, error) {
+	c := &preInitCopier{
+		parallelism:  defaultPreInitParallelism,
+		timeouts:     map[preInitCopyType]time.Duration{},
+		retryLimit:   defaultPreInitRetryLimit,
+		retryBackoff: defaultPreInitRetryBackoff,
+	}
+	if spec.Parallelism > 0 {
+		c.parallelism = int(spec.Parallelism)
+	}
+	for typ, timeout := range map[preInitCopyType]string{
+		preInitCopyTypeRepo:     spec.Timeout.Repo,
+		preInitCopyTypeToken:    spec.Timeout.Token,
+		preInitCopyTypeArtifact: spec.Timeout.Artifact,
+		preInitCopyTypeLog:      spec.Timeout.Log,
+		preInitCopyTypeReport:   spec.Timeout.Report,
+	} {
+		if timeout == "" {
+			c.timeouts[typ] = defaultPreInitCopyTimeout
+			continue
+		}
+		duration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to parse timeout of %s copy: %w", typ, err)
+		}
+		c.timeouts[typ] = duration
+	}
+	if spec.Retry.Limit != nil {
+		c.retryLimit = int(*spec.Retry.Limit)
+	}
+	if spec.Retry.Backoff != "" {
+		backoff, err := time.ParseDuration(spec.Retry.Backoff)
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to parse backoff of copy retry: %w", err)
+		}
+		c.retryBackoff = backoff
+	}
+	return c, nil
+}
+
+// copyAll copies all paths concurrently up to the parallelism.
+// If one of the copies failed, the others are canceled.
+func (c *preInitCopier) copyAll(ctx context.Context, exec JobExecutor, paths []*preInitCopyPath) error {
+	start := time.Now()
+	sizes := make([]int64, len(paths))
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(c.parallelism)
+	for idx, path := range paths {
+		idx := idx
+		path := path
+		eg.Go(func() error {
+			size, err := c.copyWithRetry(ctx, exec, path)
+			if err != nil {
+				return err
+			}
+			sizes[idx] = size
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	var totalSize int64
+	for _, size := range sizes {
+		totalSize += size
+	}
+	elapsedTime := time.Since(start)
+	LoggerFromContext(ctx).Info(
+		"preinit: copied %d paths (%s) in %s (%s)",
+		len(paths), formatBytes(totalSize), elapsedTime.Round(time.Millisecond), formatRate(totalSize, elapsedTime),
+	)
+	return nil
+}
+
+// copyWithRetry copies the path and returns the transferred bytes.
+func (c *preInitCopier) copyWithRetry(ctx context.Context, exec JobExecutor, path *preInitCopyPath) (int64, error) {
+	size, err := localSize(path.src)
+	if err != nil {
+		return 0, fmt.Errorf("kubetest: failed to get size of %s: %w", path.src, err)
+	}
+	backoff := c.retryBackoff
+	for retry := 0; ; retry++ {
+		start := time.Now()
+		err := c.copy(ctx, exec, path)
+		if err == nil {
+			elapsedTime := time.Since(start)
+			LoggerFromContext(ctx).Debug(
+				"preinit: copied %s to %s (%s) in %s (%s)",
+				path.src, path.dst, formatBytes(size), elapsedTime.Round(time.Millisecond), formatRate(size, elapsedTime),
+			)
+			return size, nil
+		}
+		if ctx.Err() != nil {
+			// the preinit is canceled, so doesn't retry.
+			return 0, err
+		}
+		if retry >= c.retryLimit {
+			return 0, fmt.Errorf("kubetest: failed to copy %s to %s after %d retries: %w", path.src, path.dst, retry, err)
+		}
+		LoggerFromContext(ctx).Warn(
+			"preinit: failed to copy %s to %s: %s. retry after %s (%d/%d)",
+			path.src, path.dst, err, backoff, retry+1, c.retryLimit,
+		)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxPreInitRetryBackoff {
+			backoff = maxPreInitRetryBackoff
+		}
+	}
+}
+
+// copy copies the path within the timeout of the type.
+func (c *preInitCopier) copy(ctx context.Context, exec JobExecutor, path *preInitCopyPath) error {
+	timeout := c.timeouts[path.typ]
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- exec.CopyTo(ctx, path.src, path.dst)
+	}()
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("kubetest: timeout %s exceeded to copy %s: %w", timeout, path.typ, ctx.Err())
+		}
+		return ctx.Err()
+	case err := <-errChan:
+		return err
+	}
+}
+
+// localSize returns the total size of regular files under path.
+func localSize(path string) (int64, error) {
+	var size int64
+	if err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
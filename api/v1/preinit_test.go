@@ -0,0 +1,167 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type copyToJobExecutor struct {
+	JobExecutor
+	copyTo func(context.Context, string, string) error
+}
+
+func (e *copyToJobExecutor) CopyTo(ctx context.Context, src, dst string) error {
+	return e.copyTo(ctx, src, dst)
+}
+
+func TestPreInitCopier(t *testing.T) {
+	ctx := WithLogger(context.Background(), NewLogger(io.Discard, LogLevelInfo))
+	src := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(src, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	int32ptr := func(v int32) *int32 { return &v }
+
+	t.Run("parallelism", func(t *testing.T) {
+		copier, err := newPreInitCopier(PreInitSpec{Parallelism: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			mu         sync.Mutex
+			running    int
+			maxRunning int
+			copied     []string
+		)
+		exec := &copyToJobExecutor{
+			copyTo: func(_ context.Context, _, dst string) error {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				running--
+				copied = append(copied, dst)
+				mu.Unlock()
+				return nil
+			},
+		}
+		paths := []*preInitCopyPath{}
+		for _, dst := range []string{"a", "b", "c", "d", "e"} {
+			paths = append(paths, &preInitCopyPath{typ: preInitCopyTypeRepo, src: src, dst: dst})
+		}
+		if err := copier.copyAll(ctx, exec, paths); err != nil {
+			t.Fatal(err)
+		}
+		if len(copied) != len(paths) {
+			t.Fatalf("failed to copy all paths: %v", copied)
+		}
+		if maxRunning != 2 {
+			t.Fatalf("expected 2 concurrent copies but got %d", maxRunning)
+		}
+	})
+	t.Run("retry", func(t *testing.T) {
+		copier, err := newPreInitCopier(PreInitSpec{
+			Retry: PreInitRetry{Limit: int32ptr(2), Backoff: "1ms"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var attempts int
+		exec := &copyToJobExecutor{
+			copyTo: func(context.Context, string, string) error {
+				attempts++
+				if attempts < 3 {
+					return errors.New("connection reset")
+				}
+				return nil
+			},
+		}
+		if err := copier.copyAll(ctx, exec, []*preInitCopyPath{
+			{typ: preInitCopyTypeArtifact, src: src, dst: "dst"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 3 {
+			t.Fatalf("expected 3 attempts but got %d", attempts)
+		}
+	})
+	t.Run("exceeds retry limit", func(t *testing.T) {
+		copier, err := newPreInitCopier(PreInitSpec{
+			Retry: PreInitRetry{Limit: int32ptr(1), Backoff: "1ms"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var attempts int
+		exec := &copyToJobExecutor{
+			copyTo: func(context.Context, string, string) error {
+				attempts++
+				return errors.New("connection reset")
+			},
+		}
+		err = copier.copyAll(ctx, exec, []*preInitCopyPath{
+			{typ: preInitCopyTypeArtifact, src: src, dst: "dst"},
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "after 1 retries") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if attempts != 2 {
+			t.Fatalf("expected 2 attempts but got %d", attempts)
+		}
+	})
+	t.Run("timeout by type", func(t *testing.T) {
+		copier, err := newPreInitCopier(PreInitSpec{
+			Timeout: PreInitTimeout{Token: "10ms"},
+			Retry:   PreInitRetry{Limit: int32ptr(0)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exec := &copyToJobExecutor{
+			copyTo: func(ctx context.Context, _, _ string) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}
+		err = copier.copyAll(ctx, exec, []*preInitCopyPath{
+			{typ: preInitCopyTypeToken, src: src, dst: "dst"},
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "timeout 10ms exceeded to copy token") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if copier.timeouts[preInitCopyTypeRepo] != defaultPreInitCopyTimeout {
+			t.Fatalf("unexpected default timeout: %s", copier.timeouts[preInitCopyTypeRepo])
+		}
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	for size, expected := range map[int64]string{
+		0:                 "0 B",
+		1023:              "1023 B",
+		1024:              "1.0 KiB",
+		1536:              "1.5 KiB",
+		500 * 1024 * 1024: "500.0 MiB",
+	} {
+		if got := formatBytes(size); got != expected {
+			t.Fatalf("expected %s but got %s", expected, got)
+		}
+	}
+}
@@ -7,24 +7,32 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
 )
 
 type RepositoryManager struct {
 	repos        []RepositorySpec
 	tokenMgr     *TokenManager
+	cache        *repositoryCache
 	clonedPaths  map[string]string
 	archivePaths map[string]string
+	reports      map[string]*ReportRepo
 }
 
 func NewRepositoryManager(repos []RepositorySpec, tokenMgr *TokenManager) *RepositoryManager {
@@ -33,9 +41,20 @@ func NewRepositoryManager(repos []RepositorySpec, tokenMgr *TokenManager) *Repos
 		tokenMgr:     tokenMgr,
 		clonedPaths:  map[string]string{},
 		archivePaths: map[string]string{},
+		reports:      map[string]*ReportRepo{},
 	}
 }
 
+// SetCacheDir sets the directory to cache repositories across runs.
+// The directory keeps a bare mirror per repository url and the archives keyed by the resolved commits.
+func (m *RepositoryManager) SetCacheDir(dir string) {
+	if dir == "" {
+		m.cache = nil
+		return
+	}
+	m.cache = &repositoryCache{dir: dir}
+}
+
 func (m *RepositoryManager) Cleanup() error {
 	errs := []string{}
 	for name, clonedPath := range m.clonedPaths {
@@ -44,6 +63,9 @@ func (m *RepositoryManager) Cleanup() error {
 		}
 	}
 	for name, archivePath := range m.archivePaths {
+		if m.isCachedArchive(archivePath) {
+			continue
+		}
 		if err := os.RemoveAll(archivePath); err != nil {
 			errs = append(errs, fmt.Sprintf("failed to remove %s repository archive directory: %s", name, err.Error()))
 		}
@@ -54,85 +76,263 @@ func (m *RepositoryManager) Cleanup() error {
 	return nil
 }
 
+func (m *RepositoryManager) isCachedArchive(archivePath string) bool {
+	if m.cache == nil {
+		return false
+	}
+	return strings.HasPrefix(archivePath, filepath.Join(m.cache.dir, repositoryCacheArchiveDirName)+string(filepath.Separator))
+}
+
 func (m *RepositoryManager) CloneAll(ctx context.Context) error {
 	for _, repo := range m.repos {
-		var repoDir string
-		if repo.Value.ClonedPath != "" {
-			dir := repo.Value.ClonedPath
-			if !existsDir(dir) {
-				if err := m.clone(ctx, dir, repo.Value); err != nil {
-					return err
-				}
-			} else {
-				LoggerFromContext(ctx).Info("reuse an already cloned directory: %s", dir)
+		if err := m.cloneRepo(ctx, repo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *RepositoryManager) cloneRepo(ctx context.Context, repo RepositorySpec) error {
+	startedAt := time.Now()
+	report := &ReportRepo{
+		Name: repo.Name,
+		URL:  repo.Value.URL,
+		Ref:  repo.Value.Branch,
+	}
+	if report.Ref == "" {
+		report.Ref = repo.Value.Rev
+	}
+	auth, err := m.auth(ctx, repo.Value)
+	if err != nil {
+		return err
+	}
+	var (
+		source            = &cloneSource{url: repo.Value.URL}
+		cachedArchivePath string
+	)
+	if m.cache != nil && repo.Value.URL != "" {
+		mirrorDir, err := m.cache.syncMirror(ctx, repo.Value, auth)
+		if err != nil {
+			return err
+		}
+		resolved, err := m.cache.resolve(ctx, mirrorDir, repo.Value)
+		if err != nil {
+			return err
+		}
+		archivePath, err := m.cache.archivePath(repo.Value, resolved)
+		if err != nil {
+			return err
+		}
+		if metadata := m.cache.loadArchiveMetadata(archivePath); metadata != nil {
+			LoggerFromContext(ctx).Info("reuse the cached archive of repository %s: %s", repo.Value.URL, archivePath)
+			m.archivePaths[repo.Name] = archivePath
+			report.ResolvedSHA = metadata.ResolvedSHA
+			report.MergeBaseSHA = metadata.MergeBaseSHA
+			report.CloneElapsedTimeSec = time.Since(startedAt).Seconds()
+			m.reports[repo.Name] = report
+			return nil
+		}
+		source = &cloneSource{url: mirrorDir, commit: resolved.commit}
+		cachedArchivePath = archivePath
+	}
+
+	var (
+		repoDir string
+		result  *checkoutResult
+	)
+	if repo.Value.ClonedPath != "" {
+		dir := repo.Value.ClonedPath
+		if !existsDir(dir) {
+			result, err = m.clone(ctx, dir, repo.Value, source, auth)
+			if err != nil {
+				return err
 			}
-			repoDir = dir
 		} else {
-			dir, err := os.MkdirTemp("", "repo")
+			LoggerFromContext(ctx).Info("reuse an already cloned directory: %s", dir)
+			result, err = m.update(ctx, dir, repo.Value, auth)
 			if err != nil {
-				return fmt.Errorf("kubetest: failed to create temporary directory for repository: %w", err)
-			}
-			if err := m.clone(ctx, dir, repo.Value); err != nil {
 				return err
 			}
-			repoDir = dir
 		}
+		repoDir = dir
+	} else {
+		dir, err := os.MkdirTemp("", "repo")
+		if err != nil {
+			return fmt.Errorf("kubetest: failed to create temporary directory for repository: %w", err)
+		}
+		result, err = m.clone(ctx, dir, repo.Value, source, auth)
+		if err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+		repoDir = dir
+	}
+	m.clonedPaths[repo.Name] = repoDir
+	resolvedSHA, err := resolveCommit(ctx, repoDir, "HEAD")
+	if err != nil {
+		return err
+	}
+	report.ResolvedSHA = resolvedSHA
+	report.MergeBaseSHA = result.mergeBaseSHA
+
+	archive := func(archivePath string) error {
+		return m.archiveRepo(repoDir, archivePath, repo.Value.SparseCheckout)
+	}
+	if cachedArchivePath != "" {
+		metadata := &repositoryArchiveMetadata{
+			ResolvedSHA:  report.ResolvedSHA,
+			MergeBaseSHA: report.MergeBaseSHA,
+		}
+		if err := m.cache.storeArchive(cachedArchivePath, metadata, archive); err != nil {
+			return err
+		}
+		m.archivePaths[repo.Name] = cachedArchivePath
+	} else {
 		repoArchiveDir, err := os.MkdirTemp("", "repo-archive")
 		if err != nil {
 			return fmt.Errorf("kubetest: failed to create temporary directory for repository archive: %w", err)
 		}
 		repoArchivePath := filepath.Join(repoArchiveDir, "repo.tar.gz")
-		if err := m.archiveRepo(repoDir, repoArchivePath); err != nil {
+		m.archivePaths[repo.Name] = repoArchivePath
+		if err := archive(repoArchivePath); err != nil {
 			return err
 		}
-		m.archivePaths[repo.Name] = repoArchivePath
-		m.clonedPaths[repo.Name] = repoDir
 	}
+	report.CloneElapsedTimeSec = time.Since(startedAt).Seconds()
+	m.reports[repo.Name] = report
 	return nil
 }
 
-func (m *RepositoryManager) clone(ctx context.Context, clonedPath string, repo Repository) error {
-	LoggerFromContext(ctx).Info("clone repository: %s", repo.URL)
+// cloneSource is the location to clone the repository from.
+type cloneSource struct {
+	// url is the url of the remote repository or the path to the cached mirror.
+	url string
+	// commit is the commit resolved by the mirror. If it isn't empty, it is checked out instead of the revision of the repository.
+	commit string
+}
 
-	const (
-		defaultBaseBranchName = "master"
-		defaultRemoteName     = "origin"
-	)
+const (
+	defaultBaseBranchName = "master"
+	defaultRemoteName     = "origin"
+)
+
+func (m *RepositoryManager) clone(ctx context.Context, clonedPath string, repo Repository, source *cloneSource, auth *repositoryAuth) (*checkoutResult, error) {
+	LoggerFromContext(ctx).Info("clone repository: %s", repo.URL)
 
 	if err := os.MkdirAll(clonedPath, 0o755); err != nil {
-		return fmt.Errorf("kubetest: failed to create directory %s for repository: %w", clonedPath, err)
+		return nil, fmt.Errorf("kubetest: failed to create directory %s for repository: %w", clonedPath, err)
 	}
-	var auth transport.AuthMethod
-	if repo.Token != "" {
-		token, err := m.tokenMgr.TokenByName(ctx, repo.Token)
-		if err != nil {
-			return err
+	sparse := len(repo.SparseCheckout) != 0
+	cloneOpt := &git.CloneOptions{
+		URL:          source.url,
+		Depth:        repo.Depth,
+		SingleBranch: repo.SingleBranch,
+		// If sparse checkout is enabled, the worktree is created after the sparse checkout setting.
+		NoCheckout: sparse,
+	}
+	if source.url == repo.URL {
+		cloneOpt.Auth = auth.method
+	}
+	if repo.SingleBranch && repo.Branch != "" {
+		cloneOpt.ReferenceName = plumbing.NewBranchReferenceName(repo.Branch)
+	}
+	gitRepo, err := git.PlainCloneContext(ctx, clonedPath, false, cloneOpt)
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to clone repository: %w", err)
+	}
+	if source.commit != "" {
+		repo.Rev = source.commit
+		repo.Branch = ""
+	}
+	return m.checkout(ctx, gitRepo, clonedPath, repo, source, auth)
+}
+
+// update fetches the latest commits to the already cloned directory and checkouts the specified branch or revision again,
+// so that the reused directory doesn't go stale.
+func (m *RepositoryManager) update(ctx context.Context, clonedPath string, repo Repository, auth *repositoryAuth) (*checkoutResult, error) {
+	gitRepo, err := git.PlainOpen(clonedPath)
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to open repository %s: %w", clonedPath, err)
+	}
+	cfg, err := gitRepo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to get repository config: %w", err)
+	}
+	fetchOpt := &git.FetchOptions{
+		RemoteName: remoteNameByConfig(cfg),
+		RemoteURL:  repo.URL,
+		Auth:       auth.method,
+		Depth:      repo.Depth,
+		Force:      true,
+	}
+	LoggerFromContext(ctx).Info("fetch repository: %s", clonedPath)
+	if err := gitRepo.FetchContext(ctx, fetchOpt); err != nil {
+		switch {
+		case errors.Is(err, git.NoErrAlreadyUpToDate):
+		case errors.Is(err, git.ErrRemoteNotFound) && repo.URL == "":
+			LoggerFromContext(ctx).Warn("skip fetching because remote isn't found: %s", clonedPath)
+		default:
+			return nil, fmt.Errorf("kubetest: failed to fetch repository: %w", err)
 		}
-		auth = &http.BasicAuth{
-			Username: "x-access-token",
-			Password: token.Value,
+	}
+	switch {
+	case repo.Branch != "":
+	case repo.Rev != "":
+		// the branch named by the revision is created by the previous checkout.
+		if err := gitRepo.Storer.RemoveReference(plumbing.NewBranchReferenceName(repo.Rev)); err != nil {
+			return nil, fmt.Errorf("kubetest: failed to remove the branch for revision: %w", err)
+		}
+	default:
+		// move the current branch to the fetched commit.
+		if err := m.fastForwardHead(gitRepo, fetchOpt.RemoteName); err != nil {
+			return nil, err
 		}
 	}
-	gitRepo, err := git.PlainCloneContext(ctx, clonedPath, false, &git.CloneOptions{
-		URL:  repo.URL,
-		Auth: auth,
-	})
+	return m.checkout(ctx, gitRepo, clonedPath, repo, &cloneSource{url: repo.URL}, auth)
+}
+
+func (m *RepositoryManager) fastForwardHead(gitRepo *git.Repository, remote string) error {
+	head, err := gitRepo.Reference(plumbing.HEAD, false)
 	if err != nil {
-		return fmt.Errorf("kubetest: failed to clone repository: %w", err)
+		return fmt.Errorf("kubetest: failed to get HEAD: %w", err)
 	}
-	cfg, err := gitRepo.Config()
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return nil
+	}
+	remoteRef, err := gitRepo.Reference(plumbing.NewRemoteReferenceName(remote, head.Target().Short()), true)
 	if err != nil {
-		return fmt.Errorf("kubetest: failed to get repository config: %w", err)
+		// the current branch doesn't track the remote branch.
+		return nil
 	}
-	var remote string
+	if err := gitRepo.Storer.SetReference(plumbing.NewHashReference(head.Target(), remoteRef.Hash())); err != nil {
+		return fmt.Errorf("kubetest: failed to update %s: %w", head.Target(), err)
+	}
+	return nil
+}
+
+func remoteNameByConfig(cfg *config.Config) string {
 	if len(cfg.Remotes) == 1 {
 		for name := range cfg.Remotes {
-			remote = name
-			break
+			return name
 		}
-	} else {
-		remote = defaultRemoteName
 	}
+	return defaultRemoteName
+}
+
+// checkoutResult the commits resolved by checkout.
+type checkoutResult struct {
+	// mergeBaseSHA is the commit hash of the merged base branch. If merge isn't specified, this is empty.
+	mergeBaseSHA string
+}
+
+// checkout checkouts the specified branch or revision and merges the base branch if needed.
+func (m *RepositoryManager) checkout(ctx context.Context, gitRepo *git.Repository, clonedPath string, repo Repository, source *cloneSource, auth *repositoryAuth) (*checkoutResult, error) {
+	cfg, err := gitRepo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to get repository config: %w", err)
+	}
+	remote := remoteNameByConfig(cfg)
+	result := &checkoutResult{}
 	var baseBranch string
 	if cfg.Init.DefaultBranch != "" {
 		baseBranch = cfg.Init.DefaultBranch
@@ -146,10 +346,14 @@ func (m *RepositoryManager) clone(ctx context.Context, clonedPath string, repo R
 	}
 	tree, err := gitRepo.Worktree()
 	if err != nil {
-		return fmt.Errorf("kubetest: failed to get worktree from repository: %w", err)
+		return nil, fmt.Errorf("kubetest: failed to get worktree from repository: %w", err)
 	}
+	sparse := len(repo.SparseCheckout) != 0
 	checkoutOpt := &git.CheckoutOptions{
-		Force: true,
+		Force: !sparse,
+		// go-git doesn't support sparse checkout setting of git,
+		// so update HEAD only and create the worktree by git client command.
+		Keep: sparse,
 	}
 	switch {
 	case repo.Branch != "":
@@ -158,61 +362,380 @@ func (m *RepositoryManager) clone(ctx context.Context, clonedPath string, repo R
 		checkoutOpt.Create = true
 		checkoutOpt.Branch = plumbing.NewBranchReferenceName(repo.Rev)
 		checkoutOpt.Hash = plumbing.NewHash(repo.Rev)
+	default:
+		// checkout the current branch ( the default branch of the remote after cloning ).
+		if head, err := gitRepo.Reference(plumbing.HEAD, false); err == nil && head.Type() == plumbing.SymbolicReference {
+			checkoutOpt.Branch = head.Target()
+		}
 	}
 	if err := checkoutOpt.Validate(); err != nil {
-		return fmt.Errorf("kubetest: invalid checkout option: %w", err)
+		return nil, fmt.Errorf("kubetest: invalid checkout option: %w", err)
 	}
 	if err := tree.Checkout(checkoutOpt); err != nil {
-		return fmt.Errorf("kubetest: failed to checkout: %w", err)
-	}
-	status, err := tree.Status()
-	if err != nil {
-		return fmt.Errorf("kubetest: failed to get repository status: %w", err)
+		return nil, fmt.Errorf("kubetest: failed to checkout: %w", err)
 	}
-	if !status.IsClean() {
-		// may be a bug of go-git
-		head, err := gitRepo.Head()
-		if err != nil {
-			return fmt.Errorf("kubetest: failed to get HEAD hash: %w", err)
+	if sparse {
+		paths := repo.SparseCheckout
+		if repo.Submodules == SubmoduleModeShallow || repo.Submodules == SubmoduleModeRecursive {
+			// .gitmodules is required to find submodules.
+			paths = append(append([]string{}, paths...), ".gitmodules")
+		}
+		if err := m.sparseCheckout(ctx, clonedPath, paths); err != nil {
+			return nil, err
 		}
-		if err := tree.Reset(&git.ResetOptions{
-			Commit: head.Hash(),
-			Mode:   git.HardReset,
-		}); err != nil {
-			return fmt.Errorf("kubetest: failed to reset repository: %w", err)
+	} else if err := m.resetIfNotClean(gitRepo, tree); err != nil {
+		return nil, err
+	}
+	createsCommit := repo.Merge != nil || len(repo.MergeRefs) != 0 || len(repo.CherryPick) != 0 || len(repo.Patches) != 0
+	if createsCommit && (cfg.User.Name == "" || cfg.User.Email == "") {
+		cfg.User.Name = "kubetest"
+		cfg.User.Email = "user@kubetest.com"
+		LoggerFromContext(ctx).Debug(
+			"set git config: user.name=%s and user.email=%s",
+			cfg.User.Name,
+			cfg.User.Email,
+		)
+		if err := gitRepo.SetConfig(cfg); err != nil {
+			return nil, fmt.Errorf("kubetest: failed to set git config: user.name and user.email: %w", err)
 		}
 	}
 	if repo.Merge != nil {
 		if repo.Merge.Base != "" {
 			baseBranch = repo.Merge.Base
 		}
-		if cfg.User.Name == "" || cfg.User.Email == "" {
-			cfg.User.Name = "kubetest"
-			cfg.User.Email = "user@kubetest.com"
-			LoggerFromContext(ctx).Debug(
-				"set git config: user.name=%s and user.email=%s",
-				cfg.User.Name,
-				cfg.User.Email,
-			)
-			if err := gitRepo.SetConfig(cfg); err != nil {
-				return fmt.Errorf("kubetest: failed to set git config: user.name and user.email: %w", err)
-			}
-		}
 		// we'd like to use '--ff' strategy ( merge's default behavior ).
 		// go-git doesn't support yet, so we use git client command.
 		LoggerFromContext(ctx).Info("merge base branch: git pull %s %s", remote, baseBranch)
 		cmd := exec.Command("git", "pull", remote, baseBranch)
 		cmd.Dir = clonedPath
+		cmd.Env = append(os.Environ(), auth.env...)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
-			return fmt.Errorf("kubetest: failed to merge base branch %s: %w", string(out), err)
+			return nil, fmt.Errorf("kubetest: failed to merge base branch %s: %w", string(out), err)
 		}
 		LoggerFromContext(ctx).Debug(string(out))
+		mergeBaseSHA, err := resolveCommit(ctx, clonedPath, "FETCH_HEAD")
+		if err != nil {
+			return nil, err
+		}
+		result.mergeBaseSHA = mergeBaseSHA
+	}
+	if err := m.mergeRefs(ctx, clonedPath, remote, repo.MergeRefs, auth); err != nil {
+		return nil, err
+	}
+	if err := m.cherryPick(ctx, clonedPath, remote, repo.CherryPick, auth); err != nil {
+		return nil, err
+	}
+	if err := m.applyPatches(ctx, clonedPath, repo.Patches); err != nil {
+		return nil, err
+	}
+	if source.url != repo.URL {
+		// cloned from the cached mirror. restore the remote url to resolve the url of submodules and Git LFS server.
+		if err := m.setRemoteURL(gitRepo, remote, repo.URL); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.updateSubmodules(ctx, tree, repo, auth); err != nil {
+		return nil, err
+	}
+	if repo.LFS {
+		if err := m.pullLFS(ctx, clonedPath, repo, auth); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// mergeRefs fetches refs ( e.g. refs/pull/123/head ) and merges them in order.
+func (m *RepositoryManager) mergeRefs(ctx context.Context, clonedPath, remote string, refs []string, auth *repositoryAuth) error {
+	for _, ref := range refs {
+		LoggerFromContext(ctx).Info("merge ref: %s", ref)
+		if _, err := runGitCommand(ctx, clonedPath, auth.env, "fetch", remote, ref); err != nil {
+			return fmt.Errorf("kubetest: failed to fetch ref %s: %w", ref, err)
+		}
+		if _, err := runGitCommand(ctx, clonedPath, nil, "merge", "--no-edit", "-m", "Merge "+ref, "FETCH_HEAD"); err != nil {
+			return fmt.Errorf("kubetest: failed to merge ref %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// cherryPick cherry-picks commits in order. If the commit doesn't exist in the cloned repository, fetch it from remote.
+func (m *RepositoryManager) cherryPick(ctx context.Context, clonedPath, remote string, commits []string, auth *repositoryAuth) error {
+	for _, commit := range commits {
+		LoggerFromContext(ctx).Info("cherry-pick: %s", commit)
+		target := commit
+		if _, err := runGitCommand(ctx, clonedPath, nil, "cat-file", "-e", commit+"^{commit}"); err != nil {
+			if _, err := runGitCommand(ctx, clonedPath, auth.env, "fetch", remote, commit); err != nil {
+				return fmt.Errorf("kubetest: failed to fetch commit %s to cherry-pick: %w", commit, err)
+			}
+			target = "FETCH_HEAD"
+		}
+		if _, err := runGitCommand(ctx, clonedPath, nil, "cherry-pick", target); err != nil {
+			return fmt.Errorf("kubetest: failed to cherry-pick %s: %w", commit, err)
+		}
 	}
 	return nil
 }
 
-func (m *RepositoryManager) archiveRepo(repoDir, archivePath string) error {
+// applyPatches applies the patch files in order and commits each patch.
+func (m *RepositoryManager) applyPatches(ctx context.Context, clonedPath string, patches []string) error {
+	for _, patch := range patches {
+		LoggerFromContext(ctx).Info("apply patch: %s", patch)
+		path, err := filepath.Abs(patch)
+		if err != nil {
+			return fmt.Errorf("kubetest: failed to get absolute path of patch %s: %w", patch, err)
+		}
+		if _, err := runGitCommand(ctx, clonedPath, nil, "apply", "--index", path); err != nil {
+			return fmt.Errorf("kubetest: failed to apply patch %s: %w", patch, err)
+		}
+		if _, err := runGitCommand(ctx, clonedPath, nil, "commit", "--no-verify", "-m", "Apply "+filepath.Base(patch)); err != nil {
+			return fmt.Errorf("kubetest: failed to commit patch %s: %w", patch, err)
+		}
+	}
+	return nil
+}
+
+func (m *RepositoryManager) setRemoteURL(gitRepo *git.Repository, remote, url string) error {
+	cfg, err := gitRepo.Config()
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to get repository config: %w", err)
+	}
+	remoteCfg, exists := cfg.Remotes[remote]
+	if !exists {
+		return fmt.Errorf("kubetest: failed to find remote %s", remote)
+	}
+	remoteCfg.URLs = []string{url}
+	if err := gitRepo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("kubetest: failed to set remote url: %w", err)
+	}
+	return nil
+}
+
+func (m *RepositoryManager) updateSubmodules(ctx context.Context, tree *git.Worktree, repo Repository, auth *repositoryAuth) error {
+	opt := &git.SubmoduleUpdateOptions{
+		Init: true,
+		Auth: auth.method,
+	}
+	switch repo.Submodules {
+	case SubmoduleModeShallow:
+		opt.Depth = 1
+	case SubmoduleModeRecursive:
+		opt.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+	default:
+		return nil
+	}
+	submodules, err := tree.Submodules()
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to get submodules: %w", err)
+	}
+	for _, submodule := range submodules {
+		path := submodule.Config().Path
+		if !isArchiveTarget(path, true, repo.SparseCheckout) {
+			continue
+		}
+		LoggerFromContext(ctx).Info("update submodule: %s", path)
+		if err := submodule.UpdateContext(ctx, opt); err != nil {
+			return fmt.Errorf("kubetest: failed to update submodule %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// pullLFS fetches Git LFS objects by git-lfs command because go-git doesn't support Git LFS.
+func (m *RepositoryManager) pullLFS(ctx context.Context, clonedPath string, repo Repository, auth *repositoryAuth) error {
+	lfsArgs := []string{"lfs", "pull"}
+	if len(repo.SparseCheckout) != 0 {
+		paths := make([]string, 0, len(repo.SparseCheckout))
+		for _, path := range repo.SparseCheckout {
+			path = normalizeSparseCheckoutPath(path)
+			paths = append(paths, path, path+"/**")
+		}
+		lfsArgs = append(lfsArgs, "--include", strings.Join(paths, ","))
+	}
+	cmds := [][]string{
+		{"lfs", "install", "--local"},
+		lfsArgs,
+	}
+	switch repo.Submodules {
+	case SubmoduleModeShallow:
+		cmds = append(cmds, append([]string{"submodule", "foreach", "git"}, lfsArgs...))
+	case SubmoduleModeRecursive:
+		cmds = append(cmds, append([]string{"submodule", "foreach", "--recursive", "git"}, lfsArgs...))
+	}
+	for _, args := range cmds {
+		LoggerFromContext(ctx).Info("fetch lfs objects: git %s", strings.Join(args, " "))
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = clonedPath
+		cmd.Env = append(os.Environ(), auth.env...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("kubetest: failed to fetch lfs objects %s: %w", string(out), err)
+		}
+		LoggerFromContext(ctx).Debug(string(out))
+	}
+	return nil
+}
+
+// repositoryAuth is the credential to access the repository.
+type repositoryAuth struct {
+	// method is used by go-git.
+	method transport.AuthMethod
+	// env is the environment variables to pass the credential to git command ( and git-lfs ) without writing it to the config file.
+	env []string
+}
+
+func (m *RepositoryManager) auth(ctx context.Context, repo Repository) (*repositoryAuth, error) {
+	if repo.Token == "" {
+		return &repositoryAuth{}, nil
+	}
+	sshKey, err := m.tokenMgr.SSHKeyByName(ctx, repo.Token)
+	if err != nil {
+		return nil, err
+	}
+	if sshKey != nil {
+		return newSSHRepositoryAuth(repo.URL, sshKey)
+	}
+	token, err := m.tokenMgr.TokenByName(ctx, repo.Token)
+	if err != nil {
+		return nil, err
+	}
+	username := token.Username
+	if username == "" {
+		username = "x-access-token"
+	}
+	basicAuth := &http.BasicAuth{
+		Username: username,
+		Password: token.Value,
+	}
+	credential := base64.StdEncoding.EncodeToString([]byte(basicAuth.Username + ":" + basicAuth.Password))
+	return &repositoryAuth{
+		method: basicAuth,
+		env: []string{
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic " + credential,
+		},
+	}, nil
+}
+
+const defaultSSHUser = "git"
+
+// newSSHRepositoryAuth creates the credential by SSH key.
+// The user name is taken from the URL ( e.g. git@github.com:goccy/kubetest.git ).
+func newSSHRepositoryAuth(url string, key *SSHKey) (*repositoryAuth, error) {
+	user := defaultSSHUser
+	if endpoint, err := transport.NewEndpoint(url); err == nil && endpoint.User != "" {
+		user = endpoint.User
+	}
+	publicKeys, err := gitssh.NewPublicKeys(user, key.PrivateKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to load ssh private key: %w", err)
+	}
+	sshCommand := []string{"ssh", "-i", key.PrivateKeyFile, "-o", "IdentitiesOnly=yes"}
+	switch {
+	case key.InsecureIgnoreHostKey:
+		publicKeys.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		sshCommand = append(sshCommand, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	case key.KnownHostsFile != "":
+		callback, err := gitssh.NewKnownHostsCallback(key.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to load known_hosts: %w", err)
+		}
+		publicKeys.HostKeyCallback = callback
+		sshCommand = append(sshCommand, "-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile="+key.KnownHostsFile)
+	default:
+		callback, err := gitssh.NewKnownHostsCallback()
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to load default known_hosts: %w", err)
+		}
+		publicKeys.HostKeyCallback = callback
+		sshCommand = append(sshCommand, "-o", "StrictHostKeyChecking=yes")
+	}
+	return &repositoryAuth{
+		method: publicKeys,
+		env:    []string{"GIT_SSH_COMMAND=" + strings.Join(sshCommand, " ")},
+	}, nil
+}
+
+func (m *RepositoryManager) resetIfNotClean(gitRepo *git.Repository, tree *git.Worktree) error {
+	status, err := tree.Status()
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to get repository status: %w", err)
+	}
+	if status.IsClean() {
+		return nil
+	}
+	// may be a bug of go-git
+	head, err := gitRepo.Head()
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to get HEAD hash: %w", err)
+	}
+	if err := tree.Reset(&git.ResetOptions{
+		Commit: head.Hash(),
+		Mode:   git.HardReset,
+	}); err != nil {
+		return fmt.Errorf("kubetest: failed to reset repository: %w", err)
+	}
+	return nil
+}
+
+// sparseCheckout creates the worktree that contains the specified paths only from HEAD.
+// 'git sparse-checkout' command writes the setting to the worktree config, but it is ignored for the repository created by go-git
+// ( go-git doesn't set core.repositoryformatversion=1 ). So write the setting to the repository config and sparse-checkout file directly.
+func (m *RepositoryManager) sparseCheckout(ctx context.Context, clonedPath string, paths []string) error {
+	patterns := make([]string, 0, len(paths))
+	for _, path := range paths {
+		patterns = append(patterns, "/"+normalizeSparseCheckoutPath(path))
+	}
+	infoDir := filepath.Join(clonedPath, ".git", "info")
+	if err := os.MkdirAll(infoDir, 0o755); err != nil {
+		return fmt.Errorf("kubetest: failed to create directory for sparse checkout setting: %w", err)
+	}
+	sparseCheckoutFile := filepath.Join(infoDir, "sparse-checkout")
+	if err := os.WriteFile(sparseCheckoutFile, []byte(strings.Join(patterns, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("kubetest: failed to write sparse checkout setting: %w", err)
+	}
+	for _, args := range [][]string{
+		{"config", "core.sparseCheckout", "true"},
+		{"read-tree", "-mu", "HEAD"},
+	} {
+		LoggerFromContext(ctx).Debug("sparse checkout: git %s", strings.Join(args, " "))
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = clonedPath
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("kubetest: failed to sparse checkout %s: %w", string(out), err)
+		}
+	}
+	return nil
+}
+
+func normalizeSparseCheckoutPath(path string) string {
+	return strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/")
+}
+
+// isArchiveTarget returns whether the file ( or directory ) of name should be archived.
+// If paths is empty, all files are archived.
+func isArchiveTarget(name string, isDir bool, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	name = filepath.ToSlash(name)
+	for _, path := range paths {
+		path = normalizeSparseCheckoutPath(path)
+		if name == path || strings.HasPrefix(name, path+"/") {
+			return true
+		}
+		if isDir && strings.HasPrefix(path, name+"/") {
+			// parent directory of the target path.
+			return true
+		}
+	}
+	return false
+}
+
+func (m *RepositoryManager) archiveRepo(repoDir, archivePath string, paths []string) error {
 	dst, err := os.Create(archivePath)
 	if err != nil {
 		return fmt.Errorf("kubetest: failed to create archive file for repository: %w", err)
@@ -232,10 +755,19 @@ func (m *RepositoryManager) archiveRepo(repoDir, archivePath string) error {
 		if err != nil {
 			return fmt.Errorf("kubetest: failed to create archive file for repository: %w", err)
 		}
-		if info.IsDir() {
+		if path == repoDir {
 			return nil
 		}
 		name := path[len(repoDir)+1:]
+		if !isArchiveTarget(name, info.IsDir(), paths) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
 		switch {
 		case info.Mode()&os.ModeSymlink == os.ModeSymlink:
 			linkName, err := os.Readlink(path)
@@ -273,6 +805,19 @@ func (m *RepositoryManager) archiveRepo(repoDir, archivePath string) error {
 	})
 }
 
+// Reports returns the url, the requested ref and the resolved commits of each repository.
+func (m *RepositoryManager) Reports() []*ReportRepo {
+	reports := make([]*ReportRepo, 0, len(m.repos))
+	for _, repo := range m.repos {
+		report, exists := m.reports[repo.Name]
+		if !exists {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
 func (m *RepositoryManager) ArchivePathByRepoName(name string) (string, error) {
 	path, exists := m.archivePaths[name]
 	if !exists {
@@ -0,0 +1,243 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// repositoryCache is the persistent cache of repositories shared across runs.
+// It keeps a bare mirror per repository url and fetches it incrementally,
+// and keeps the archive of the repository keyed by the resolved commit and the commit of the merge base.
+type repositoryCache struct {
+	dir string
+}
+
+const (
+	repositoryCacheMirrorDirName  = "mirrors"
+	repositoryCacheArchiveDirName = "archives"
+)
+
+// resolvedRepository is the commits resolved by the mirror.
+type resolvedRepository struct {
+	// commit is the commit hash of the specified branch or revision.
+	commit string
+	// mergeBaseCommit is the commit hash of the base branch to merge. If merge isn't specified, this is empty.
+	mergeBaseCommit string
+	// mergeRefCommits is the commit hashes of the refs to merge.
+	mergeRefCommits []string
+	// cherryPickCommits is the commit hashes to cherry-pick.
+	cherryPickCommits []string
+	// patchHashes is the hashes of the content of the patch files.
+	patchHashes []string
+}
+
+// repositoryArchiveMetadata is stored with the cached archive.
+type repositoryArchiveMetadata struct {
+	// ResolvedSHA is the commit hash of HEAD of the archived repository.
+	ResolvedSHA string `json:"resolvedSHA"`
+	// MergeBaseSHA is the commit hash of the merged base branch.
+	MergeBaseSHA string `json:"mergeBaseSHA,omitempty"`
+}
+
+// syncMirror creates the bare mirror of the repository, or fetches the latest refs to the already created mirror.
+// It returns the path to the mirror.
+func (c *repositoryCache) syncMirror(ctx context.Context, repo Repository, auth *repositoryAuth) (string, error) {
+	mirrorDir := filepath.Join(c.dir, repositoryCacheMirrorDirName, hashText(repo.URL))
+	if existsDir(mirrorDir) {
+		LoggerFromContext(ctx).Info("fetch repository to the cached mirror: %s", repo.URL)
+		if _, err := runGitCommand(ctx, mirrorDir, auth.env, "fetch", "--prune", "origin"); err != nil {
+			return "", fmt.Errorf("kubetest: failed to fetch repository to mirror %s: %w", mirrorDir, err)
+		}
+		return mirrorDir, nil
+	}
+	LoggerFromContext(ctx).Info("create the mirror of repository: %s", repo.URL)
+	if err := os.MkdirAll(filepath.Dir(mirrorDir), 0o755); err != nil {
+		return "", fmt.Errorf("kubetest: failed to create directory for repository mirror: %w", err)
+	}
+	// clone to the temporary directory and rename it to avoid leaving the incomplete mirror when the clone fails.
+	tmpDir, err := os.MkdirTemp(filepath.Dir(mirrorDir), "tmp")
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to create temporary directory for repository mirror: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if _, err := runGitCommand(ctx, tmpDir, auth.env, "clone", "--mirror", repo.URL, "."); err != nil {
+		return "", fmt.Errorf("kubetest: failed to create the mirror of repository: %w", err)
+	}
+	if err := os.Rename(tmpDir, mirrorDir); err != nil {
+		if existsDir(mirrorDir) {
+			// created by the other process at the same time.
+			return mirrorDir, nil
+		}
+		return "", fmt.Errorf("kubetest: failed to rename repository mirror: %w", err)
+	}
+	return mirrorDir, nil
+}
+
+// resolve resolves the commits that the repository uses from the mirror.
+func (c *repositoryCache) resolve(ctx context.Context, mirrorDir string, repo Repository) (*resolvedRepository, error) {
+	ref := "HEAD"
+	switch {
+	case repo.Branch != "":
+		ref = "refs/heads/" + repo.Branch
+	case repo.Rev != "":
+		ref = repo.Rev
+	}
+	commit, err := resolveCommit(ctx, mirrorDir, ref)
+	if err != nil {
+		return nil, err
+	}
+	resolved := &resolvedRepository{commit: commit}
+	if repo.Merge != nil {
+		// the default base branch is the default branch of the remote ( HEAD of the mirror ).
+		baseRef := "HEAD"
+		if repo.Merge.Base != "" {
+			baseRef = "refs/heads/" + repo.Merge.Base
+		}
+		mergeBaseCommit, err := resolveCommit(ctx, mirrorDir, baseRef)
+		if err != nil {
+			return nil, err
+		}
+		resolved.mergeBaseCommit = mergeBaseCommit
+	}
+	for _, ref := range repo.MergeRefs {
+		commit, err := resolveCommit(ctx, mirrorDir, ref)
+		if err != nil {
+			return nil, err
+		}
+		resolved.mergeRefCommits = append(resolved.mergeRefCommits, commit)
+	}
+	for _, commit := range repo.CherryPick {
+		resolvedCommit, err := resolveCommit(ctx, mirrorDir, commit)
+		if err != nil {
+			return nil, err
+		}
+		resolved.cherryPickCommits = append(resolved.cherryPickCommits, resolvedCommit)
+	}
+	for _, patch := range repo.Patches {
+		content, err := os.ReadFile(patch)
+		if err != nil {
+			return nil, fmt.Errorf("kubetest: failed to read patch file %s: %w", patch, err)
+		}
+		resolved.patchHashes = append(resolved.patchHashes, hashText(string(content)))
+	}
+	return resolved, nil
+}
+
+func resolveCommit(ctx context.Context, repoDir, ref string) (string, error) {
+	out, err := runGitCommand(ctx, repoDir, nil, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to resolve %s: %w", ref, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// archivePath returns the path to the cached archive for the resolved repository.
+// The key contains all parameters that change the content of the archive.
+func (c *repositoryCache) archivePath(repo Repository, resolved *resolvedRepository) (string, error) {
+	key, err := json.Marshal(struct {
+		URL               string
+		Commit            string
+		MergeBaseCommit   string
+		MergeRefCommits   []string
+		CherryPickCommits []string
+		PatchHashes       []string
+		Depth             int
+		SingleBranch      bool
+		SparseCheckout    []string
+		Submodules        SubmoduleMode
+		LFS               bool
+	}{
+		URL:               repo.URL,
+		Commit:            resolved.commit,
+		MergeBaseCommit:   resolved.mergeBaseCommit,
+		MergeRefCommits:   resolved.mergeRefCommits,
+		CherryPickCommits: resolved.cherryPickCommits,
+		PatchHashes:       resolved.patchHashes,
+		Depth:             repo.Depth,
+		SingleBranch:      repo.SingleBranch,
+		SparseCheckout:    repo.SparseCheckout,
+		Submodules:        repo.Submodules,
+		LFS:               repo.LFS,
+	})
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to create cache key of repository archive: %w", err)
+	}
+	return filepath.Join(c.dir, repositoryCacheArchiveDirName, hashText(string(key))+".tar.gz"), nil
+}
+
+func archiveMetadataPath(archivePath string) string {
+	return strings.TrimSuffix(archivePath, ".tar.gz") + ".json"
+}
+
+// loadArchiveMetadata returns the metadata of the cached archive. If the archive isn't cached, returns nil.
+func (c *repositoryCache) loadArchiveMetadata(archivePath string) *repositoryArchiveMetadata {
+	if !existsFile(archivePath) {
+		return nil
+	}
+	b, err := os.ReadFile(archiveMetadataPath(archivePath))
+	if err != nil {
+		return nil
+	}
+	var metadata repositoryArchiveMetadata
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return nil
+	}
+	return &metadata
+}
+
+// storeArchive stores the archive created by archive func to archivePath with the metadata.
+// The archive is created at the temporary path and renamed after the metadata is stored,
+// so the other process never reads the incomplete archive.
+func (c *repositoryCache) storeArchive(archivePath string, metadata *repositoryArchiveMetadata, archive func(string) error) error {
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0o755); err != nil {
+		return fmt.Errorf("kubetest: failed to create directory for repository archive cache: %w", err)
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to encode repository archive metadata: %w", err)
+	}
+	if err := os.WriteFile(archiveMetadataPath(archivePath), b, 0o644); err != nil {
+		return fmt.Errorf("kubetest: failed to write repository archive metadata: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(archivePath), "tmp")
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to create temporary file for repository archive cache: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+	defer os.Remove(tmpPath)
+	if err := archive(tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		return fmt.Errorf("kubetest: failed to store repository archive cache: %w", err)
+	}
+	return nil
+}
+
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func runGitCommand(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	LoggerFromContext(ctx).Debug("git %s", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", string(out), err)
+	}
+	return string(out), nil
+}
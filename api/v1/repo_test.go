@@ -1,13 +1,21 @@
 package v1
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/go-git/go-billy/v5"
@@ -15,8 +23,11 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/sosedoff/gitkit"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func TestRepositoryManager(t *testing.T) {
@@ -231,9 +242,361 @@ func TestRepositoryManager(t *testing.T) {
 		}
 		assertFile(t, w.Filesystem, ".gitignore", "*.txt\n!test.txt")
 		assertFile(t, w.Filesystem, "test.txt", "test")
+		reports := mgr.Reports()
+		if len(reports) != 1 {
+			t.Fatalf("failed to get repository report: %+v", reports)
+		}
+		if reports[0].Ref != commit2.String() || reports[0].MergeBaseSHA != commit1.String() {
+			t.Fatalf("unexpected repository report: %+v", reports[0])
+		}
+	})
+	t.Run("shallow and sparse clone", func(t *testing.T) {
+		addr, reposDir := runGitServer(t)
+
+		repoName := "test"
+		fs := osfs.New(filepath.Join(reposDir, repoName))
+		storage := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+		repo, err := git.Init(storage, fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := repo.Worktree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for idx, path := range []string{"a/a.txt", "b/b.txt", "c.txt"} {
+			if err := fs.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			f, err := fs.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write([]byte(path)); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			if _, err := w.Add(path); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Commit(fmt.Sprintf("commit%d", idx), &git.CommitOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		repoDir := filepath.Join(t.TempDir(), repoName)
+		spec := RepositorySpec{
+			Name: repoName,
+			Value: Repository{
+				URL:            fmt.Sprintf("http://%s/%s", addr, repoName),
+				Branch:         "master",
+				Depth:          1,
+				SingleBranch:   true,
+				SparseCheckout: []string{"a", "c.txt"},
+				ClonedPath:     repoDir,
+			},
+		}
+		if err := NewValidator().ValidateRepositorySpec(spec); err != nil {
+			t.Fatal(err)
+		}
+		withRev := spec
+		withRev.Value.Branch = ""
+		withRev.Value.Rev = "HEAD~1"
+		if err := NewValidator().ValidateRepositorySpec(withRev); err == nil {
+			t.Fatal("expected error because the shallow clone cannot checkout rev")
+		}
+		mgr := NewRepositoryManager([]RepositorySpec{spec}, new(TokenManager))
+		t.Cleanup(func() {
+			mgr.Cleanup()
+		})
+		if err := mgr.CloneAll(WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelDebug))); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(repoDir, ".git", "shallow")); err != nil {
+			t.Fatalf("failed to clone as shallow repository: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(repoDir, "b", "b.txt")); !os.IsNotExist(err) {
+			t.Fatalf("unexpected file is checked out: %v", err)
+		}
+		archivePath, err := mgr.ArchivePathByRepoName(repoName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := archiveFileNames(t, archivePath)
+		if len(names) != 2 || names[0] != "a/a.txt" || names[1] != "c.txt" {
+			t.Fatalf("unexpected archived files: %v", names)
+		}
+	})
+	t.Run("clone with submodules", func(t *testing.T) {
+		addr, reposDir := runGitServer(t)
+
+		// gitkit serves bare repositories only, so create repositories in work directory and clone them as bare repository.
+		workDir := t.TempDir()
+		runGit(t, workDir, "init", "-q", "-b", "master", "sub")
+		if err := os.WriteFile(filepath.Join(workDir, "sub", "sub.txt"), []byte("sub"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, workDir, "-C", "sub", "add", "sub.txt")
+		runGit(t, workDir, "-C", "sub", "commit", "-q", "-m", "add sub.txt")
+		runGit(t, workDir, "clone", "-q", "--bare", "sub", filepath.Join(reposDir, "sub"))
+		runGit(t, workDir, "init", "-q", "-b", "master", "test")
+		runGit(t, workDir, "-C", "test", "submodule", "add", "-q", fmt.Sprintf("http://%s/sub", addr), "sub")
+		runGit(t, workDir, "-C", "test", "commit", "-q", "-m", "add submodule")
+		runGit(t, workDir, "clone", "-q", "--bare", "test", filepath.Join(reposDir, "test"))
+
+		spec := RepositorySpec{
+			Name: "test",
+			Value: Repository{
+				URL:        fmt.Sprintf("http://%s/test", addr),
+				Branch:     "master",
+				Submodules: SubmoduleModeShallow,
+			},
+		}
+		if err := NewValidator().ValidateRepositorySpec(spec); err != nil {
+			t.Fatal(err)
+		}
+		mgr := NewRepositoryManager([]RepositorySpec{spec}, new(TokenManager))
+		t.Cleanup(func() {
+			mgr.Cleanup()
+		})
+		if err := mgr.CloneAll(WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelDebug))); err != nil {
+			t.Fatal(err)
+		}
+		archivePath, err := mgr.ArchivePathByRepoName("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found bool
+		for _, name := range archiveFileNames(t, archivePath) {
+			if name == "sub/sub.txt" {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("failed to find the file of submodule in archive")
+		}
+	})
+	t.Run("merge refs, cherry-pick and apply patches", func(t *testing.T) {
+		addr, reposDir := runGitServer(t)
+
+		workDir := t.TempDir()
+		repoWorkDir := filepath.Join(workDir, "test")
+		commitFile := func(name string) string {
+			t.Helper()
+
+			if err := os.WriteFile(filepath.Join(repoWorkDir, name), []byte(name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			runGit(t, repoWorkDir, "add", name)
+			runGit(t, repoWorkDir, "commit", "-q", "-m", "add "+name)
+			out, err := exec.Command("git", "-C", repoWorkDir, "rev-parse", "HEAD").Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return strings.TrimSpace(string(out))
+		}
+		runGit(t, workDir, "init", "-q", "-b", "master", "test")
+		commitFile("base.txt")
+		runGit(t, repoWorkDir, "checkout", "-q", "-b", "pull")
+		commitFile("pull.txt")
+		runGit(t, repoWorkDir, "checkout", "-q", "-b", "other", "master")
+		commit := commitFile("cherry-pick.txt")
+		runGit(t, repoWorkDir, "checkout", "-q", "master")
+		bareDir := filepath.Join(reposDir, "test")
+		runGit(t, workDir, "init", "-q", "--bare", bareDir)
+		runGit(t, repoWorkDir, "push", "-q", bareDir, "master", "other", "pull:refs/pull/1/head")
+
+		patchPath := filepath.Join(workDir, "add.patch")
+		if err := os.WriteFile(patchPath, []byte(`diff --git a/patch.txt b/patch.txt
+new file mode 100644
+--- /dev/null
++++ b/patch.txt
+@@ -0,0 +1 @@
++patch
+`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		repoDir := filepath.Join(t.TempDir(), "test")
+		spec := RepositorySpec{
+			Name: "test",
+			Value: Repository{
+				URL:        fmt.Sprintf("http://%s/test", addr),
+				Branch:     "master",
+				MergeRefs:  []string{"refs/pull/1/head"},
+				CherryPick: []string{commit},
+				Patches:    []string{patchPath},
+				ClonedPath: repoDir,
+			},
+		}
+		if err := NewValidator().ValidateRepositorySpec(spec); err != nil {
+			t.Fatal(err)
+		}
+		mgr := NewRepositoryManager([]RepositorySpec{spec}, new(TokenManager))
+		t.Cleanup(func() {
+			mgr.Cleanup()
+		})
+		if err := mgr.CloneAll(WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelDebug))); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"base.txt", "pull.txt", "cherry-pick.txt", "patch.txt"} {
+			if _, err := os.Stat(filepath.Join(repoDir, name)); err != nil {
+				t.Fatalf("failed to find %s: %v", name, err)
+			}
+		}
+		head, err := exec.Command("git", "-C", repoDir, "rev-parse", "HEAD").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports := mgr.Reports()
+		if len(reports) != 1 || reports[0].ResolvedSHA != strings.TrimSpace(string(head)) {
+			t.Fatalf("unexpected resolved sha: %+v", reports)
+		}
+	})
+}
+
+func TestRepositoryManagerCache(t *testing.T) {
+	addr, reposDir := runGitServer(t)
+	workDir := t.TempDir()
+	runGit(t, workDir, "init", "-q", "-b", "master", "test")
+	commitFile := func(name, content string) {
+		t.Helper()
+
+		if err := os.WriteFile(filepath.Join(workDir, "test", name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, workDir, "-C", "test", "add", name)
+		runGit(t, workDir, "-C", "test", "commit", "-q", "-m", "update "+name)
+		runGit(t, workDir, "-C", "test", "push", "-q", "-f", filepath.Join(reposDir, "test"), "master")
+	}
+	runGit(t, workDir, "init", "-q", "--bare", filepath.Join(reposDir, "test"))
+	commitFile("a.txt", "a")
+
+	cacheDir := t.TempDir()
+	spec := RepositorySpec{
+		Name: "test",
+		Value: Repository{
+			URL:    fmt.Sprintf("http://%s/test", addr),
+			Branch: "master",
+		},
+	}
+	cloneWithCache := func() string {
+		t.Helper()
+
+		mgr := NewRepositoryManager([]RepositorySpec{spec}, new(TokenManager))
+		mgr.SetCacheDir(cacheDir)
+		t.Cleanup(func() {
+			mgr.Cleanup()
+		})
+		if err := mgr.CloneAll(WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelDebug))); err != nil {
+			t.Fatal(err)
+		}
+		archivePath, err := mgr.ArchivePathByRepoName("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reports := mgr.Reports(); len(reports) != 1 || reports[0].ResolvedSHA == "" {
+			t.Fatalf("failed to get resolved sha: %+v", reports)
+		}
+		if err := mgr.Cleanup(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(archivePath); err != nil {
+			t.Fatalf("cached archive is removed by cleanup: %v", err)
+		}
+		return archivePath
+	}
+
+	archivePath := cloneWithCache()
+	if reused := cloneWithCache(); reused != archivePath {
+		t.Fatalf("failed to reuse the cached archive: %s and %s", archivePath, reused)
+	}
+	commitFile("b.txt", "b")
+	updated := cloneWithCache()
+	if updated == archivePath {
+		t.Fatalf("failed to update the cached archive")
+	}
+	var found bool
+	for _, name := range archiveFileNames(t, updated) {
+		if name == "b.txt" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("failed to find the file added by the latest commit")
+	}
+	mirrors, err := os.ReadDir(filepath.Join(cacheDir, repositoryCacheMirrorDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mirrors) != 1 {
+		t.Fatalf("failed to reuse the mirror: %d mirrors", len(mirrors))
+	}
+
+	t.Run("update reused cloned directory", func(t *testing.T) {
+		repoDir := filepath.Join(t.TempDir(), "test")
+		clonedSpec := RepositorySpec{
+			Name: "test",
+			Value: Repository{
+				URL:        fmt.Sprintf("http://%s/test", addr),
+				ClonedPath: repoDir,
+			},
+		}
+		clone := func() {
+			t.Helper()
+
+			mgr := NewRepositoryManager([]RepositorySpec{clonedSpec}, new(TokenManager))
+			if err := mgr.CloneAll(WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelDebug))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		clone()
+		commitFile("c.txt", "c")
+		clone()
+		if _, err := os.Stat(filepath.Join(repoDir, "c.txt")); err != nil {
+			t.Fatalf("reused cloned directory isn't updated: %v", err)
+		}
 	})
 }
 
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to run git %v: %s: %v", args, string(out), err)
+	}
+}
+
+func archiveFileNames(t *testing.T, archivePath string) []string {
+	t.Helper()
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+	names := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func runGitServer(t *testing.T) (string, string) {
 	t.Helper()
 
@@ -295,3 +658,60 @@ func assertFile(t *testing.T, fs billy.Filesystem, path string, expect string) {
 		t.Errorf("%s: expect %q but got %q", path, expect, got)
 	}
 }
+
+func TestSSHRepositoryAuth(t *testing.T) {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(privKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewPublicKey(hostPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{"example.com"}, hostKey)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := newSSHRepositoryAuth("deploy@example.com:goccy/kubetest.git", &SSHKey{
+		PrivateKeyFile: "/path/to/id",
+		PrivateKey:     pem.EncodeToMemory(block),
+		KnownHostsFile: knownHostsFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeys, ok := auth.method.(*gitssh.PublicKeys)
+	if !ok {
+		t.Fatalf("unexpected auth method: %T", auth.method)
+	}
+	if publicKeys.User != "deploy" {
+		t.Fatalf("failed to get user from url: %s", publicKeys.User)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	if err := publicKeys.HostKeyCallback("example.com:22", addr, hostKey); err != nil {
+		t.Fatalf("failed to verify known host key: %v", err)
+	}
+	unknownPubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownKey, err := ssh.NewPublicKey(unknownPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publicKeys.HostKeyCallback("example.com:22", addr, unknownKey); err == nil {
+		t.Fatal("expected error for unknown host key")
+	}
+	expectedEnv := "GIT_SSH_COMMAND=ssh -i /path/to/id -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + knownHostsFile
+	if len(auth.env) != 1 || auth.env[0] != expectedEnv {
+		t.Fatalf("unexpected env: %v", auth.env)
+	}
+}
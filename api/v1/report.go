@@ -0,0 +1,298 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// WriteHTMLReport writes the report as a self-contained HTML page.
+// keyLogs is the log of each strategy key. It is embedded in the page as collapsible sections.
+func WriteHTMLReport(w io.Writer, report *Report, keyLogs map[string][]byte) error {
+	if err := htmlReportTmpl.Execute(w, newHTMLReport(report, keyLogs)); err != nil {
+		return fmt.Errorf("kubetest: failed to write html report: %w", err)
+	}
+	return nil
+}
+
+type htmlReport struct {
+	*Report
+	ElapsedTime string
+	Rows        []*htmlReportRow
+	Logs        []*htmlReportLog
+	Timeline    []*htmlReportTimeline
+}
+
+type htmlReportRow struct {
+	Idx         int
+	Name        string
+	Status      ResultStatus
+	ElapsedTime string
+	Pod         string
+	StartedAt   string
+	HasLog      bool
+}
+
+type htmlReportLog struct {
+	Idx  int
+	Name string
+	Log  string
+}
+
+type htmlReportTimeline struct {
+	Pod  string
+	Bars []*htmlReportTimelineBar
+}
+
+type htmlReportTimelineBar struct {
+	Name        string
+	Status      ResultStatus
+	ElapsedTime string
+	// Left and Width are the position of the bar in percent.
+	Left  float64
+	Width float64
+}
+
+const (
+	htmlReportNoPod       = "-"
+	htmlReportMinBarWidth = 0.5
+)
+
+func newHTMLReport(report *Report, keyLogs map[string][]byte) *htmlReport {
+	r := &htmlReport{
+		Report:      report,
+		ElapsedTime: formatElapsedTimeSec(report.ElapsedTimeSec),
+	}
+	logIdx := map[string]int{}
+	addLog := func(name string) int {
+		if idx, exists := logIdx[name]; exists {
+			return idx
+		}
+		log, exists := keyLogs[name]
+		if !exists {
+			return -1
+		}
+		idx := len(r.Logs)
+		logIdx[name] = idx
+		r.Logs = append(r.Logs, &htmlReportLog{Idx: idx, Name: name, Log: string(log)})
+		return idx
+	}
+	for _, detail := range report.Details {
+		row := &htmlReportRow{
+			Name:        detail.Name,
+			Status:      detail.Status,
+			ElapsedTime: formatElapsedTimeSec(detail.ElapsedTimeSec),
+			Pod:         detail.Pod,
+		}
+		if !detail.StartedAt.IsZero() {
+			row.StartedAt = detail.StartedAt.Format(time.RFC3339)
+		}
+		if logIdx := addLog(detail.Name); logIdx >= 0 {
+			row.Idx = logIdx
+			row.HasLog = true
+		}
+		r.Rows = append(r.Rows, row)
+	}
+
+	// keep the log of keys that don't have the result.
+	names := make([]string, 0, len(keyLogs))
+	for name := range keyLogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		addLog(name)
+	}
+	r.Timeline = newHTMLReportTimeline(report)
+	return r
+}
+
+func newHTMLReportTimeline(report *Report) []*htmlReportTimeline {
+	start := report.StartedAt.Time
+	end := start.Add(time.Duration(report.ElapsedTimeSec) * time.Second)
+	for _, detail := range report.Details {
+		if detail.StartedAt.IsZero() {
+			continue
+		}
+		if start.IsZero() || detail.StartedAt.Time.Before(start) {
+			start = detail.StartedAt.Time
+		}
+		if detailEnd := detail.StartedAt.Add(time.Duration(detail.ElapsedTimeSec) * time.Second); detailEnd.After(end) {
+			end = detailEnd
+		}
+	}
+	total := end.Sub(start).Seconds()
+	if total < 1 {
+		total = 1
+	}
+	podToTimeline := map[string]*htmlReportTimeline{}
+	timeline := []*htmlReportTimeline{}
+	for _, detail := range report.Details {
+		if detail.StartedAt.IsZero() {
+			continue
+		}
+		pod := detail.Pod
+		if pod == "" {
+			pod = htmlReportNoPod
+		}
+		t, exists := podToTimeline[pod]
+		if !exists {
+			t = &htmlReportTimeline{Pod: pod}
+			podToTimeline[pod] = t
+			timeline = append(timeline, t)
+		}
+		width := float64(detail.ElapsedTimeSec) / total * 100
+		if width < htmlReportMinBarWidth {
+			width = htmlReportMinBarWidth
+		}
+		t.Bars = append(t.Bars, &htmlReportTimelineBar{
+			Name:        detail.Name,
+			Status:      detail.Status,
+			ElapsedTime: formatElapsedTimeSec(detail.ElapsedTimeSec),
+			Left:        detail.StartedAt.Sub(start).Seconds() / total * 100,
+			Width:       width,
+		})
+	}
+	return timeline
+}
+
+func formatElapsedTimeSec(sec int64) string {
+	return (time.Duration(sec) * time.Second).String()
+}
+
+var htmlReportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>kubetest report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; }
+th { background: #f6f8fa; cursor: pointer; user-select: none; }
+.success { color: #1a7f37; }
+.failure, .error { color: #cf222e; }
+.stats td { font-weight: bold; }
+.timeline { position: relative; height: 20px; background: #f6f8fa; width: 100%; }
+.bar { position: absolute; top: 2px; height: 16px; opacity: 0.8; }
+.bar.success { background: #2da44e; }
+.bar.failure, .bar.error { background: #cf222e; }
+.timeline-row td:last-child { width: 80%; }
+pre { background: #f6f8fa; padding: 8px; overflow: auto; max-height: 40em; }
+</style>
+</head>
+<body>
+<h1>kubetest report</h1>
+<h2>Summary</h2>
+<table class="stats">
+<tr><th>status</th><td class="{{ .Status }}">{{ .Status }}</td></tr>
+<tr><th>started at</th><td>{{ .StartedAt.Format "2006-01-02T15:04:05Z07:00" }}</td></tr>
+<tr><th>elapsed time</th><td>{{ .ElapsedTime }}</td></tr>
+<tr><th>total</th><td>{{ .TotalNum }}</td></tr>
+<tr><th>success</th><td class="success">{{ .SuccessNum }}</td></tr>
+<tr><th>failure</th><td class="failure">{{ .FailureNum }}</td></tr>
+{{- if .UnknownNum }}
+<tr><th>unknown</th><td class="error">{{ .UnknownNum }}</td></tr>
+{{- end }}
+{{- range $k, $v := .ExtParam }}
+<tr><th>{{ $k }}</th><td>{{ $v }}</td></tr>
+{{- end }}
+</table>
+{{- if .Repos }}
+<h2>Repositories</h2>
+<table>
+<tr><th>name</th><th>url</th><th>ref</th><th>sha</th><th>merge base sha</th><th>clone duration</th></tr>
+{{- range .Repos }}
+<tr><td>{{ .Name }}</td><td>{{ .URL }}</td><td>{{ .Ref }}</td><td>{{ .ResolvedSHA }}</td><td>{{ .MergeBaseSHA }}</td><td>{{ printf "%.2fs" .CloneElapsedTimeSec }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+<h2>Details</h2>
+<table id="details">
+<thead>
+<tr><th data-type="string">name</th><th data-type="string">status</th><th data-type="number">duration</th><th data-type="string">pod</th><th data-type="string">started at</th></tr>
+</thead>
+<tbody>
+{{- range .Rows }}
+<tr>
+<td>{{ if .HasLog }}<a href="#log-{{ .Idx }}" onclick="openLog({{ .Idx }})">{{ .Name }}</a>{{ else }}{{ .Name }}{{ end }}</td>
+<td class="{{ .Status }}">{{ .Status }}</td>
+<td>{{ .ElapsedTime }}</td>
+<td>{{ .Pod }}</td>
+<td>{{ .StartedAt }}</td>
+</tr>
+{{- end }}
+</tbody>
+</table>
+{{- if .Timeline }}
+<h2>Timeline</h2>
+<table>
+{{- range .Timeline }}
+<tr class="timeline-row">
+<td>{{ .Pod }}</td>
+<td><div class="timeline">
+{{- range .Bars }}
+<div class="bar {{ .Status }}" style="left: {{ printf "%.2f" .Left }}%; width: {{ printf "%.2f" .Width }}%;" title="{{ .Name }} ({{ .Status }}, {{ .ElapsedTime }})"></div>
+{{- end }}
+</div></td>
+</tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Logs }}
+<h2>Logs</h2>
+{{- range .Logs }}
+<details id="log-{{ .Idx }}">
+<summary>{{ .Name }}</summary>
+<pre>{{ .Log }}</pre>
+</details>
+{{- end }}
+{{- end }}
+<script>
+function openLog(idx) {
+  document.getElementById("log-" + idx).open = true;
+}
+function durationToSec(text) {
+  var sec = 0;
+  var re = /([0-9.]+)(h|ms|m|s)/g;
+  var m;
+  while ((m = re.exec(text)) !== null) {
+    var v = parseFloat(m[1]);
+    switch (m[2]) {
+    case "h": sec += v * 3600; break;
+    case "m": sec += v * 60; break;
+    case "s": sec += v; break;
+    case "ms": sec += v / 1000; break;
+    }
+  }
+  return sec;
+}
+(function () {
+  var table = document.getElementById("details");
+  var headers = table.querySelectorAll("th");
+  headers.forEach(function (th, col) {
+    var asc = true;
+    th.addEventListener("click", function () {
+      var tbody = table.tBodies[0];
+      var rows = Array.prototype.slice.call(tbody.rows);
+      var isNumber = th.dataset.type === "number";
+      rows.sort(function (a, b) {
+        var x = a.cells[col].textContent;
+        var y = b.cells[col].textContent;
+        var cmp = isNumber ? durationToSec(x) - durationToSec(y) : x.localeCompare(y);
+        return asc ? cmp : -cmp;
+      });
+      asc = !asc;
+      rows.forEach(function (row) { tbody.appendChild(row); });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHTMLReport(t *testing.T) {
+	startedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	report := &Report{
+		Status:         ResultStatusFailure,
+		StartedAt:      metav1.Time{Time: startedAt},
+		ElapsedTimeSec: 10,
+		TotalNum:       2,
+		SuccessNum:     1,
+		FailureNum:     1,
+		Details: []*ReportDetail{
+			{
+				Status:         ResultStatusSuccess,
+				Name:           "a",
+				StartedAt:      metav1.Time{Time: startedAt},
+				ElapsedTimeSec: 5,
+				Pod:            "pod-0",
+			},
+			{
+				Status:         ResultStatusFailure,
+				Name:           "<b>",
+				StartedAt:      metav1.Time{Time: startedAt.Add(5 * time.Second)},
+				ElapsedTimeSec: 5,
+				Pod:            "pod-0",
+			},
+		},
+		Repos: []*ReportRepo{
+			{
+				Name:                "repo",
+				URL:                 "https://github.com/goccy/kubetest.git",
+				ResolvedSHA:         "0123456789abcdef",
+				CloneElapsedTimeSec: 1.5,
+			},
+		},
+	}
+	var out bytes.Buffer
+	if err := WriteHTMLReport(&out, report, map[string][]byte{
+		"a":   []byte("output of a"),
+		"<b>": []byte("<script>alert(1)</script>"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+	for _, expected := range []string{
+		"output of a",
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"pod-0",
+		"left: 50.00%; width: 50.00%;",
+		`<details id="log-1">`,
+		"0123456789abcdef",
+		"1.50s",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Fatalf("failed to find %q in html report:\n%s", expected, html)
+		}
+	}
+	if strings.Contains(html, "<script>alert(1)") {
+		t.Fatalf("failed to escape log")
+	}
+}
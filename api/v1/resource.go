@@ -5,11 +5,18 @@ package v1
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 )
@@ -18,26 +25,87 @@ type ResourceManager struct {
 	repoMgr     *RepositoryManager
 	tokenMgr    *TokenManager
 	artifactMgr *ArtifactManager
+	runID       string
 	setupOnce   sync.Once
 	doneSetup   bool
 	logPath     string
 	reportPath  string
+	// reportFormats formats of report used by report volumes.
+	reportFormats map[ReportFormatType]struct{}
+	// sharedStorage is nil if the shared storage isn't specified.
+	sharedStorage *sharedStorage
 }
 
 func NewResourceManager(clientset *kubernetes.Clientset, testjob TestJob) *ResourceManager {
 	tokenClient := NewTokenClient(clientset, testjob.Namespace)
 	tokenMgr := NewTokenManager(testjob.Spec.Tokens, tokenClient)
 	repoMgr := NewRepositoryManager(testjob.Spec.Repos, tokenMgr)
-	artifactMgr := NewArtifactManager(testjob.Spec.ExportArtifacts)
+	artifactMgr := NewArtifactManager(testjob.Spec.ExportArtifacts, tokenMgr)
+	runID := runIDByTestJob(testjob)
+	artifactMgr.SetRun(testjob.Name, runID)
+	var shared *sharedStorage
+	if testjob.Spec.SharedStorage != nil {
+		shared = newSharedStorage(testjob.Spec.SharedStorage, runID)
+	}
 	return &ResourceManager{
-		repoMgr:     repoMgr,
-		tokenMgr:    tokenMgr,
-		artifactMgr: artifactMgr,
+		repoMgr:       repoMgr,
+		tokenMgr:      tokenMgr,
+		artifactMgr:   artifactMgr,
+		runID:         runID,
+		sharedStorage: shared,
+		reportFormats: reportFormatsByTestJob(testjob),
 	}
 }
 
+// runIDByTestJob returns the UID of TestJob if exists. Otherwise, generates the id by the current time.
+func runIDByTestJob(testjob TestJob) string {
+	if testjob.UID != "" {
+		return string(testjob.UID)
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
+
+func reportFormatsByTestJob(testjob TestJob) map[ReportFormatType]struct{} {
+	formats := map[ReportFormatType]struct{}{}
+	for _, step := range testjob.Spec.PostSteps {
+		for _, volume := range step.Template.Spec.Volumes {
+			if volume.Report != nil {
+				formats[volume.Report.Format] = struct{}{}
+			}
+		}
+	}
+	return formats
+}
+
+// RunID returns the identifier of the run.
+func (m *ResourceManager) RunID() string {
+	return m.runID
+}
+
+// ArtifactReports returns the results of exporting artifacts.
+func (m *ResourceManager) ArtifactReports() []*ReportArtifact {
+	return m.artifactMgr.Reports()
+}
+
+// SetRepositoryCacheDir sets the directory to cache repositories across runs.
+func (m *ResourceManager) SetRepositoryCacheDir(dir string) {
+	m.repoMgr.SetCacheDir(dir)
+}
+
 func (m *ResourceManager) Cleanup() error {
-	return m.repoMgr.Cleanup()
+	errs := []string{}
+	if err := m.repoMgr.Cleanup(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := m.tokenMgr.Cleanup(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ":"))
+	}
+	return nil
 }
 
 func (m *ResourceManager) Setup(ctx context.Context) error {
@@ -46,11 +114,20 @@ func (m *ResourceManager) Setup(ctx context.Context) error {
 	}()
 	var err error
 	m.setupOnce.Do(func() {
-		err = m.repoMgr.CloneAll(ctx)
+		err = m.setup(ctx)
 	})
 	return err
 }
 
+func (m *ResourceManager) setup(ctx context.Context) error {
+	logDir, err := m.LogDir()
+	if err != nil {
+		return err
+	}
+	m.artifactMgr.AddLogArtifact(logDir)
+	return m.repoMgr.CloneAll(ctx)
+}
+
 func (m *ResourceManager) WriteLog(logger Logger) error {
 	mainLogger, ok := logger.(*mainLogger)
 	if !ok {
@@ -63,6 +140,16 @@ func (m *ResourceManager) WriteLog(logger Logger) error {
 	if err := os.WriteFile(logPath, mainLogger.buf.Bytes(), 0644); err != nil {
 		return fmt.Errorf("kubetest: failed to create log file: %w", err)
 	}
+	keyLogDir, err := m.KeyLogDir()
+	if err != nil {
+		return err
+	}
+	for key, log := range mainLogger.keyLogs() {
+		keyLogPath := filepath.Join(keyLogDir, keyLogFileName(key))
+		if err := os.WriteFile(keyLogPath, log, 0644); err != nil {
+			return fmt.Errorf("kubetest: failed to create log file for %s: %w", key, err)
+		}
+	}
 	return nil
 }
 
@@ -74,27 +161,90 @@ func (m *ResourceManager) LogPath() (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("kubetest: failed to create temporary directory for log: %w", err)
 	}
+	if err := os.Mkdir(filepath.Join(dir, keyLogDirName), 0755); err != nil {
+		return "", fmt.Errorf("kubetest: failed to create directory for log of each key: %w", err)
+	}
 	m.logPath = filepath.Join(dir, "kubetest.log")
 	return m.logPath, nil
 }
 
+// LogDir returns the directory contains kubetest.log and the directory for log files of each strategy key.
+func (m *ResourceManager) LogDir() (string, error) {
+	logPath, err := m.LogPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(logPath), nil
+}
+
+// KeyLogDir returns the directory contains log files of each strategy key.
+func (m *ResourceManager) KeyLogDir() (string, error) {
+	dir, err := m.LogDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, keyLogDirName), nil
+}
+
+const keyLogDirName = "keys"
+
+var invalidFileNameCharPattern = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// keyLogFileName returns the file name for the log of strategy key.
+// Characters that cannot be used safely for file name are replaced with '_',
+// and the short hash of the key is appended to the replaced name so as not to be the same as the name of other keys.
+func keyLogFileName(key string) string {
+	name := invalidFileNameCharPattern.ReplaceAllString(key, "_")
+	if strings.Trim(name, ".") == "" {
+		name = strings.Repeat("_", len(name))
+	}
+	if name != key {
+		hash := sha256.Sum256([]byte(key))
+		name += "-" + hex.EncodeToString(hash[:])[:8]
+	}
+	return name + ".log"
+}
+
 const (
 	reportJSONFile = "report.json"
+	reportHTMLFile = "report.html"
 )
 
-func (m *ResourceManager) WriteReport(result *Result) error {
+// WriteReport writes report.json. If the report volume of html format is used, also writes report.html with the log of each strategy key.
+func (m *ResourceManager) WriteReport(logger Logger, report *Report) error {
 	reportPath, err := m.ReportPath(ReportFormatTypeJSON)
 	if err != nil {
 		return err
 	}
-	b, err := json.Marshal(result)
+	b, err := json.Marshal(report)
 	if err != nil {
-		return fmt.Errorf("kubetest: failed to encode result to json: %w", err)
+		return fmt.Errorf("kubetest: failed to encode report to json: %w", err)
 	}
 	if err := os.WriteFile(reportPath, b, 0644); err != nil {
 		return fmt.Errorf("kubetest: failed to create report.json: %w", err)
 	}
-	return nil
+	if _, exists := m.reportFormats[ReportFormatTypeHTML]; !exists {
+		return nil
+	}
+	htmlReportPath, err := m.ReportPath(ReportFormatTypeHTML)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(htmlReportPath)
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to create report.html: %w", err)
+	}
+	defer f.Close()
+	return WriteHTMLReport(f, report, keyLogsByLogger(logger))
+}
+
+// keyLogsByLogger returns the log of each strategy key. The log has already been masked.
+func keyLogsByLogger(logger Logger) map[string][]byte {
+	mainLogger, ok := logger.(*mainLogger)
+	if !ok {
+		return nil
+	}
+	return mainLogger.keyLogs()
 }
 
 func (m *ResourceManager) ReportPath(format ReportFormatType) (string, error) {
@@ -105,14 +255,25 @@ func (m *ResourceManager) ReportPath(format ReportFormatType) (string, error) {
 		}
 		m.reportPath = dir
 	}
+	return filepath.Join(m.reportPath, reportFileName(format)), nil
+}
+
+func reportFileName(format ReportFormatType) string {
 	switch format {
 	case ReportFormatTypeJSON:
-		return filepath.Join(m.reportPath, reportJSONFile), nil
+		return reportJSONFile
+	case ReportFormatTypeHTML:
+		return reportHTMLFile
 	default:
-		return filepath.Join(m.reportPath, "report"), nil
+		return "report"
 	}
 }
 
+// RepositoryReports returns the commit hash of each repository.
+func (m *ResourceManager) RepositoryReports() []*ReportRepo {
+	return m.repoMgr.Reports()
+}
+
 func (m *ResourceManager) RepositoryPathByName(name string) (string, error) {
 	if !m.doneSetup {
 		return "", fmt.Errorf("kubetest: resource manager isn't setup")
@@ -121,16 +282,20 @@ func (m *ResourceManager) RepositoryPathByName(name string) (string, error) {
 }
 
 func (m *ResourceManager) TokenPathByName(ctx context.Context, name string) (string, error) {
-	if !m.doneSetup {
-		return "", fmt.Errorf("kubetest: resource manager isn't setup")
-	}
-	token, err := m.tokenMgr.TokenByName(ctx, name)
+	token, err := m.TokenByName(ctx, name)
 	if err != nil {
 		return "", err
 	}
 	return token.File, nil
 }
 
+func (m *ResourceManager) TokenByName(ctx context.Context, name string) (*Token, error) {
+	if !m.doneSetup {
+		return nil, fmt.Errorf("kubetest: resource manager isn't setup")
+	}
+	return m.tokenMgr.TokenByName(ctx, name)
+}
+
 func (m *ResourceManager) ArtifactPathByName(ctx context.Context, name string) (string, error) {
 	if !m.doneSetup {
 		return "", fmt.Errorf("kubetest: resource manager isn't setup")
@@ -5,8 +5,11 @@ package v1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,6 +42,10 @@ type Runner struct {
 	clientset *kubernetes.Clientset
 	runMode   RunMode
 	logger    Logger
+	// repoCacheDir is the directory to cache repositories across runs. If empty, repositories aren't cached.
+	repoCacheDir string
+	// localTokenProviders whether the tokens can be read from the environment of the process.
+	localTokenProviders bool
 }
 
 func NewRunner(cfg *rest.Config, runMode RunMode) *Runner {
@@ -52,16 +59,47 @@ func (r *Runner) SetLogger(logger Logger) {
 	r.logger = logger
 }
 
+// SetRepositoryCacheDir sets the directory to cache repositories across runs.
+// The bare mirror of each repository is fetched incrementally, and the archive is reused while the resolved commits are unchanged.
+func (r *Runner) SetRepositoryCacheDir(dir string) {
+	r.repoCacheDir = dir
+}
+
+// EnableLocalTokenProviders allows the tokens read from the environment of the process ( env, exec and $VAULT_TOKEN ).
+// It must be enabled only if the runner runs TestJob written by the owner of the process ( e.g. kubetest command ).
+func (r *Runner) EnableLocalTokenProviders() {
+	r.localTokenProviders = true
+}
+
+// WriteReport writes the report to w by specified format.
+// If ReportFormatTypeHTML is specified, the log of each strategy key recorded by the runner's logger is embedded in the page.
+func (r *Runner) WriteReport(w io.Writer, report *Report, format ReportFormatType) error {
+	switch format {
+	case "", ReportFormatTypeJSON:
+		b, err := json.Marshal(report)
+		if err != nil {
+			return fmt.Errorf("kubetest: failed to encode report to json: %w", err)
+		}
+		if _, err := w.Write(b); err != nil {
+			return fmt.Errorf("kubetest: failed to write report: %w", err)
+		}
+		return nil
+	case ReportFormatTypeHTML:
+		return WriteHTMLReport(w, report, keyLogsByLogger(r.logger))
+	}
+	return fmt.Errorf("kubetest: unknown report format %s", format)
+}
+
 func (r *Runner) Run(ctx context.Context, testjob TestJob) (*Report, error) {
-	if err := testjob.Validate(); err != nil {
+	validator := NewValidator()
+	if r.localTokenProviders {
+		validator.EnableLocalTokenProviders()
+	}
+	if err := validator.ValidateTestJob(testjob); err != nil {
 		return nil, err
 	}
 	if r.logger == nil {
-		level := LogLevelInfo
-		if testjob.Spec.Log.Level != LogLevelNone {
-			level = testjob.Spec.Log.Level
-		}
-		r.logger = NewLogger(os.Stdout, level)
+		r.logger = NewLoggerWithSpec(os.Stdout, testjob.Spec.Log)
 	}
 	r.logger.Info("start kubetest")
 	r.logger.Debug("run validation")
@@ -72,13 +110,22 @@ func (r *Runner) Run(ctx context.Context, testjob TestJob) (*Report, error) {
 		return nil, err
 	}
 	resourceMgr := NewResourceManager(clientset, testjob)
+	resourceMgr.SetRepositoryCacheDir(r.repoCacheDir)
+	// cleanup the token files and the temporary directories created before the setup fails.
+	defer resourceMgr.Cleanup()
 	r.logger.Debug("setup resource manager")
 	if err := resourceMgr.Setup(ctx); err != nil {
 		return nil, err
 	}
-	defer resourceMgr.Cleanup()
 	builder := NewTaskBuilder(r.cfg, resourceMgr, testjob.Namespace, r.runMode)
-	var result Result
+	builder.SetPreInit(testjob.Spec.PreInit)
+	defer func() {
+		// the staged files must be removed even if the run is canceled.
+		if err := builder.cleanupSharedStorage(context.WithoutCancel(ctx)); err != nil {
+			r.logger.Warn("%s", err)
+		}
+	}()
+	result := Result{job: testjob, runID: resourceMgr.RunID(), repos: resourceMgr.RepositoryReports()}
 	for _, step := range testjob.Spec.PreSteps {
 		step := step
 		r.logger.Info("run prestep: %s", step.Name)
@@ -94,6 +141,10 @@ func (r *Runner) Run(ctx context.Context, testjob TestJob) (*Report, error) {
 			if err := result.Error(); err != nil {
 				return nil, fmt.Errorf("kubetest: failed to run prestep %s: %w", step.Name, err)
 			}
+			// the subsequent steps use the artifacts of prestep.
+			if err := result.ArtifactErr; err != nil {
+				return nil, fmt.Errorf("kubetest: failed to copy artifact of prestep %s: %w", step.Name, err)
+			}
 		}
 		result.preStepResults = append(result.preStepResults, preStepResult)
 	}
@@ -110,7 +161,8 @@ func (r *Runner) Run(ctx context.Context, testjob TestJob) (*Report, error) {
 	if err := resourceMgr.WriteLog(r.logger); err != nil {
 		return nil, err
 	}
-	if err := resourceMgr.WriteReport(&result); err != nil {
+	report := result.toMaskedReport(r.logger)
+	if err := resourceMgr.WriteReport(r.logger, report); err != nil {
 		return nil, err
 	}
 	for _, step := range testjob.Spec.PostSteps {
@@ -134,7 +186,8 @@ func (r *Runner) Run(ctx context.Context, testjob TestJob) (*Report, error) {
 	if err := resourceMgr.ExportArtifacts(ctx); err != nil {
 		return nil, err
 	}
-	return result.toReport(), nil
+	result.artifacts = resourceMgr.ArtifactReports()
+	return result.toMaskedReport(r.logger), nil
 }
 
 type Result struct {
@@ -149,6 +202,9 @@ type Result struct {
 	postStepResults []*TaskResult
 	taskResult      *TaskResultGroup
 	job             TestJob
+	runID           string
+	repos           []*ReportRepo
+	artifacts       []*ReportArtifact
 }
 
 func (r *Result) setByTaskResult(startedAt time.Time, taskResult *TaskResultGroup) {
@@ -176,5 +232,32 @@ func (r *Result) toReport() *Report {
 		ElapsedTimeSec: int64(r.elapsedTime.Seconds()),
 		Details:        r.taskResult.ToReportDetails(),
 		ExtParam:       r.job.Spec.Log.ExtParam,
+		Repos:          r.repos,
+		RunID:          r.runID,
+		Artifacts:      r.artifacts,
+		Attempts:       r.attempts(),
 	}
 }
+
+// attempts returns the attempts of all tasks in the order of the steps.
+func (r *Result) attempts() []*ReportAttempt {
+	attempts := []*ReportAttempt{}
+	for _, result := range r.preStepResults {
+		attempts = append(attempts, result.ToReportAttempts()...)
+	}
+	if r.taskResult != nil {
+		attempts = append(attempts, r.taskResult.ToReportAttempts()...)
+	}
+	for _, result := range r.postStepResults {
+		attempts = append(attempts, result.ToReportAttempts()...)
+	}
+	return attempts
+}
+
+// toMaskedReport returns the report whose secrets are masked.
+// The string fields are masked one by one so that the pattern matching across the fields cannot break the report.
+func (r *Result) toMaskedReport(logger Logger) *Report {
+	report := r.toReport().DeepCopy()
+	maskStrings(reflect.ValueOf(report), logger.Mask)
+	return report
+}
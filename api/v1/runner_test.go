@@ -91,6 +91,48 @@ func TestRunner(t *testing.T) {
 			})
 		}
 	})
+	t.Run("repository metadata", func(t *testing.T) {
+		for _, runMode := range getRunModes() {
+			t.Run(runMode.String(), func(t *testing.T) {
+				runner := NewRunner(getConfig(), runMode)
+				runner.SetLogger(NewLogger(os.Stdout, LogLevelDebug))
+				report, err := runner.Run(context.Background(), TestJob{
+					ObjectMeta: testjobObjectMeta(),
+					Spec: TestJobSpec{
+						Repos: testRepos(),
+						MainStep: MainStep{
+							Template: TestJobTemplateSpec{
+								ObjectMeta: metav1.ObjectMeta{
+									GenerateName: "test",
+								},
+								Spec: TestJobPodSpec{
+									Containers: []TestJobContainer{
+										{
+											Container: corev1.Container{
+												Name:    "test",
+												Image:   "alpine",
+												Command: []string{"sh", "-c"},
+												Args:    []string{`test -n "$KUBETEST_REPO_REPO_SHA" && test "$KUBETEST_REPO_REPO_URL" = "https://github.com/goccy/kubetest.git"`},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if report.Status != ResultStatusSuccess {
+					t.Fatalf("failed to get repository metadata from env: %s", report.Status)
+				}
+				if len(report.Repos) != 1 || report.Repos[0].Name != "repo" || report.Repos[0].ResolvedSHA == "" {
+					t.Fatalf("unexpected repository report: %+v", report.Repos)
+				}
+			})
+		}
+	})
 	t.Run("initContainer", func(t *testing.T) {
 		for _, runMode := range getRunModes() {
 			t.Run(runMode.String(), func(t *testing.T) {
@@ -1019,6 +1061,209 @@ func TestRunner(t *testing.T) {
 			})
 		}
 	})
+	t.Run("export artifacts by glob paths", func(t *testing.T) {
+		for _, runMode := range getRunModes() {
+			t.Run(runMode.String(), func(t *testing.T) {
+				exportDir, err := os.MkdirTemp("", "exported_artifacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(exportDir)
+
+				runner := NewRunner(getConfig(), runMode)
+				runner.SetLogger(NewLogger(os.Stdout, LogLevelDebug))
+				if _, err := runner.Run(context.Background(), TestJob{
+					ObjectMeta: testjobObjectMeta(),
+					Spec: TestJobSpec{
+						MainStep: MainStep{
+							Template: TestJobTemplateSpec{
+								ObjectMeta: metav1.ObjectMeta{
+									GenerateName: "test-",
+								},
+								Spec: TestJobPodSpec{
+									Artifacts: []ArtifactSpec{
+										{
+											Name: "export-artifact",
+											Container: ArtifactContainer{
+												Name: "test",
+												Paths: []string{
+													filepath.Join("/", "work", "reports", "**", "junit-*.xml"),
+													filepath.Join("coverage", "*.out"),
+												},
+												Exclude: []string{"skip.out"},
+											},
+										},
+									},
+									Containers: []TestJobContainer{
+										{
+											Container: corev1.Container{
+												Name:    "test",
+												Image:   "alpine",
+												Command: []string{"sh", "-c"},
+												Args: []string{
+													"mkdir -p reports/a coverage && touch reports/junit-1.xml reports/a/junit-2.xml reports/a/other.txt coverage/test.out coverage/skip.out",
+												},
+												WorkingDir: filepath.Join("/", "work"),
+											},
+										},
+									},
+								},
+							},
+						},
+						ExportArtifacts: []ExportArtifact{
+							{
+								Name: "export-artifact",
+								Path: exportDir,
+							},
+						},
+					},
+				}); err != nil {
+					t.Fatal(err)
+				}
+				if runMode == RunModeDryRun {
+					return
+				}
+				artifactDir := filepath.Join(exportDir, "test", "export-artifact")
+				for _, path := range []string{
+					filepath.Join("reports", "junit-1.xml"),
+					filepath.Join("reports", "a", "junit-2.xml"),
+					filepath.Join("coverage", "test.out"),
+				} {
+					if _, err := os.Stat(filepath.Join(artifactDir, path)); err != nil {
+						t.Fatalf("failed to find exported artifact %s: %v", path, err)
+					}
+				}
+				for _, path := range []string{
+					filepath.Join("reports", "a", "other.txt"),
+					filepath.Join("coverage", "skip.out"),
+				} {
+					if _, err := os.Stat(filepath.Join(artifactDir, path)); err == nil {
+						t.Fatalf("unexpected artifact %s is exported", path)
+					}
+				}
+			})
+		}
+	})
+	t.Run("collect artifacts by policy", func(t *testing.T) {
+		for _, runMode := range getRunModes() {
+			t.Run(runMode.String(), func(t *testing.T) {
+				exportDir, err := os.MkdirTemp("", "exported_artifacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(exportDir)
+
+				runner := NewRunner(getConfig(), runMode)
+				runner.SetLogger(NewLogger(os.Stdout, LogLevelDebug))
+				report, err := runner.Run(context.Background(), TestJob{
+					ObjectMeta: testjobObjectMeta(),
+					Spec: TestJobSpec{
+						MainStep: MainStep{
+							Template: TestJobTemplateSpec{
+								ObjectMeta: metav1.ObjectMeta{
+									GenerateName: "test-",
+								},
+								Spec: TestJobPodSpec{
+									Artifacts: []ArtifactSpec{
+										{
+											Name: "on-failure",
+											Container: ArtifactContainer{
+												Name: "test",
+												Path: filepath.Join("/", "work", "out", "failure.txt"),
+											},
+											Policy: ArtifactPolicyOnFailure,
+										},
+										{
+											Name: "on-success",
+											Container: ArtifactContainer{
+												Name: "test",
+												Path: filepath.Join("/", "work", "out", "success.txt"),
+											},
+											Policy: ArtifactPolicyOnSuccess,
+										},
+										{
+											Name: "missing",
+											Container: ArtifactContainer{
+												Name: "test",
+												Path: filepath.Join("/", "work", "out", "missing.txt"),
+											},
+										},
+									},
+									Volumes: []TestJobVolume{
+										{
+											Name: "out",
+											TestJobVolumeSource: TestJobVolumeSource{
+												VolumeSource: corev1.VolumeSource{
+													EmptyDir: &corev1.EmptyDirVolumeSource{},
+												},
+											},
+										},
+									},
+									Containers: []TestJobContainer{
+										{
+											Container: corev1.Container{
+												Name:    "test",
+												Image:   "alpine",
+												Command: []string{"sh", "-c"},
+												Args: []string{
+													"mkdir -p out && echo failure > out/failure.txt && echo success > out/success.txt && exit 1",
+												},
+												WorkingDir: filepath.Join("/", "work"),
+												VolumeMounts: []corev1.VolumeMount{
+													{
+														Name:      "out",
+														MountPath: filepath.Join("/", "work", "out"),
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						ExportArtifacts: []ExportArtifact{
+							{
+								Name: "on-failure",
+								Path: exportDir,
+							},
+							{
+								Name: "on-success",
+								Path: exportDir,
+							},
+						},
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if runMode == RunModeDryRun {
+					return
+				}
+				if report.Status != ResultStatusFailure {
+					t.Fatalf("failed to get test result: expected failure but got %s", report.Status)
+				}
+				if len(report.Details) != 1 {
+					t.Fatalf("failed to get details: %v", report.Details)
+				}
+				detail := report.Details[0]
+				if detail.Status != ResultStatusFailure {
+					t.Fatalf("artifact error must not change the status: %s", detail.Status)
+				}
+				if !strings.Contains(detail.ArtifactError, "missing.txt") {
+					t.Fatalf("failed to report artifact error: %q", detail.ArtifactError)
+				}
+				if _, err := os.Stat(filepath.Join(exportDir, "test", "failure.txt")); err != nil {
+					t.Fatalf("failed to find artifact collected on failure: %v", err)
+				}
+				if _, err := os.Stat(filepath.Join(exportDir, "test", "failure.txt"+artifactManifestExt)); err != nil {
+					t.Fatalf("failed to find manifest of exported artifact: %v", err)
+				}
+				if _, err := os.Stat(filepath.Join(exportDir, "test", "success.txt")); err == nil {
+					t.Fatal("unexpected artifact collected on success")
+				}
+			})
+		}
+	})
 	t.Run("post steps", func(t *testing.T) {
 		for _, runMode := range getRunModes() {
 			t.Run(runMode.String(), func(t *testing.T) {
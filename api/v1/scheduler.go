@@ -7,19 +7,27 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
 type TaskScheduler struct {
-	step    MainStep
-	builder *TaskBuilder
+	step          MainStep
+	builder       *TaskBuilder
+	resourceSizer *podResourceSizer
 }
 
 func NewTaskScheduler(step MainStep) *TaskScheduler {
-	return &TaskScheduler{
+	s := &TaskScheduler{
 		step: step,
 	}
+	if step.Strategy != nil {
+		s.resourceSizer = newPodResourceSizer(step.Strategy.Scheduler)
+	}
+	return s
 }
 
 type StrategyKey struct {
@@ -28,6 +36,37 @@ type StrategyKey struct {
 	Env              string
 	SubTaskScheduler *SubTaskScheduler
 	OnFinishSubTask  func(*SubTask)
+	// keyIndexes the indexes in the original keys if the key is a subset of them.
+	keyIndexes []int
+	// resourceSizer sizes the resources of the main containers by the number of the keys.
+	resourceSizer *podResourceSizer
+	// placement places the pod on the nodes.
+	placement *podPlacement
+}
+
+// subset returns the copy of the key that has only the keys at the specified indexes.
+// The container for each key keeps the name in the original pod.
+func (k *StrategyKey) subset(indexes []int) *StrategyKey {
+	key := *k
+	key.Keys = make([]string, 0, len(indexes))
+	key.keyIndexes = make([]int, 0, len(indexes))
+	for _, idx := range indexes {
+		key.Keys = append(key.Keys, k.Keys[idx])
+		key.keyIndexes = append(key.keyIndexes, k.keyIndex(idx))
+	}
+	return &key
+}
+
+func (k *StrategyKey) keyIndex(idx int) int {
+	if k.keyIndexes == nil {
+		return idx
+	}
+	return k.keyIndexes[idx]
+}
+
+// containerName returns the name of the main container to run the key at idx.
+func (k *StrategyKey) containerName(mainContainerName string, idx int) string {
+	return mainContainerName + fmt.Sprintf("%d-%d", k.ConcurrentIdx, k.keyIndex(idx))
 }
 
 func (s *TaskScheduler) Schedule(ctx context.Context, builder *TaskBuilder) (*TaskGroup, error) {
@@ -43,45 +82,162 @@ func (s *TaskScheduler) Schedule(ctx context.Context, builder *TaskBuilder) (*Ta
 	if err != nil {
 		return nil, err
 	}
+	groups, err := placementKeyGroups(strategy.Placement, keys)
+	if err != nil {
+		return nil, err
+	}
+	var podNums []int
+	if strategy.Scheduler.MaxPodNum != 0 {
+		podNums, err = groupPodNums(strategy.Scheduler.MaxPodNum, groups)
+		if err != nil {
+			return nil, err
+		}
+	}
 	subTaskScheduler := NewSubTaskScheduler(strategy.Scheduler.MaxConcurrentNumPerPod)
-	switch {
-	case strategy.Scheduler.MaxPodNum != 0:
-		return s.maxPodNumBasedSchedule(ctx, builder, keys, subTaskScheduler)
-	case strategy.Scheduler.MaxContainersPerPod != 0:
-		return s.maxContainersBasedSchedule(ctx, builder, keys, subTaskScheduler)
+	onFinishSubTask := s.keyProgressLogger(ctx, uint32(len(keys)))
+	tasks := []*Task{}
+	for groupIdx, group := range groups {
+		// the index of the pod is unique in all the groups because the name of the main container is derived from it.
+		firstIdx := uint32(len(tasks))
+		newStrategyKey := func(idx uint32, keys []string) *StrategyKey {
+			return &StrategyKey{
+				ConcurrentIdx:    firstIdx + idx,
+				Keys:             keys,
+				SubTaskScheduler: subTaskScheduler,
+				Env:              strategy.Key.Env,
+				OnFinishSubTask:  onFinishSubTask,
+				resourceSizer:    s.resourceSizer,
+				placement:        group.placement,
+			}
+		}
+		var groupTasks []*Task
+		switch {
+		case strategy.Scheduler.MaxPodNum != 0:
+			groupTasks, err = s.maxPodNumBasedSchedule(ctx, builder, group.keys, podNums[groupIdx], newStrategyKey)
+		case strategy.Scheduler.MaxContainersPerPod != 0 || s.hasNodeSize():
+			var maxContainers int
+			maxContainers, err = s.maxContainersPerPod(ctx, builder, group.keys, newStrategyKey)
+			if err != nil {
+				return nil, err
+			}
+			groupTasks, err = s.maxContainersBasedSchedule(ctx, builder, group.keys, maxContainers, newStrategyKey)
+		default:
+			return nil, fmt.Errorf("kubetest: unsupecified scheduler parameter. maxPodNum or maxContainersPerPod must be specified")
+		}
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, groupTasks...)
+	}
+	taskGroup := NewTaskGroup(tasks)
+	// report the pods that cannot be scheduled before any pod is created.
+	if err := s.resourceSizer.unschedulableError(taskGroup.tasks, func(key *StrategyKey) (corev1.PodSpec, error) {
+		return builder.podSpecWithKey(ctx, &s.step, key)
+	}); err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("kubetest: unsupecified scheduler parameter. maxPodNum or maxContainersPerPod must be specified")
+	return taskGroup, nil
 }
 
-func (s *TaskScheduler) maxContainersBasedSchedule(ctx context.Context, builder *TaskBuilder, keys []string, subTaskScheduler *SubTaskScheduler) (*TaskGroup, error) {
-	strategy := s.step.Strategy
-	maxContainers := uint32(strategy.Scheduler.MaxContainersPerPod)
-
+// keyProgressLogger returns the callback to log the progress of all the keys.
+// The key rescheduled by the retry is counted only once.
+func (s *TaskScheduler) keyProgressLogger(ctx context.Context, keyNum uint32) func(*SubTask) {
 	var (
 		finishedKeyNum uint32
+		finishedKeyMap = map[string]struct{}{}
 		finishedKeyMu  sync.Mutex
-		keyNum         uint32 = uint32(len(keys))
 	)
+	return func(subTask *SubTask) {
+		finishedKeyMu.Lock()
+		defer finishedKeyMu.Unlock()
+		if _, exists := finishedKeyMap[subTask.Name]; exists {
+			return
+		}
+		finishedKeyMap[subTask.Name] = struct{}{}
+		finishedKeyNum++
+		LoggerFromContext(ctx).Info(
+			"%d/%d (%f%%) finished.",
+			finishedKeyNum, keyNum, (float32(finishedKeyNum)/float32(keyNum))*100,
+		)
+	}
+}
+
+// groupPodNums distributes maxPodNum to the groups in proportion to the number of the keys.
+// Each group has at least one pod, and the total number of the pods never exceeds maxPodNum.
+func groupPodNums(maxPodNum int, groups []*placementKeyGroup) ([]int, error) {
+	if len(groups) > maxPodNum {
+		return nil, fmt.Errorf(
+			"kubetest: keys are grouped into %d groups by node selectors, but maxPodNum is %d. each group needs at least one pod",
+			len(groups), maxPodNum,
+		)
+	}
+	keyNum := 0
+	for _, group := range groups {
+		keyNum += len(group.keys)
+	}
+	nums := make([]int, len(groups))
+	if keyNum == 0 {
+		nums[0] = maxPodNum
+		return nums, nil
+	}
+	// the pods left after each group has one are distributed by the largest remainder method.
+	rest := maxPodNum - len(groups)
+	remainders := make([]int, len(groups))
+	assigned := 0
+	for idx, group := range groups {
+		nums[idx] = 1 + rest*len(group.keys)/keyNum
+		remainders[idx] = rest * len(group.keys) % keyNum
+		assigned += nums[idx]
+	}
+	indexes := make([]int, len(groups))
+	for idx := range indexes {
+		indexes[idx] = idx
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return remainders[indexes[i]] > remainders[indexes[j]]
+	})
+	for i := 0; assigned < maxPodNum; i++ {
+		nums[indexes[i]]++
+		assigned++
+	}
+	return nums, nil
+}
+
+func (s *TaskScheduler) hasNodeSize() bool {
+	return s.resourceSizer != nil && len(s.resourceSizer.nodeSize) != 0
+}
+
+// maxContainersPerPod returns the number of the containers per pod.
+// If the node size is specified, the number is picked so that the pod built for the keys fits the node.
+func (s *TaskScheduler) maxContainersPerPod(ctx context.Context, builder *TaskBuilder, keys []string, newStrategyKey func(uint32, []string) *StrategyKey) (int, error) {
+	limit := s.step.Strategy.Scheduler.MaxContainersPerPod
+	if limit == 0 || limit > len(keys) {
+		limit = len(keys)
+	}
+	if !s.hasNodeSize() {
+		return limit, nil
+	}
+	maxContainers, err := s.resourceSizer.maxContainers(limit, func(containerNum int) (corev1.PodSpec, error) {
+		return builder.podSpecWithKey(ctx, &s.step, newStrategyKey(0, keys[:containerNum]))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if maxContainers != limit {
+		LoggerFromContext(ctx).Info("%d containers per pod fit the node size", maxContainers)
+	}
+	return maxContainers, nil
+}
+
+func (s *TaskScheduler) maxContainersBasedSchedule(ctx context.Context, builder *TaskBuilder, keys []string, maxContainersPerPod int, newStrategyKey func(uint32, []string) *StrategyKey) ([]*Task, error) {
+	maxContainers := uint32(maxContainersPerPod)
+	keyNum := uint32(len(keys))
 	if keyNum <= maxContainers {
-		task, err := builder.BuildWithKey(ctx, &s.step, &StrategyKey{
-			ConcurrentIdx:    0,
-			Keys:             keys,
-			SubTaskScheduler: subTaskScheduler,
-			Env:              strategy.Key.Env,
-			OnFinishSubTask: func(_ *SubTask) {
-				finishedKeyMu.Lock()
-				defer finishedKeyMu.Unlock()
-				finishedKeyNum++
-				LoggerFromContext(ctx).Info(
-					"%d/%d (%f%%) finished.",
-					finishedKeyNum, keyNum, (float32(finishedKeyNum)/float32(keyNum))*100,
-				)
-			},
-		})
+		task, err := builder.BuildWithKey(ctx, &s.step, newStrategyKey(0, keys))
 		if err != nil {
 			return nil, err
 		}
-		return NewTaskGroup([]*Task{task}), nil
+		return []*Task{task}, nil
 	}
 	concurrent := keyNum / maxContainers
 	tasks := []*Task{}
@@ -98,21 +254,7 @@ func (s *TaskScheduler) maxContainersBasedSchedule(ctx context.Context, builder
 			// if 'keyNum % maxContaienrs' is zero, taskKeys goes to zero in the last loop.
 			continue
 		}
-		task, err := builder.BuildWithKey(ctx, &s.step, &StrategyKey{
-			ConcurrentIdx:    i,
-			Keys:             taskKeys,
-			SubTaskScheduler: subTaskScheduler,
-			Env:              strategy.Key.Env,
-			OnFinishSubTask: func(_ *SubTask) {
-				finishedKeyMu.Lock()
-				defer finishedKeyMu.Unlock()
-				finishedKeyNum++
-				LoggerFromContext(ctx).Info(
-					"%d/%d (%f%%) finished.",
-					finishedKeyNum, keyNum, (float32(finishedKeyNum)/float32(keyNum))*100,
-				)
-			},
-		})
+		task, err := builder.BuildWithKey(ctx, &s.step, newStrategyKey(i, taskKeys))
 		if err != nil {
 			return nil, err
 		}
@@ -122,43 +264,26 @@ func (s *TaskScheduler) maxContainersBasedSchedule(ctx context.Context, builder
 	if keyNum != sum {
 		return nil, fmt.Errorf("kubetest: failed to schedule: required key num %d but scheduled key num %d", keyNum, sum)
 	}
-	return NewTaskGroup(tasks), nil
+	return tasks, nil
 }
 
-func (s *TaskScheduler) maxPodNumBasedSchedule(ctx context.Context, builder *TaskBuilder, keys []string, subTaskScheduler *SubTaskScheduler) (*TaskGroup, error) {
-	strategy := s.step.Strategy
-	maxPods := uint32(strategy.Scheduler.MaxPodNum)
+func (s *TaskScheduler) maxPodNumBasedSchedule(ctx context.Context, builder *TaskBuilder, keys []string, maxPodNum int, newStrategyKey func(uint32, []string) *StrategyKey) ([]*Task, error) {
+	maxPods := uint32(maxPodNum)
 
 	var (
-		finishedKeyNum uint32
-		finishedKeyMu  sync.Mutex
-		keyNum         uint32 = uint32(len(keys))
-		tasks          []*Task
+		keyNum uint32 = uint32(len(keys))
+		tasks  []*Task
 	)
 	if keyNum < maxPods {
 		// If there are more Pods in use than the number of keys, launch as many Pods as there are keys.
 		for i := uint32(0); i < keyNum; i++ {
-			task, err := builder.BuildWithKey(ctx, &s.step, &StrategyKey{
-				ConcurrentIdx:    i,
-				Keys:             []string{keys[i]},
-				SubTaskScheduler: subTaskScheduler,
-				Env:              strategy.Key.Env,
-				OnFinishSubTask: func(_ *SubTask) {
-					finishedKeyMu.Lock()
-					defer finishedKeyMu.Unlock()
-					finishedKeyNum++
-					LoggerFromContext(ctx).Info(
-						"%d/%d (%f%%) finished.",
-						finishedKeyNum, keyNum, (float32(finishedKeyNum)/float32(keyNum))*100,
-					)
-				},
-			})
+			task, err := builder.BuildWithKey(ctx, &s.step, newStrategyKey(i, []string{keys[i]}))
 			if err != nil {
 				return nil, err
 			}
 			tasks = append(tasks, task)
 		}
-		return NewTaskGroup(tasks), nil
+		return tasks, nil
 	}
 
 	perPodKeyNum := keyNum / maxPods
@@ -174,21 +299,7 @@ func (s *TaskScheduler) maxPodNumBasedSchedule(ctx context.Context, builder *Tas
 		if taskNum == 0 {
 			break
 		}
-		task, err := builder.BuildWithKey(ctx, &s.step, &StrategyKey{
-			ConcurrentIdx:    i,
-			Keys:             taskKeys,
-			SubTaskScheduler: subTaskScheduler,
-			Env:              strategy.Key.Env,
-			OnFinishSubTask: func(_ *SubTask) {
-				finishedKeyMu.Lock()
-				defer finishedKeyMu.Unlock()
-				finishedKeyNum++
-				LoggerFromContext(ctx).Info(
-					"%d/%d (%f%%) finished.",
-					finishedKeyNum, keyNum, (float32(finishedKeyNum)/float32(keyNum))*100,
-				)
-			},
-		})
+		task, err := builder.BuildWithKey(ctx, &s.step, newStrategyKey(i, taskKeys))
 		if err != nil {
 			return nil, err
 		}
@@ -198,7 +309,7 @@ func (s *TaskScheduler) maxPodNumBasedSchedule(ctx context.Context, builder *Tas
 	if keyNum != sum {
 		return nil, fmt.Errorf("kubetest: failed to schedule: required key num %d but scheduled key num %d", keyNum, sum)
 	}
-	return NewTaskGroup(tasks), nil
+	return tasks, nil
 }
 
 func (s *TaskScheduler) getScheduleKeys(ctx context.Context, builder *TaskBuilder, source StrategyKeySource) ([]string, error) {
@@ -221,6 +332,8 @@ func (s *TaskScheduler) dynamicKeys(ctx context.Context, builder *TaskBuilder, s
 	keyTask, err := builder.Build(ctx, &MainStep{
 		TTLSecondsAfterFinished: source.TTLSecondsAfterFinished,
 		Template:                source.Template,
+		// the task to get the keys is retried in the same way as the main step.
+		RetryPolicy: s.step.RetryPolicy,
 	})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,179 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// podResourceSizer sizes the resources of the main containers by the number of the containers in the pod.
+type podResourceSizer struct {
+	podBudget     *corev1.ResourceRequirements
+	perKey        *corev1.ResourceRequirements
+	maxConcurrent int
+	nodeSize      corev1.ResourceList
+}
+
+// newPodResourceSizer returns nil if the resources aren't specified.
+func newPodResourceSizer(scheduler Scheduler) *podResourceSizer {
+	if scheduler.Resources == nil {
+		return nil
+	}
+	return &podResourceSizer{
+		podBudget:     scheduler.Resources.PodBudget,
+		perKey:        scheduler.Resources.PerKey,
+		maxConcurrent: scheduler.MaxConcurrentNumPerPod,
+		nodeSize:      scheduler.Resources.NodeSize,
+	}
+}
+
+// containerResources returns the resources of each main container when the pod has containerNum main containers.
+// The resources that are not specified by podBudget or perKey are inherited from base.
+func (s *podResourceSizer) containerResources(base corev1.ResourceRequirements, containerNum int) corev1.ResourceRequirements {
+	if containerNum <= 0 {
+		return base
+	}
+	res := *base.DeepCopy()
+	switch {
+	case s.podBudget != nil:
+		res.Requests = mergeResourceList(res.Requests, scaleResourceList(s.podBudget.Requests, 1, containerNum))
+		res.Limits = mergeResourceList(res.Limits, scaleResourceList(s.podBudget.Limits, 1, containerNum))
+	case s.perKey != nil:
+		// only maxConcurrent keys run at the same time, so the pod requests the resources for them.
+		concurrent := containerNum
+		if s.maxConcurrent > 0 && s.maxConcurrent < concurrent {
+			concurrent = s.maxConcurrent
+		}
+		res.Requests = mergeResourceList(res.Requests, scaleResourceList(s.perKey.Requests, concurrent, containerNum))
+		res.Limits = mergeResourceList(res.Limits, s.perKey.Limits)
+	}
+	return res
+}
+
+// maxContainers returns the maximum number of the main containers up to limit that the pod fits the node.
+// podSpec returns the spec of the pod that has the specified number of the main containers in the same way as the job is built.
+// If the pod doesn't fit the node even if it has a main container, returns 1 to report it as unschedulable.
+func (s *podResourceSizer) maxContainers(limit int, podSpec func(containerNum int) (corev1.PodSpec, error)) (int, error) {
+	if s == nil || len(s.nodeSize) == 0 {
+		return limit, nil
+	}
+	for num := limit; num > 1; num-- {
+		spec, err := podSpec(num)
+		if err != nil {
+			return 0, err
+		}
+		if len(s.exceededResources(podRequests(spec))) == 0 {
+			return num, nil
+		}
+	}
+	return 1, nil
+}
+
+// exceededResources returns the descriptions of the requests that exceed the node size.
+func (s *podResourceSizer) exceededResources(requests corev1.ResourceList) []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.nodeSize))
+	for name := range s.nodeSize {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	exceeded := []string{}
+	for _, name := range names {
+		capacity := s.nodeSize[corev1.ResourceName(name)]
+		request, exists := requests[corev1.ResourceName(name)]
+		if !exists || request.Cmp(capacity) <= 0 {
+			continue
+		}
+		exceeded = append(exceeded, fmt.Sprintf("%s %s > %s", name, request.String(), capacity.String()))
+	}
+	return exceeded
+}
+
+// unschedulableError reports the pods whose requests exceed the node size.
+// tasks must be built with the strategy key, and podSpec returns the spec of the pod to run the key.
+func (s *podResourceSizer) unschedulableError(tasks []*Task, podSpec func(*StrategyKey) (corev1.PodSpec, error)) error {
+	if s == nil || len(s.nodeSize) == 0 {
+		return nil
+	}
+	msgs := []string{}
+	for _, task := range tasks {
+		spec, err := podSpec(task.strategyKey)
+		if err != nil {
+			return err
+		}
+		exceeded := s.exceededResources(podRequests(spec))
+		if len(exceeded) == 0 {
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf(
+			"pod %d ( keys: %s ) requests %s",
+			task.strategyKey.ConcurrentIdx, strings.Join(task.strategyKey.Keys, ","), strings.Join(exceeded, ", "),
+		))
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("kubetest: %d pods cannot be scheduled on the node:\n%s", len(msgs), strings.Join(msgs, "\n"))
+}
+
+// podRequests returns the effective requests of the pod.
+// The init containers run one by one before the containers, so the larger of them is requested.
+func podRequests(spec corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		for name, quantity := range container.Resources.Requests {
+			total := requests[name]
+			total.Add(quantity)
+			requests[name] = total
+		}
+	}
+	for _, container := range spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if total, exists := requests[name]; !exists || quantity.Cmp(total) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	return requests
+}
+
+// scaleResourceList returns the list whose quantities are multiplied by numerator/denominator.
+func scaleResourceList(list corev1.ResourceList, numerator, denominator int) corev1.ResourceList {
+	if list == nil {
+		return nil
+	}
+	scaled := corev1.ResourceList{}
+	for name, quantity := range list {
+		if name == corev1.ResourceCPU {
+			value := quantity.MilliValue() * int64(numerator) / int64(denominator)
+			scaled[name] = *resource.NewMilliQuantity(value, quantity.Format)
+			continue
+		}
+		value := quantity.Value() * int64(numerator) / int64(denominator)
+		scaled[name] = *resource.NewQuantity(value, quantity.Format)
+	}
+	return scaled
+}
+
+// mergeResourceList overwrites the quantities of base by src.
+func mergeResourceList(base, src corev1.ResourceList) corev1.ResourceList {
+	if len(src) == 0 {
+		return base
+	}
+	merged := corev1.ResourceList{}
+	for name, quantity := range base {
+		merged[name] = quantity
+	}
+	for name, quantity := range src {
+		merged[name] = quantity
+	}
+	return merged
+}
@@ -0,0 +1,198 @@
+package v1
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestPodResourceSizer(t *testing.T) {
+	t.Run("podBudget", func(t *testing.T) {
+		sizer := newPodResourceSizer(Scheduler{
+			Resources: &SchedulerResources{
+				PodBudget: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("4"),
+						corev1.ResourceMemory: resource.MustParse("8Gi"),
+					},
+				},
+			},
+		})
+		res := sizer.containerResources(corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+		}, 4)
+		for name, expected := range map[corev1.ResourceName]string{
+			corev1.ResourceCPU:              "1",
+			corev1.ResourceMemory:           "2Gi",
+			corev1.ResourceEphemeralStorage: "1Gi",
+		} {
+			quantity := res.Requests[name]
+			if quantity.Cmp(resource.MustParse(expected)) != 0 {
+				t.Fatalf("expected %s %s but got %s", name, expected, quantity.String())
+			}
+		}
+	})
+	t.Run("perKey", func(t *testing.T) {
+		sizer := newPodResourceSizer(Scheduler{
+			MaxConcurrentNumPerPod: 2,
+			Resources: &SchedulerResources{
+				PerKey: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+					Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+				},
+			},
+		})
+		res := sizer.containerResources(corev1.ResourceRequirements{}, 8)
+		request := res.Requests[corev1.ResourceCPU]
+		if request.Cmp(resource.MustParse("500m")) != 0 {
+			t.Fatalf("requests of 2 concurrent keys must be divided by 8 containers but got %s", request.String())
+		}
+		limit := res.Limits[corev1.ResourceCPU]
+		if limit.Cmp(resource.MustParse("2")) != 0 {
+			t.Fatalf("limits of a key must be applied to each container but got %s", limit.String())
+		}
+	})
+	t.Run("maxContainers", func(t *testing.T) {
+		sizer := newPodResourceSizer(Scheduler{
+			Resources: &SchedulerResources{
+				NodeSize: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+			},
+		})
+		main := corev1.Container{
+			Name: "test",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			},
+		}
+		podSpec := func(containerNum int) (corev1.PodSpec, error) {
+			spec := corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: "sidecar",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+						},
+					},
+				},
+			}
+			for i := 0; i < containerNum; i++ {
+				spec.Containers = append(spec.Containers, main)
+			}
+			return spec, nil
+		}
+		for limit, expected := range map[int]int{16: 3, 2: 2} {
+			num, err := sizer.maxContainers(limit, podSpec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if num != expected {
+				t.Fatalf("expected %d containers but got %d", expected, num)
+			}
+		}
+	})
+}
+
+func TestSchedulerResources(t *testing.T) {
+	ctx := WithLogger(context.Background(), NewLogger(io.Discard, LogLevelInfo))
+	newTestJob := func(sidecarCPU string) TestJob {
+		return TestJob{
+			ObjectMeta: testjobObjectMeta(),
+			Spec: TestJobSpec{
+				MainStep: MainStep{
+					Strategy: &Strategy{
+						Key: StrategyKeySpec{
+							Env:    "TEST",
+							Source: StrategyKeySource{Static: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}},
+						},
+						Scheduler: Scheduler{
+							MaxContainersPerPod:    16,
+							MaxConcurrentNumPerPod: 2,
+							Resources: &SchedulerResources{
+								PerKey: &corev1.ResourceRequirements{
+									Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+								},
+								NodeSize: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+							},
+						},
+					},
+					Template: TestJobTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"},
+						Main:       "test",
+						Spec: TestJobPodSpec{
+							Containers: []TestJobContainer{
+								{Container: corev1.Container{Name: "test", Image: "alpine", Command: []string{"echo"}}},
+								{Container: corev1.Container{
+									Name:    "sidecar",
+									Image:   "alpine",
+									Command: []string{"sleep"},
+									Resources: corev1.ResourceRequirements{
+										Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(sidecarCPU)},
+									},
+								}},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	schedule := func(t *testing.T, testjob TestJob) (*TaskGroup, error) {
+		t.Helper()
+		clientset, err := kubernetes.NewForConfig(getConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder := NewTaskBuilder(getConfig(), NewResourceManager(clientset, testjob), "default", RunModeDryRun)
+		return NewTaskScheduler(testjob.Spec.MainStep).Schedule(ctx, builder)
+	}
+	t.Run("fit node size", func(t *testing.T) {
+		// the pod that has 2 or more containers requests 4 cpu for 2 concurrent keys and 1 cpu for the sidecar,
+		// so only a single container fits the node.
+		taskGroup, err := schedule(t, newTestJob("1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(taskGroup.tasks) != 10 {
+			t.Fatalf("expected 10 pods but got %d", len(taskGroup.tasks))
+		}
+		for _, task := range taskGroup.tasks {
+			requests := podRequests(task.job.Spec().Template.Spec)
+			cpu := requests[corev1.ResourceCPU]
+			if cpu.Cmp(resource.MustParse("3")) != 0 {
+				t.Fatalf("unexpected requests of pod: %s", cpu.String())
+			}
+		}
+	})
+	t.Run("podBudget requires maxContainersPerPod", func(t *testing.T) {
+		testjob := newTestJob("1")
+		scheduler := &testjob.Spec.MainStep.Strategy.Scheduler
+		scheduler.MaxContainersPerPod = 0
+		scheduler.Resources.PerKey = nil
+		scheduler.Resources.PodBudget = &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+		}
+		err := NewValidator().ValidateScheduler(*scheduler)
+		if err == nil || !strings.Contains(err.Error(), "maxContainersPerPod must be specified") {
+			t.Fatalf("expected validation error but got %v", err)
+		}
+		scheduler.MaxContainersPerPod = 4
+		if err := NewValidator().ValidateScheduler(*scheduler); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("report unschedulable pods", func(t *testing.T) {
+		_, err := schedule(t, newTestJob("3"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "10 pods cannot be scheduled") || !strings.Contains(err.Error(), "cpu 5 > 4") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,267 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const sharedStorageVolumeName = "kubetest-shared-storage"
+
+// sharedStorageMountPath is the path to mount the shared storage on the preinit container to stage files.
+var sharedStorageMountPath = filepath.Join("/", "tmp", "shared-storage")
+
+// sharedStorage stages the repositories and the artifacts on the volume shared by the pods.
+// The staged files are placed under the directory of the run ( e.g. <runID>/repo/<name> ),
+// and the containers mount them as read-only by subPath.
+type sharedStorage struct {
+	spec   *SharedStorageSpec
+	runID  string
+	mu     sync.Mutex
+	stages map[string]*sharedStage
+	// cleanupTargets the preinit containers that staged the files by node name.
+	// The node name is empty if the storage isn't node-local.
+	cleanupTargets map[string]*sharedCleanupTarget
+}
+
+// sharedCleanupTarget is used to remove the staged files by the same image as the preinit container.
+type sharedCleanupTarget struct {
+	nodeName        string
+	image           string
+	imagePullPolicy corev1.PullPolicy
+}
+
+type sharedStage struct {
+	mu     sync.Mutex
+	staged bool
+}
+
+// sharedStageTarget is the local file to stage on the shared storage.
+type sharedStageTarget struct {
+	src string
+	// path relative path from the root of the shared storage.
+	path string
+	// archived if true, src is the archive file and the extracted files are staged.
+	archived bool
+}
+
+func newSharedStorage(spec *SharedStorageSpec, runID string) *sharedStorage {
+	return &sharedStorage{
+		spec:   spec,
+		runID:  runID,
+		stages: map[string]*sharedStage{},
+
+		cleanupTargets: map[string]*sharedCleanupTarget{},
+	}
+}
+
+func (s *sharedStorage) repoPath(name string) string {
+	return path.Join(s.runID, "repo", name)
+}
+
+func (s *sharedStorage) artifactPath(name string) string {
+	return path.Join(s.runID, "artifact", name)
+}
+
+func (s *sharedStorage) volume() corev1.Volume {
+	return corev1.Volume{
+		Name: sharedStorageVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: s.spec.PersistentVolumeClaim,
+			HostPath:              s.spec.HostPath,
+		},
+	}
+}
+
+// volumeMount mounts the staged path on mountPath as read-only.
+func (s *sharedStorage) volumeMount(mountPath, stagedPath string) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      sharedStorageVolumeName,
+		MountPath: mountPath,
+		SubPath:   stagedPath,
+		ReadOnly:  true,
+	}
+}
+
+func (s *sharedStorage) preInitVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      sharedStorageVolumeName,
+		MountPath: sharedStorageMountPath,
+	}
+}
+
+// stageKey returns the key to stage the target once.
+// The node-local cache is staged once for each node.
+func (s *sharedStorage) stageKey(exec JobExecutor, target *sharedStageTarget) string {
+	if s.spec.HostPath != nil {
+		return fmt.Sprintf("%s:%s", exec.Pod().Spec.NodeName, target.path)
+	}
+	return target.path
+}
+
+func (s *sharedStorage) stageByKey(key string) *sharedStage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stage, exists := s.stages[key]
+	if !exists {
+		stage = &sharedStage{}
+		s.stages[key] = stage
+	}
+	return stage
+}
+
+// stage copies the target to the shared storage through the preinit container.
+// If the target has already been staged, do nothing. The pods that need the same target wait until it's staged.
+func (s *sharedStorage) stage(ctx context.Context, exec JobExecutor, target *sharedStageTarget) error {
+	stage := s.stageByKey(s.stageKey(exec, target))
+	stage.mu.Lock()
+	defer stage.mu.Unlock()
+	if stage.staged {
+		return nil
+	}
+	s.addCleanupTarget(exec)
+	dst := filepath.Join(sharedStorageMountPath, target.path)
+	// copy to the temporary directory and move it to dst after the copy finished,
+	// so that dst doesn't have the incomplete files.
+	tmpDir := dst + ".staging"
+	if err := s.runCommand(ctx, exec, []string{
+		"rm", "-rf", tmpDir,
+		"&&",
+		"mkdir", "-p", tmpDir,
+	}); err != nil {
+		return err
+	}
+	if err := exec.CopyTo(ctx, target.src, tmpDir); err != nil {
+		return fmt.Errorf("kubetest: failed to stage %s on shared storage: %w", target.path, err)
+	}
+	copiedPath := filepath.Join(tmpDir, filepath.Base(target.src))
+	var cmd []string
+	if target.archived {
+		extractedPath := filepath.Join(tmpDir, "extracted")
+		cmd = []string{
+			"mkdir", "-p", extractedPath,
+			"&&",
+			"tar", "-zxf", copiedPath, "-C", extractedPath,
+			"&&",
+			"mv", extractedPath, dst,
+		}
+	} else {
+		cmd = []string{"mv", copiedPath, dst}
+	}
+	cmd = append(cmd, "&&", "rm", "-rf", tmpDir)
+	if err := s.runCommand(ctx, exec, cmd); err != nil {
+		return err
+	}
+	LoggerFromContext(ctx).Info("staged %s on shared storage", target.path)
+	stage.staged = true
+	return nil
+}
+
+func (s *sharedStorage) addCleanupTarget(exec JobExecutor) {
+	var nodeName string
+	if s.spec.HostPath != nil {
+		nodeName = exec.Pod().Spec.NodeName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.cleanupTargets[nodeName]; exists {
+		return
+	}
+	container := exec.Container()
+	s.cleanupTargets[nodeName] = &sharedCleanupTarget{
+		nodeName:        nodeName,
+		image:           container.Image,
+		imagePullPolicy: container.ImagePullPolicy,
+	}
+}
+
+// cleanup removes the directory of the run from the shared storage.
+// The pods that staged the files have already finished, so the job that mounts the shared storage removes it.
+// If the storage is node-local, the job runs on each node that has the staged files.
+func (s *sharedStorage) cleanup(ctx context.Context, namespace string, build func(*batchv1.Job) (Job, error)) error {
+	s.mu.Lock()
+	targets := make([]*sharedCleanupTarget, 0, len(s.cleanupTargets))
+	for _, target := range s.cleanupTargets {
+		targets = append(targets, target)
+	}
+	s.mu.Unlock()
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].nodeName < targets[j].nodeName
+	})
+	errs := []string{}
+	for _, target := range targets {
+		if err := s.runCleanupJob(ctx, namespace, target, build); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("kubetest: failed to cleanup shared storage: %s", strings.Join(errs, ":"))
+	}
+	return nil
+}
+
+func (s *sharedStorage) runCleanupJob(ctx context.Context, namespace string, target *sharedCleanupTarget, build func(*batchv1.Job) (Job, error)) error {
+	job, err := build(s.cleanupJob(namespace, target))
+	if err != nil {
+		return err
+	}
+	LoggerFromContext(ctx).Debug("remove %s from shared storage on node(%s)", s.runID, target.nodeName)
+	return job.RunWithExecutionHandler(ctx, func(ctx context.Context, execs []JobExecutor) error {
+		for _, exec := range execs {
+			if out, err := exec.Output(ctx); err != nil {
+				return fmt.Errorf("%s: %w", string(out), err)
+			}
+		}
+		return nil
+	}, nil)
+}
+
+func (s *sharedStorage) cleanupJob(namespace string, target *sharedCleanupTarget) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "kubetest-shared-storage-cleanup-",
+			Namespace:    namespace,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{runLabel: s.runID},
+				},
+				Spec: corev1.PodSpec{
+					NodeName:      target.nodeName,
+					RestartPolicy: corev1.RestartPolicyNever,
+					Volumes:       []corev1.Volume{s.volume()},
+					Containers: []corev1.Container{
+						{
+							Name:            "cleanup",
+							Image:           target.image,
+							ImagePullPolicy: target.imagePullPolicy,
+							Command:         []string{"rm", "-rf", filepath.Join(sharedStorageMountPath, s.runID)},
+							VolumeMounts:    []corev1.VolumeMount{s.preInitVolumeMount()},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *sharedStorage) runCommand(ctx context.Context, exec JobExecutor, cmd []string) error {
+	LoggerFromContext(ctx).Debug("run '%s' to stage on shared storage", strings.Join(cmd, " "))
+	out, err := exec.PrepareCommand(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to stage on shared storage. %s: %w", string(out), err)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package v1
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type nodeJobExecutor struct {
+	*localJobExecutor
+	nodeName   string
+	copiedSrcs []string
+}
+
+func (e *nodeJobExecutor) Pod() *corev1.Pod {
+	return &corev1.Pod{Spec: corev1.PodSpec{NodeName: e.nodeName}}
+}
+
+func (e *nodeJobExecutor) CopyTo(ctx context.Context, src, dst string) error {
+	e.copiedSrcs = append(e.copiedSrcs, src)
+	return e.localJobExecutor.CopyTo(ctx, src, dst)
+}
+
+func newNodeJobExecutor(t *testing.T, rootDir, nodeName string) *nodeJobExecutor {
+	t.Helper()
+	return &nodeJobExecutor{
+		localJobExecutor: &localJobExecutor{
+			rootDir:   rootDir,
+			container: corev1.Container{Name: "preinit"},
+		},
+		nodeName: nodeName,
+	}
+}
+
+func writeRepoArchive(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSharedStorageStage(t *testing.T) {
+	srcDir := t.TempDir()
+	archivePath := filepath.Join(srcDir, "repo.tar.gz")
+	writeRepoArchive(t, archivePath, map[string]string{"main.go": "package main"})
+	artifactPath := filepath.Join(srcDir, "result.txt")
+	if err := os.WriteFile(artifactPath, []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("persistentVolumeClaim", func(t *testing.T) {
+		shared := newSharedStorage(&SharedStorageSpec{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "cache"},
+		}, "run")
+		targets := []*sharedStageTarget{
+			{src: archivePath, path: shared.repoPath("repo"), archived: true},
+			{src: artifactPath, path: shared.artifactPath("result")},
+		}
+		rootDir := t.TempDir()
+		ctx := WithLogger(context.Background(), NewLogger(io.Discard, LogLevelInfo))
+		execs := []*nodeJobExecutor{
+			newNodeJobExecutor(t, rootDir, "node-a"),
+			newNodeJobExecutor(t, rootDir, "node-b"),
+		}
+		for _, exec := range execs {
+			for _, target := range targets {
+				if err := shared.stage(ctx, exec, target); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if len(execs[0].copiedSrcs) != 2 {
+			t.Fatalf("failed to stage: %v", execs[0].copiedSrcs)
+		}
+		if len(execs[1].copiedSrcs) != 0 {
+			t.Fatalf("staged files must be reused: %v", execs[1].copiedSrcs)
+		}
+		mainFile, err := os.ReadFile(filepath.Join(rootDir, sharedStorageMountPath, "run", "repo", "repo", "main.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(mainFile) != "package main" {
+			t.Fatalf("unexpected repository file: %s", mainFile)
+		}
+		result, err := os.ReadFile(filepath.Join(rootDir, sharedStorageMountPath, "run", "artifact", "result"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(result) != "ok" {
+			t.Fatalf("unexpected artifact: %s", result)
+		}
+		if _, err := os.Stat(filepath.Join(rootDir, sharedStorageMountPath, "run", "repo", "repo.staging")); !os.IsNotExist(err) {
+			t.Fatalf("temporary directory must be removed: %v", err)
+		}
+	})
+	t.Run("hostPath", func(t *testing.T) {
+		shared := newSharedStorage(&SharedStorageSpec{
+			HostPath: &corev1.HostPathVolumeSource{Path: "/var/cache/kubetest"},
+		}, "run")
+		target := &sharedStageTarget{src: archivePath, path: shared.repoPath("repo"), archived: true}
+		ctx := WithLogger(context.Background(), NewLogger(io.Discard, LogLevelInfo))
+		nodeARootDir := t.TempDir()
+		execs := []*nodeJobExecutor{
+			newNodeJobExecutor(t, nodeARootDir, "node-a"),
+			newNodeJobExecutor(t, nodeARootDir, "node-a"),
+			newNodeJobExecutor(t, t.TempDir(), "node-b"),
+		}
+		for _, exec := range execs {
+			if err := shared.stage(ctx, exec, target); err != nil {
+				t.Fatal(err)
+			}
+		}
+		copied := []int{len(execs[0].copiedSrcs), len(execs[1].copiedSrcs), len(execs[2].copiedSrcs)}
+		if copied[0] != 1 || copied[1] != 0 || copied[2] != 1 {
+			t.Fatalf("node-local cache must be staged once for each node: %v", copied)
+		}
+	})
+}
+
+func TestSharedStorageCleanup(t *testing.T) {
+	srcDir := t.TempDir()
+	artifactPath := filepath.Join(srcDir, "result.txt")
+	if err := os.WriteFile(artifactPath, []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithLogger(context.Background(), NewLogger(io.Discard, LogLevelInfo))
+	cleanup := func(t *testing.T, shared *sharedStorage) []*batchv1.Job {
+		t.Helper()
+		jobs := []*batchv1.Job{}
+		if err := shared.cleanup(ctx, "default", func(job *batchv1.Job) (Job, error) {
+			jobs = append(jobs, job)
+			return &dryRunJob{job: job}, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return jobs
+	}
+	t.Run("nothing staged", func(t *testing.T) {
+		shared := newSharedStorage(&SharedStorageSpec{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "cache"},
+		}, "run")
+		if jobs := cleanup(t, shared); len(jobs) != 0 {
+			t.Fatalf("unexpected cleanup jobs: %d", len(jobs))
+		}
+	})
+	t.Run("persistentVolumeClaim", func(t *testing.T) {
+		shared := newSharedStorage(&SharedStorageSpec{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "cache"},
+		}, "run")
+		target := &sharedStageTarget{src: artifactPath, path: shared.artifactPath("result")}
+		for _, nodeName := range []string{"node-a", "node-b"} {
+			if err := shared.stage(ctx, newNodeJobExecutor(t, t.TempDir(), nodeName), target); err != nil {
+				t.Fatal(err)
+			}
+		}
+		jobs := cleanup(t, shared)
+		if len(jobs) != 1 {
+			t.Fatalf("expected a cleanup job but got %d", len(jobs))
+		}
+		spec := jobs[0].Spec.Template.Spec
+		if spec.NodeName != "" {
+			t.Fatalf("cleanup job must not be pinned: %s", spec.NodeName)
+		}
+		if len(spec.Volumes) != 1 || spec.Volumes[0].PersistentVolumeClaim.ClaimName != "cache" {
+			t.Fatalf("unexpected volumes: %+v", spec.Volumes)
+		}
+		cmd := strings.Join(spec.Containers[0].Command, " ")
+		if cmd != "rm -rf "+filepath.Join(sharedStorageMountPath, "run") {
+			t.Fatalf("unexpected cleanup command: %s", cmd)
+		}
+	})
+	t.Run("hostPath", func(t *testing.T) {
+		shared := newSharedStorage(&SharedStorageSpec{
+			HostPath: &corev1.HostPathVolumeSource{Path: "/var/cache/kubetest"},
+		}, "run")
+		target := &sharedStageTarget{src: artifactPath, path: shared.artifactPath("result")}
+		for _, nodeName := range []string{"node-b", "node-a", "node-b"} {
+			if err := shared.stage(ctx, newNodeJobExecutor(t, t.TempDir(), nodeName), target); err != nil {
+				t.Fatal(err)
+			}
+		}
+		jobs := cleanup(t, shared)
+		if len(jobs) != 2 {
+			t.Fatalf("expected a cleanup job for each node but got %d", len(jobs))
+		}
+		for idx, nodeName := range []string{"node-a", "node-b"} {
+			if jobs[idx].Spec.Template.Spec.NodeName != nodeName {
+				t.Fatalf("cleanup job must run on %s but got %s", nodeName, jobs[idx].Spec.Template.Spec.NodeName)
+			}
+		}
+	})
+}
+
+func TestSharedStorageTaskContainer(t *testing.T) {
+	shared := newSharedStorage(&SharedStorageSpec{
+		PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "cache"},
+	}, "run")
+	container := TestJobContainer{
+		Container: corev1.Container{
+			Name: "test",
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: "repo", MountPath: "/go/src"},
+				{Name: "artifact", MountPath: "/tmp/bin"},
+				{Name: "token", MountPath: "/etc/token"},
+			},
+		},
+	}
+	volumes := []TestJobVolume{
+		{Name: "repo", TestJobVolumeSource: TestJobVolumeSource{Repo: &RepositoryVolumeSource{Name: "repo"}}},
+		{Name: "artifact", TestJobVolumeSource: TestJobVolumeSource{Artifact: &ArtifactVolumeSource{Name: "bin"}}},
+		{Name: "token", TestJobVolumeSource: TestJobVolumeSource{Token: &TokenVolumeSource{Name: "token"}}},
+	}
+	c := newTaskContainer(container, volumes, shared)
+	if len(c.repoNameToArchiveMountPath) != 0 || len(c.artifactNameToMountPath) != 0 {
+		t.Fatal("staged repository and artifact must not be copied")
+	}
+	if len(c.tokenNameToMountPath) != 1 {
+		t.Fatal("token must be copied")
+	}
+	expected := []corev1.VolumeMount{
+		{Name: sharedStorageVolumeName, MountPath: "/go/src", SubPath: "run/repo/repo", ReadOnly: true},
+		{Name: sharedStorageVolumeName, MountPath: "/tmp/bin", SubPath: "run/artifact/bin", ReadOnly: true},
+	}
+	for idx, mount := range expected {
+		if container.VolumeMounts[idx] != mount {
+			t.Fatalf("unexpected volume mount: %+v", container.VolumeMounts[idx])
+		}
+	}
+	volume, exists := c.podSpecVolumeMap[sharedStorageVolumeName]
+	if !exists {
+		t.Fatal("failed to find shared storage volume")
+	}
+	if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != "cache" {
+		t.Fatalf("unexpected shared storage volume: %+v", volume)
+	}
+	if _, exists := c.preInitVolumeMountMap[sharedStorageVolumeName]; !exists {
+		t.Fatal("shared storage must be mounted on preinit container to stage files")
+	}
+}
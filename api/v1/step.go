@@ -16,4 +16,5 @@ type Step interface {
 	GetType() StepType
 	GetTTLSecondsAfterFinished() *int32
 	GetTemplate() TestJobTemplateSpec
+	GetRetryPolicy() *RetryPolicy
 }
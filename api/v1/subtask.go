@@ -5,7 +5,9 @@ package v1
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os/exec"
 	"strings"
 	"sync"
 	"time"
@@ -17,11 +19,14 @@ import (
 type SubTask struct {
 	Name         string
 	TaskName     string
+	StepType     StepType
 	KeyEnvName   string
 	OnFinish     func(*SubTask)
 	exec         JobExecutor
 	isMain       bool
-	copyArtifact func(context.Context, *SubTask) error
+	copyArtifact func(context.Context, *SubTask, TaskResultStatus) error
+	// artifactKeeper is the executor of the helper container that mounts the volumes of the artifacts.
+	artifactKeeper JobExecutor
 }
 
 func (t *SubTask) outputError(logGroup Logger, baseErr error) {
@@ -46,13 +51,28 @@ func (t *SubTask) outputError(logGroup Logger, baseErr error) {
 	}
 }
 
+func (t *SubTask) logFields() LogFields {
+	fields := LogFields{
+		Step:      t.StepType,
+		Task:      t.TaskName,
+		Container: t.exec.Container().Name,
+	}
+	if t.KeyEnvName != "" {
+		fields.Key = t.Name
+	}
+	if pod := t.exec.Pod(); pod != nil {
+		fields.Pod = pod.Name
+	}
+	return fields
+}
+
 const (
 	terminationLog = "kubetest task is completed"
 )
 
 func (t *SubTask) Run(ctx context.Context) *SubTaskResult {
 	logger := LoggerFromContext(ctx)
-	logGroup := logger.Group()
+	logGroup := logger.GroupWithFields(t.logFields())
 	ctx = WithLogger(ctx, logGroup)
 	defer func() {
 		if err := t.exec.TerminationLog(ctx, terminationLog); err != nil {
@@ -63,21 +83,24 @@ func (t *SubTask) Run(ctx context.Context) *SubTaskResult {
 			t.OnFinish(t)
 		}
 	}()
+	container := t.exec.Container()
+	logGroup.Debug("container: %s", container.Name)
+	logGroup.Log(t.command(container))
+	w := logGroup.Writer()
 	start := time.Now()
-	out, err := t.exec.Output(ctx)
+	out, err := t.exec.OutputStream(ctx, w)
+	w.Close()
 	result := &SubTaskResult{
+		StartedAt:   start,
 		ElapsedTime: time.Since(start),
 		Out:         out,
 		Err:         err,
 		Name:        t.Name,
-		Container:   t.exec.Container(),
+		Container:   container,
 		Pod:         t.exec.Pod(),
 		IsMain:      t.isMain,
 		KeyEnvName:  t.KeyEnvName,
 	}
-	logGroup.Debug("container: %s", t.exec.Container().Name)
-	logGroup.Log(result.Command())
-	logGroup.Log(string(out))
 	if err == nil {
 		result.Status = TaskResultSuccess
 	} else {
@@ -89,9 +112,9 @@ func (t *SubTask) Run(ctx context.Context) *SubTaskResult {
 	} else {
 		logGroup.Info("elapsed time: %f sec.", result.ElapsedTime.Seconds())
 	}
-	if err := t.copyArtifact(ctx, t); err != nil {
+	if err := t.copyArtifact(ctx, t, result.Status); err != nil {
+		// the artifact error is reported separately so as not to hide the result of the test.
 		logGroup.Error("failed to copy artifact: %s", err.Error())
-		result.Status = TaskResultFailure
 		result.ArtifactErr = err
 	}
 	return result
@@ -157,6 +180,7 @@ func (s TaskResultStatus) MarshalJSON() ([]byte, error) {
 
 type SubTaskResult struct {
 	Status      TaskResultStatus
+	StartedAt   time.Time
 	ElapsedTime time.Duration
 	Out         []byte
 	Err         error
@@ -168,25 +192,42 @@ type SubTaskResult struct {
 	IsMain      bool
 }
 
-func (r *SubTaskResult) Error() error {
-	errs := []string{}
-	if r.Err != nil {
-		errs = append(errs, r.Err.Error())
+// exited returns true if the command of the container has exited with the exit code whether it passed or failed.
+// If the command was interrupted ( e.g. the pod was lost ), returns false.
+func (r *SubTaskResult) exited() bool {
+	err := r.Err
+	if err == nil {
+		return true
 	}
-	if r.ArtifactErr != nil {
-		errs = append(errs, r.ArtifactErr.Error())
+	var failedJob *kubejob.FailedJob
+	if errors.As(err, &failedJob) {
+		err = failedJob.Reason
 	}
-	if len(errs) > 0 {
-		return fmt.Errorf(strings.Join(errs, ":"))
+	var cmdErr *kubejob.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.IsExitError()
 	}
-	return nil
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// Error returns the error of the test. The error of collecting the artifacts is ArtifactErr.
+func (r *SubTaskResult) Error() error {
+	return r.Err
 }
 
 func (r *SubTaskResult) Command() string {
-	cmd := strings.Join(append(r.Container.Command, r.Container.Args...), " ")
-	envName := r.KeyEnvName
+	return command(r.Container, r.KeyEnvName, r.Name)
+}
+
+func (t *SubTask) command(container corev1.Container) string {
+	return command(container, t.KeyEnvName, t.Name)
+}
+
+func command(container corev1.Container, envName, key string) string {
+	cmd := strings.Join(append(container.Command, container.Args...), " ")
 	if envName != "" {
-		return fmt.Sprintf("[%s:%s] ", envName, r.Name) + cmd
+		return fmt.Sprintf("[%s:%s] ", envName, key) + cmd
 	}
 	return cmd
 }
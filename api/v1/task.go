@@ -14,16 +14,19 @@ import (
 	"github.com/lestrrat-go/backoff"
 	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type Task struct {
 	Name              string
+	StepType          StepType
 	OnFinishSubTask   func(*SubTask)
 	job               Job
-	copyArtifact      func(context.Context, *SubTask) error
+	copyArtifact      func(context.Context, *SubTask, TaskResultStatus) error
 	strategyKey       *StrategyKey
 	mainContainerName string
-	createJob         func(context.Context) (Job, error)
+	createJob         func(context.Context, *StrategyKey) (Job, error)
+	retryPolicy       *taskRetryPolicy
 }
 
 func (t *Task) SubTaskNum() int {
@@ -40,55 +43,62 @@ func (t *Task) Run(ctx context.Context) (*TaskResult, error) {
 	return t.runWithRetry(ctx)
 }
 
-func (t *Task) retryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-	switch e := err.(type) {
-	case *kubejob.PreInitError:
-		return true
-	case *kubejob.PendingPhaseTimeoutError:
-		return true
-	case *kubejob.JobUnexpectedError:
-		return true
-	case *kubejob.JobMultiError:
-		return e.Has(kubejob.PreInitErrorType) ||
-			e.Has(kubejob.PendingPhaseTimeoutErrorType) ||
-			e.Has(kubejob.JobUnexpectedErrorType)
-	}
-	return false
-}
-
 func (t *Task) runWithRetry(ctx context.Context) (*TaskResult, error) {
-	const taskRetryCount = 2
-
 	policy := backoff.NewExponential(
-		backoff.WithInterval(1*time.Second),
-		backoff.WithMaxRetries(taskRetryCount),
+		backoff.WithInterval(t.retryPolicy.backoff),
+		backoff.WithMaxInterval(t.retryPolicy.maxBackoff),
+		backoff.WithRetryForever(),
 	)
-	b, cancel := policy.Start(context.Background())
+	b, cancel := policy.Start(ctx)
 	defer cancel()
 
 	var (
-		result     *TaskResult
-		err        error
-		retryCount int
+		result      *TaskResult
+		err         error
+		attempts    []*TaskAttempt
+		strategyKey = t.strategyKey
+		// finished is the results that don't need to run again by the subsequent attempts.
+		finished = &TaskResult{finishedContainers: map[string]struct{}{}}
 	)
-	for backoff.Continue(b) {
+	for attempt := 1; backoff.Continue(b); attempt++ {
+		startedAt := time.Now()
 		result, err = t.run(ctx)
+		class := t.retryPolicy.errorClass(err)
+		taskAttempt := &TaskAttempt{
+			Attempt:     attempt,
+			StartedAt:   startedAt,
+			ElapsedTime: time.Since(startedAt),
+			Err:         err,
+			ErrClass:    class,
+		}
+		if strategyKey != nil {
+			taskAttempt.Keys = strategyKey.Keys
+		}
+		attempts = append(attempts, taskAttempt)
 		if err != nil {
-			if t.retryableError(err) {
+			if t.retryPolicy.retryable(class) && attempt < t.retryPolicy.maxAttempts && ctx.Err() == nil {
+				// keep the results of the keys that have finished, and run the others again.
+				finished.addFinishedResults(result)
+				indexes, ok := t.unfinishedKeyIndexes(strategyKey, finished)
+				if !ok {
+					LoggerFromContext(ctx).Warn("failed to run task because %s. but all keys have already finished", err)
+					result, err = &TaskResult{}, nil
+					break
+				}
 				LoggerFromContext(ctx).Warn(
 					"failed to run task because %s. retry %d/%d",
-					err, retryCount, taskRetryCount,
+					err, attempt, t.retryPolicy.maxAttempts-1,
 				)
+				if strategyKey != nil {
+					strategyKey = strategyKey.subset(indexes)
+					LoggerFromContext(ctx).Info("reschedule %d keys that have not finished yet", len(strategyKey.Keys))
+				}
 				// Recreate the job because the internal state of the job has already changed.
-				job, err := t.createJob(ctx)
+				job, err := t.createJob(ctx, strategyKey)
 				if err != nil {
 					return nil, err
 				}
 				t.job = job
-				retryCount++
 				continue
 			} else {
 				LoggerFromContext(ctx).Debug("found not retryable error: %s", err)
@@ -96,9 +106,33 @@ func (t *Task) runWithRetry(ctx context.Context) (*TaskResult, error) {
 		}
 		break
 	}
-	return result, err
+	if err != nil {
+		return nil, err
+	}
+	result.groups = append(finished.groups, result.groups...)
+	result.attempts = attempts
+	result.task = t
+	return result, nil
+}
+
+// unfinishedKeyIndexes returns the indexes of the keys of strategyKey that have not finished yet.
+// If all keys have finished, returns false.
+func (t *Task) unfinishedKeyIndexes(strategyKey *StrategyKey, finished *TaskResult) ([]int, bool) {
+	if strategyKey == nil {
+		_, exists := finished.finishedContainers[t.mainContainerName]
+		return nil, !exists
+	}
+	indexes := []int{}
+	for idx := range strategyKey.Keys {
+		if _, exists := finished.finishedContainers[strategyKey.containerName(t.mainContainerName, idx)]; exists {
+			continue
+		}
+		indexes = append(indexes, idx)
+	}
+	return indexes, len(indexes) != 0
 }
 
+// run runs the task once. If the task failed, returns the results of the sub tasks that have been finished with the error.
 func (t *Task) run(ctx context.Context) (*TaskResult, error) {
 	logger := LoggerFromContext(ctx)
 	var result TaskResult
@@ -106,7 +140,7 @@ func (t *Task) run(ctx context.Context) (*TaskResult, error) {
 		for _, sidecar := range t.sideCarExecutors(executors) {
 			sidecar.ExecAsync(ctx)
 		}
-		subTasks := t.getSubTasks(t.mainExecutors(executors))
+		subTasks := t.getSubTasks(t.mainExecutors(executors), t.artifactKeeperExecutor(executors))
 		if t.strategyKey == nil {
 			result.add(NewSubTaskGroup(subTasks).Run(ctx))
 			return nil
@@ -127,13 +161,17 @@ func (t *Task) run(ctx context.Context) (*TaskResult, error) {
 	}); err != nil {
 		var failedJob *kubejob.FailedJob
 		if !errors.As(err, &failedJob) {
-			return nil, err
+			return &result, err
+		}
+		// the pod has been lost while running the tests, so the results are incomplete.
+		if podErr := newPodFailureError(failedJob.Pod); podErr != nil && t.retryPolicy.retryable(podErr.class) {
+			return &result, podErr
 		}
 	}
 	return &result, nil
 }
 
-func (t *Task) getSubTasks(execs []JobExecutor) []*SubTask {
+func (t *Task) getSubTasks(execs []JobExecutor, artifactKeeper JobExecutor) []*SubTask {
 	tasks := make([]*SubTask, 0, len(execs))
 	for _, exec := range execs {
 		container := exec.Container()
@@ -142,13 +180,15 @@ func (t *Task) getSubTasks(execs []JobExecutor) []*SubTask {
 			envName = t.strategyKey.Env
 		}
 		tasks = append(tasks, &SubTask{
-			Name:         t.getKeyName(container),
-			TaskName:     t.Name,
-			KeyEnvName:   envName,
-			OnFinish:     t.OnFinishSubTask,
-			exec:         exec,
-			copyArtifact: t.copyArtifact,
-			isMain:       t.isMainExecutor(exec),
+			Name:           t.getKeyName(container),
+			TaskName:       t.Name,
+			StepType:       t.StepType,
+			KeyEnvName:     envName,
+			OnFinish:       t.OnFinishSubTask,
+			exec:           exec,
+			copyArtifact:   t.copyArtifact,
+			artifactKeeper: artifactKeeper,
+			isMain:         t.isMainExecutor(exec),
 		})
 	}
 	return tasks
@@ -167,13 +207,24 @@ func (t *Task) mainExecutors(executors []JobExecutor) []JobExecutor {
 func (t *Task) sideCarExecutors(executors []JobExecutor) []JobExecutor {
 	sideCarExecs := make([]JobExecutor, 0, len(executors))
 	for _, exec := range executors {
-		if !t.isMainExecutor(exec) {
+		if !t.isMainExecutor(exec) && !isArtifactKeeper(exec) {
 			sideCarExecs = append(sideCarExecs, exec)
 		}
 	}
 	return sideCarExecs
 }
 
+// artifactKeeperExecutor returns the executor of the helper container for the artifacts. If it doesn't exist, returns nil.
+// The command of the helper container isn't executed, so the container is alive until the job finishes.
+func (t *Task) artifactKeeperExecutor(executors []JobExecutor) JobExecutor {
+	for _, exec := range executors {
+		if isArtifactKeeper(exec) {
+			return exec
+		}
+	}
+	return nil
+}
+
 func (t *Task) isMainExecutor(exec JobExecutor) bool {
 	return t.isMainContainer(exec.Container())
 }
@@ -246,7 +297,45 @@ func (g *TaskGroup) Run(ctx context.Context) (*TaskResultGroup, error) {
 }
 
 type TaskResult struct {
-	groups []*SubTaskResultGroup
+	groups   []*SubTaskResultGroup
+	attempts []*TaskAttempt
+	task     *Task
+	// finishedContainers the names of the main containers whose command has exited whether it passed or failed.
+	finishedContainers map[string]struct{}
+}
+
+// TaskAttempt is the result of an attempt to run the task.
+type TaskAttempt struct {
+	Attempt int
+	// Keys the strategy keys run by the attempt.
+	Keys        []string
+	StartedAt   time.Time
+	ElapsedTime time.Duration
+	Err         error
+	ErrClass    RetryErrorClass
+}
+
+// ToReportAttempts converts the attempts to run the task to the report.
+func (r *TaskResult) ToReportAttempts() []*ReportAttempt {
+	reports := make([]*ReportAttempt, 0, len(r.attempts))
+	for _, attempt := range r.attempts {
+		report := &ReportAttempt{
+			Attempt:        attempt.Attempt,
+			StartedAt:      metav1.Time{Time: attempt.StartedAt},
+			ElapsedTimeSec: int64(attempt.ElapsedTime.Seconds()),
+			ErrorClass:     attempt.ErrClass,
+			Keys:           attempt.Keys,
+		}
+		if r.task != nil {
+			report.Step = r.task.StepType
+			report.Task = r.task.Name
+		}
+		if attempt.Err != nil {
+			report.Error = attempt.Err.Error()
+		}
+		reports = append(reports, report)
+	}
+	return reports
 }
 
 func (r *TaskResult) MainTaskResults() []*SubTaskResult {
@@ -265,6 +354,25 @@ func (r *TaskResult) add(group *SubTaskResultGroup) {
 	r.groups = append(r.groups, group)
 }
 
+// addFinishedResults adds the results of the main containers in result whose command has exited.
+// The results of the commands interrupted by the lost pod aren't added, and they are run again.
+func (r *TaskResult) addFinishedResults(result *TaskResult) {
+	if result == nil {
+		return
+	}
+	group := &SubTaskResultGroup{}
+	for _, mainResult := range result.MainTaskResults() {
+		if !mainResult.exited() {
+			continue
+		}
+		group.add(mainResult)
+		r.finishedContainers[mainResult.Container.Name] = struct{}{}
+	}
+	if len(group.results) != 0 {
+		r.add(group)
+	}
+}
+
 type TaskResultGroup struct {
 	totalSubTaskNum int
 	results         []*TaskResult
@@ -321,17 +429,33 @@ func (g *TaskResultGroup) ToReportDetails() []*ReportDetail {
 	for _, result := range g.results {
 		for _, group := range result.groups {
 			for _, subTaskResult := range group.results {
-				details = append(details, &ReportDetail{
+				detail := &ReportDetail{
 					Status:         subTaskResult.Status.ToResultStatus(),
 					Name:           subTaskResult.Name,
+					StartedAt:      metav1.Time{Time: subTaskResult.StartedAt},
 					ElapsedTimeSec: int64(subTaskResult.ElapsedTime.Seconds()),
-				})
+				}
+				if subTaskResult.Pod != nil {
+					detail.Pod = subTaskResult.Pod.Name
+				}
+				if subTaskResult.ArtifactErr != nil {
+					detail.ArtifactError = subTaskResult.ArtifactErr.Error()
+				}
+				details = append(details, detail)
 			}
 		}
 	}
 	return details
 }
 
+func (g *TaskResultGroup) ToReportAttempts() []*ReportAttempt {
+	attempts := []*ReportAttempt{}
+	for _, result := range g.results {
+		attempts = append(attempts, result.ToReportAttempts()...)
+	}
+	return attempts
+}
+
 func (g *TaskResultGroup) add(result *TaskResult) {
 	g.mu.Lock()
 	g.results = append(g.results, result)
@@ -7,10 +7,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
-	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -19,12 +20,14 @@ import (
 
 const (
 	kubetestLabel  = "kubetest.io/testjob"
+	runLabel       = "kubetest.io/run"
 	keysAnnotation = "kubetest.io/strategyKeys"
 )
 
 var (
 	logMountPath        = filepath.Join("/", "tmp", "log")
 	logMountFilePath    = filepath.Join(logMountPath, "kubetest.log")
+	logMountKeyDirPath  = filepath.Join(logMountPath, keyLogDirName)
 	reportMountPath     = filepath.Join("/", "tmp", "report")
 	reportMountFilePath = filepath.Join(reportMountPath, "report")
 )
@@ -34,6 +37,7 @@ type TaskBuilder struct {
 	mgr       *ResourceManager
 	namespace string
 	runMode   RunMode
+	preInit   PreInitSpec
 }
 
 func NewTaskBuilder(cfg *rest.Config, mgr *ResourceManager, namespace string, runMode RunMode) *TaskBuilder {
@@ -45,6 +49,11 @@ func NewTaskBuilder(cfg *rest.Config, mgr *ResourceManager, namespace string, ru
 	}
 }
 
+// SetPreInit sets the parameter to copy the files into each pod.
+func (b *TaskBuilder) SetPreInit(spec PreInitSpec) {
+	b.preInit = spec
+}
+
 func (b *TaskBuilder) Build(ctx context.Context, step Step) (*Task, error) {
 	return b.BuildWithKey(ctx, step, nil)
 }
@@ -58,10 +67,14 @@ func (b *TaskBuilder) BuildWithKey(ctx context.Context, step Step, strategyKey *
 	if mainContainer.Name == "" {
 		return nil, fmt.Errorf("kubetest: main container name must be specified")
 	}
-	createJob := func(ctx context.Context) (Job, error) {
-		return b.buildJob(ctx, mainContainer, step, tmpl, strategyKey)
+	retryPolicy, err := newTaskRetryPolicy(step.GetRetryPolicy())
+	if err != nil {
+		return nil, err
+	}
+	createJob := func(ctx context.Context, strategyKey *StrategyKey) (Job, error) {
+		return b.buildJob(ctx, mainContainer, step, tmpl, strategyKey, retryPolicy)
 	}
-	job, err := createJob(ctx)
+	job, err := createJob(ctx, strategyKey)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +84,7 @@ func (b *TaskBuilder) BuildWithKey(ctx context.Context, step Step, strategyKey *
 		artifactMap[artifact.Container.Name] = append(artifactMap[artifact.Container.Name], artifact)
 	}
 	b.mgr.artifactMgr.AddArtifacts(spec.Artifacts)
-	copyArtifact := func(ctx context.Context, subtask *SubTask) error {
+	copyArtifact := func(ctx context.Context, subtask *SubTask, status TaskResultStatus) error {
 		if b.runMode == RunModeDryRun {
 			return nil
 		}
@@ -85,23 +98,48 @@ func (b *TaskBuilder) BuildWithKey(ctx context.Context, step Step, strategyKey *
 		if !exists {
 			return nil
 		}
+		b.mgr.artifactMgr.SetContainerKey(subtask.exec.Container().Name, subtask.Name)
 		for _, artifact := range artifacts {
+			if !artifact.Policy.needsToCollect(status) {
+				LoggerFromContext(ctx).Debug("skip collecting artifact %s by %s policy", artifact.Name, artifact.Policy)
+				continue
+			}
 			localPath, err := b.mgr.ArtifactPathByNameAndContainerName(artifact.Name, subtask.exec.Container().Name)
 			if err != nil {
 				return err
 			}
-			if mainContainer.Agent != nil {
-				// artifact.Container.Path and localPath has same Base name.
-				// If enabled kubetest-agent, try to copy artifacts via normal copy method.
-				// So, trim last path.
-				localPath = filepath.Dir(localPath)
-			}
-			if err := subtask.exec.CopyFrom(
+			if err := copyArtifactFromContainer(
 				ctx,
-				artifact.Container.Path,
+				subtask.exec,
+				artifact,
 				localPath,
+				mainContainer.Agent != nil,
 			); err != nil {
-				return err
+				if subtask.artifactKeeper == nil {
+					return err
+				}
+				// the main container may have been killed, so copy the artifact written on the volume through the helper container.
+				LoggerFromContext(ctx).Warn(
+					"failed to copy artifact %s from %s container: %s. retry through %s container",
+					artifact.Name, subtask.exec.Container().Name, err, artifactKeeperContainerName,
+				)
+				if err := os.RemoveAll(localPath); err != nil {
+					return fmt.Errorf("kubetest: failed to remove artifact %s: %w", artifact.Name, err)
+				}
+				if keeperErr := copyArtifactFromContainer(
+					ctx,
+					subtask.artifactKeeper,
+					artifact,
+					localPath,
+					false,
+				); keeperErr != nil {
+					return fmt.Errorf("%w: failed to copy through %s container: %s", err, artifactKeeperContainerName, keeperErr)
+				}
+			}
+			if artifact.Type == ArtifactTypeLog {
+				if err := maskFiles(localPath, LoggerFromContext(ctx)); err != nil {
+					return fmt.Errorf("kubetest: failed to mask artifact %s: %w", artifact.Name, err)
+				}
 			}
 		}
 		return nil
@@ -112,31 +150,29 @@ func (b *TaskBuilder) BuildWithKey(ctx context.Context, step Step, strategyKey *
 	}
 	return &Task{
 		Name:              step.GetName(),
+		StepType:          step.GetType(),
 		OnFinishSubTask:   onFinishSubTask,
 		job:               job,
 		copyArtifact:      copyArtifact,
 		strategyKey:       strategyKey,
 		mainContainerName: mainContainer.Name,
 		createJob:         createJob,
+		retryPolicy:       retryPolicy,
 	}, nil
 }
 
-func (b *TaskBuilder) buildJob(ctx context.Context, mainContainer TestJobContainer, step Step, tmpl TestJobTemplateSpec, strategyKey *StrategyKey) (Job, error) {
-	spec := *tmpl.Spec.DeepCopy()
-	b.addContainersByStrategyKey(&spec, mainContainer, strategyKey)
-	buildCtx := &TaskBuildContext{
-		initContainers:      newTaskContainerGroup(spec.InitContainers, spec.Volumes),
-		containers:          newTaskContainerGroup(spec.Containers, spec.Volumes),
-		finalizerContainers: newTaskContainerGroup([]TestJobContainer{spec.FinalizerContainer}, spec.Volumes),
-		spec:                spec,
-	}
-	podSpec := buildCtx.podSpec()
+func (b *TaskBuilder) buildJob(ctx context.Context, mainContainer TestJobContainer, step Step, tmpl TestJobTemplateSpec, strategyKey *StrategyKey, retryPolicy *taskRetryPolicy) (Job, error) {
+	buildCtx := b.newTaskBuildContext(ctx, mainContainer, tmpl, strategyKey)
+	spec := buildCtx.spec
+	podSpec := b.podSpec(buildCtx, strategyKey)
+	runID := b.mgr.RunID()
 	podMeta := tmpl.ObjectMeta
 	labels := map[string]string{}
 	for k, v := range podMeta.Labels {
 		labels[k] = v
 	}
 	labels[kubetestLabel] = fmt.Sprint(true)
+	labels[runLabel] = runID
 	annotations := map[string]string{}
 	for k, v := range podMeta.Annotations {
 		annotations[k] = v
@@ -154,6 +190,10 @@ func (b *TaskBuilder) buildJob(ctx context.Context, mainContainer TestJobContain
 	if spec.FinalizerContainer.Name != "" {
 		jobBuilder.SetFinalizer(&spec.FinalizerContainer.Container)
 	}
+	if retryPolicy.retryable(RetryErrorClassImagePull) {
+		// the pod that cannot pull the image stays pending, so watch it to fail the job.
+		jobBuilder.EnableImagePullFailureDetection()
+	}
 	job, err := jobBuilder.BuildWithJob(&batchv1.Job{
 		ObjectMeta: tmpl.ObjectMeta,
 		Spec: batchv1.JobSpec{
@@ -185,6 +225,12 @@ func (b *TaskBuilder) buildJob(ctx context.Context, mainContainer TestJobContain
 		if err := b.mountToken(ctx, taskContainer, exec); err != nil {
 			return err
 		}
+		if !isInitContainer {
+			// init containers have already finished, so the refreshed tokens are rewritten on the other containers only.
+			for tokenName, orgMountPath := range taskContainer.tokenNameToOrgMountPath {
+				buildCtx.tokenRefresher.addMountTarget(tokenName, exec, orgMountPath)
+			}
+		}
 		if err := b.mountArtifact(ctx, taskContainer, exec); err != nil {
 			return err
 		}
@@ -196,9 +242,74 @@ func (b *TaskBuilder) buildJob(ctx context.Context, mainContainer TestJobContain
 		}
 		return nil
 	})
+	if buildCtx.tokenRefresher.needsToRefresh() {
+		return &tokenRefreshJob{Job: job, refresher: buildCtx.tokenRefresher}, nil
+	}
 	return job, nil
 }
 
+func (b *TaskBuilder) newTaskBuildContext(ctx context.Context, mainContainer TestJobContainer, tmpl TestJobTemplateSpec, strategyKey *StrategyKey) *TaskBuildContext {
+	spec := *tmpl.Spec.DeepCopy()
+	b.addContainersByStrategyKey(&spec, mainContainer, strategyKey)
+	b.addArtifactKeeper(&spec, mainContainer)
+	b.addRepositoryEnv(&spec)
+	shared := b.sharedStorage()
+	return &TaskBuildContext{
+		initContainers:      newTaskContainerGroup(spec.InitContainers, spec.Volumes, shared),
+		containers:          newTaskContainerGroup(spec.Containers, spec.Volumes, shared),
+		finalizerContainers: newTaskContainerGroup([]TestJobContainer{spec.FinalizerContainer}, spec.Volumes, shared),
+		spec:                spec,
+		tokenRefresher:      newTokenRefresher(LoggerFromContext(ctx), b.mgr.tokenMgr),
+		sharedStorage:       shared,
+	}
+}
+
+// podSpec returns the pod spec of the job.
+func (b *TaskBuilder) podSpec(buildCtx *TaskBuildContext, strategyKey *StrategyKey) corev1.PodSpec {
+	podSpec := buildCtx.podSpec()
+	if strategyKey != nil {
+		strategyKey.placement.apply(&podSpec, b.mgr.RunID())
+	}
+	return podSpec
+}
+
+// podSpecWithKey returns the pod spec of the job built for the strategy key by BuildWithKey with the preinit container.
+// It's used to estimate the requests of the pod, so the preinit container added by kubejob when the job runs is included.
+func (b *TaskBuilder) podSpecWithKey(ctx context.Context, step Step, strategyKey *StrategyKey) (corev1.PodSpec, error) {
+	tmpl := step.GetTemplate()
+	mainContainer, err := getMainContainerFromTmpl(tmpl)
+	if err != nil {
+		return corev1.PodSpec{}, err
+	}
+	buildCtx := b.newTaskBuildContext(ctx, mainContainer, tmpl, strategyKey)
+	podSpec := b.podSpec(buildCtx, strategyKey)
+	if buildCtx.needsToPreInit() {
+		podSpec.InitContainers = append(podSpec.InitContainers, b.preInitContainer(buildCtx).Container)
+	}
+	return podSpec, nil
+}
+
+// sharedStorage returns the storage to stage the repositories and the artifacts.
+// It's used on kubernetes only, so they are copied into each container on the other run modes.
+func (b *TaskBuilder) sharedStorage() *sharedStorage {
+	if b.runMode != RunModeKubernetes {
+		return nil
+	}
+	return b.mgr.sharedStorage
+}
+
+// cleanupSharedStorage removes the files staged on the shared storage by the run.
+func (b *TaskBuilder) cleanupSharedStorage(ctx context.Context) error {
+	shared := b.sharedStorage()
+	if shared == nil {
+		return nil
+	}
+	jobBuilder := NewJobBuilder(b.cfg, b.namespace, b.runMode)
+	return shared.cleanup(ctx, b.namespace, func(job *batchv1.Job) (Job, error) {
+		return jobBuilder.BuildWithJob(job, nil, nil)
+	})
+}
+
 func (b *TaskBuilder) mountRepository(ctx context.Context, taskContainer *TaskContainer, exec JobExecutor) error {
 	containerName := exec.Container().Name
 	LoggerFromContext(ctx).Debug("mount repositories: %s", containerName)
@@ -314,19 +425,39 @@ func (b *TaskBuilder) mountLog(ctx context.Context, taskContainer *TaskContainer
 			return fmt.Errorf("kubetest: failed to mount log. %s: %w", string(out), err)
 		}
 	}
+	for _, mountPath := range taskContainer.keyLogOrgMountPaths {
+		cmd := []string{
+			// create mount point base directory if it doesn't exist.
+			"mkdir", "-p", filepath.Dir(mountPath),
+			"&&",
+			// remove the mount point path if it already exists.
+			"rm", "-rf", mountPath,
+			"&&",
+			// copy log directory of each key to the mount point path.
+			"cp", "-rf", logMountKeyDirPath, mountPath,
+		}
+		LoggerFromContext(ctx).Debug(
+			"mount log of each key on %s by '%s'",
+			containerName, strings.Join(cmd, " "),
+		)
+		out, err := exec.PrepareCommand(ctx, cmd)
+		if err != nil {
+			return fmt.Errorf("kubetest: failed to mount log of each key. %s: %w", string(out), err)
+		}
+	}
 	return nil
 }
 
 func (b *TaskBuilder) mountReport(ctx context.Context, taskContainer *TaskContainer, exec JobExecutor) error {
 	containerName := exec.Container().Name
 	LoggerFromContext(ctx).Debug("mount report: %s", containerName)
-	for _, mountPath := range taskContainer.reportOrgMountPaths {
+	for mountPath, format := range taskContainer.reportOrgMountPathToFormat {
 		cmd := []string{
 			// create mount point base directory if it doesn't exist.
 			"mkdir", "-p", filepath.Dir(mountPath),
 			"&&",
 			// copy report file to the mount point path.
-			"cp", filepath.Join(reportMountPath, "report.json"), mountPath,
+			"cp", filepath.Join(reportMountPath, reportFileName(format)), mountPath,
 		}
 		LoggerFromContext(ctx).Debug(
 			"mount report on %s by '%s'",
@@ -347,7 +478,10 @@ func (b *TaskBuilder) addContainersByStrategyKey(podSpec *TestJobPodSpec, mainCo
 	containers := []TestJobContainer{}
 	for idx, key := range strategyKey.Keys {
 		container := *mainContainer.DeepCopy()
-		container.Name += fmt.Sprintf("%d-%d", strategyKey.ConcurrentIdx, idx)
+		container.Name = strategyKey.containerName(mainContainer.Name, idx)
+		if strategyKey.resourceSizer != nil {
+			container.Resources = strategyKey.resourceSizer.containerResources(container.Resources, len(strategyKey.Keys))
+		}
 		container.Env = append(container.Env, corev1.EnvVar{
 			Name:  strategyKey.Env,
 			Value: key,
@@ -364,6 +498,88 @@ func (b *TaskBuilder) addContainersByStrategyKey(podSpec *TestJobPodSpec, mainCo
 	podSpec.Containers = append(sideCarContainers, containers...)
 }
 
+// addArtifactKeeper adds the helper container that mounts the volumes having the artifacts of the main container.
+// The command of the container isn't executed, so the container is alive until the job finishes
+// and the artifacts can be copied through it even if the main container was killed.
+func (b *TaskBuilder) addArtifactKeeper(podSpec *TestJobPodSpec, mainContainer TestJobContainer) {
+	if b.runMode == RunModeDryRun {
+		return
+	}
+	mounts := artifactVolumeMounts(*podSpec, mainContainer)
+	if len(mounts) == 0 {
+		return
+	}
+	podSpec.Containers = append(podSpec.Containers, TestJobContainer{
+		Container: corev1.Container{
+			Name:            artifactKeeperContainerName,
+			Image:           mainContainer.Image,
+			ImagePullPolicy: mainContainer.ImagePullPolicy,
+			Command:         []string{"true"},
+			WorkingDir:      mainContainer.WorkingDir,
+			VolumeMounts:    mounts,
+		},
+	})
+}
+
+// addRepositoryEnv adds environment variables that describe the checked out repositories to all containers.
+// e.g.) KUBETEST_REPO_<NAME>_SHA
+// If the container already has the environment variable of the same name, it isn't overwritten.
+func (b *TaskBuilder) addRepositoryEnv(podSpec *TestJobPodSpec) {
+	envs := repositoryEnv(b.mgr.RepositoryReports())
+	if len(envs) == 0 {
+		return
+	}
+	addEnv := func(container *TestJobContainer) {
+		if container.Name == "" {
+			return
+		}
+		defined := map[string]struct{}{}
+		for _, env := range container.Env {
+			defined[env.Name] = struct{}{}
+		}
+		for _, env := range envs {
+			if _, exists := defined[env.Name]; exists {
+				continue
+			}
+			container.Env = append(container.Env, env)
+		}
+	}
+	for idx := range podSpec.InitContainers {
+		addEnv(&podSpec.InitContainers[idx])
+	}
+	for idx := range podSpec.Containers {
+		addEnv(&podSpec.Containers[idx])
+	}
+	addEnv(&podSpec.FinalizerContainer)
+}
+
+var invalidEnvNameCharPattern = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// repositoryEnvPrefix returns the prefix of the environment variable name for the repository.
+// The name of the repository is converted to upper case and the characters that cannot be used for the name are replaced with '_'.
+func repositoryEnvPrefix(name string) string {
+	return "KUBETEST_REPO_" + invalidEnvNameCharPattern.ReplaceAllString(strings.ToUpper(name), "_") + "_"
+}
+
+func repositoryEnv(reports []*ReportRepo) []corev1.EnvVar {
+	envs := []corev1.EnvVar{}
+	for _, report := range reports {
+		prefix := repositoryEnvPrefix(report.Name)
+		for _, env := range []corev1.EnvVar{
+			{Name: prefix + "URL", Value: report.URL},
+			{Name: prefix + "REF", Value: report.Ref},
+			{Name: prefix + "SHA", Value: report.ResolvedSHA},
+			{Name: prefix + "MERGE_BASE_SHA", Value: report.MergeBaseSHA},
+		} {
+			if env.Value == "" {
+				continue
+			}
+			envs = append(envs, env)
+		}
+	}
+	return envs
+}
+
 func (b *TaskBuilder) preInitContainer(buildCtx *TaskBuildContext) TestJobContainer {
 	return TestJobContainer{
 		Container: corev1.Container{
@@ -378,66 +594,83 @@ func (b *TaskBuilder) preInitContainer(buildCtx *TaskBuildContext) TestJobContai
 }
 
 func (b *TaskBuilder) preInitCallback(ctx context.Context, buildCtx *TaskBuildContext) (PreInitCallback, error) {
-	var defaultCopyTimeout = 10 * time.Minute
-
-	type copyPath struct {
-		src string
-		dst string
+	copier, err := newPreInitCopier(b.preInit)
+	if err != nil {
+		return nil, err
 	}
-
-	copyPaths := []*copyPath{}
-	if err := b.getCopyPathForRepository(buildCtx, func(src, dst string) {
-		copyPaths = append(copyPaths, &copyPath{src: src, dst: dst})
+	stageTargets := []*sharedStageTarget{}
+	if err := b.getStageTargetForRepository(buildCtx, func(target *sharedStageTarget) {
+		stageTargets = append(stageTargets, target)
 	}); err != nil {
 		return nil, err
 	}
-	if err := b.getCopyPathForToken(ctx, buildCtx, func(src, dst string) {
-		copyPaths = append(copyPaths, &copyPath{src: src, dst: dst})
+	if err := b.getStageTargetForArtifact(ctx, buildCtx, func(target *sharedStageTarget) {
+		stageTargets = append(stageTargets, target)
 	}); err != nil {
 		return nil, err
 	}
-	if err := b.getCopyPathForArtifact(ctx, buildCtx, func(src, dst string) {
-		copyPaths = append(copyPaths, &copyPath{src: src, dst: dst})
-	}); err != nil {
+	copyPaths := []*preInitCopyPath{}
+	addCopyPath := func(typ preInitCopyType) func(src, dst string) {
+		return func(src, dst string) {
+			copyPaths = append(copyPaths, &preInitCopyPath{typ: typ, src: src, dst: dst})
+		}
+	}
+	if err := b.getCopyPathForRepository(buildCtx, addCopyPath(preInitCopyTypeRepo)); err != nil {
 		return nil, err
 	}
-	if err := b.getCopyPathForLog(ctx, buildCtx, func(src, dst string) {
-		copyPaths = append(copyPaths, &copyPath{src: src, dst: dst})
-	}); err != nil {
+	if err := b.getCopyPathForToken(ctx, buildCtx, addCopyPath(preInitCopyTypeToken)); err != nil {
 		return nil, err
 	}
-	if err := b.getCopyPathForReport(ctx, buildCtx, func(src, dst string) {
-		copyPaths = append(copyPaths, &copyPath{src: src, dst: dst})
-	}); err != nil {
+	if err := b.getCopyPathForArtifact(ctx, buildCtx, addCopyPath(preInitCopyTypeArtifact)); err != nil {
+		return nil, err
+	}
+	if err := b.getCopyPathForLog(ctx, buildCtx, addCopyPath(preInitCopyTypeLog)); err != nil {
+		return nil, err
+	}
+	if err := b.getCopyPathForReport(ctx, buildCtx, addCopyPath(preInitCopyTypeReport)); err != nil {
 		return nil, err
 	}
 	logger := LoggerFromContext(ctx)
 	return func(ctx context.Context, exec JobExecutor) error {
 		ctx = WithLogger(ctx, logger)
-		for _, path := range copyPaths {
-			path := path
-			if err := func(path *copyPath) error {
-				ctx, timeout := context.WithTimeout(ctx, defaultCopyTimeout)
-				defer timeout()
-				errChan := make(chan error)
-				go func() {
-					errChan <- exec.CopyTo(ctx, path.src, path.dst)
-				}()
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case err := <-errChan:
-					return err
-				}
-				return nil
-			}(path); err != nil {
+		for _, target := range stageTargets {
+			if err := buildCtx.sharedStorage.stage(ctx, exec, target); err != nil {
 				return err
 			}
 		}
-		return nil
+		return copier.copyAll(ctx, exec, copyPaths)
 	}, nil
 }
 
+func (b *TaskBuilder) getStageTargetForRepository(buildCtx *TaskBuildContext, cb func(*sharedStageTarget)) error {
+	for _, name := range buildCtx.sharedRepoNames() {
+		src, err := b.mgr.RepositoryPathByName(name)
+		if err != nil {
+			return err
+		}
+		cb(&sharedStageTarget{
+			src:      src,
+			path:     buildCtx.sharedStorage.repoPath(name),
+			archived: true,
+		})
+	}
+	return nil
+}
+
+func (b *TaskBuilder) getStageTargetForArtifact(ctx context.Context, buildCtx *TaskBuildContext, cb func(*sharedStageTarget)) error {
+	for _, name := range buildCtx.sharedArtifactNames() {
+		src, err := b.mgr.ArtifactPathByName(ctx, name)
+		if err != nil {
+			return err
+		}
+		cb(&sharedStageTarget{
+			src:  src,
+			path: buildCtx.sharedStorage.artifactPath(name),
+		})
+	}
+	return nil
+}
+
 func (b *TaskBuilder) getCopyPathForRepository(buildCtx *TaskBuildContext, cb func(src, dst string)) error {
 	for _, name := range buildCtx.repoNames() {
 		src, err := b.mgr.RepositoryPathByName(name)
@@ -452,10 +685,12 @@ func (b *TaskBuilder) getCopyPathForRepository(buildCtx *TaskBuildContext, cb fu
 
 func (b *TaskBuilder) getCopyPathForToken(ctx context.Context, buildCtx *TaskBuildContext, cb func(src, dst string)) error {
 	for _, name := range buildCtx.tokenNames() {
-		src, err := b.mgr.TokenPathByName(ctx, name)
+		token, err := b.mgr.TokenByName(ctx, name)
 		if err != nil {
 			return err
 		}
+		buildCtx.tokenRefresher.addToken(token)
+		src := token.File
 		dst := buildCtx.tokenNameToMountPath(name)
 		cb(src, filepath.Join(dst, filepath.Base(src)))
 	}
@@ -488,6 +723,13 @@ func (b *TaskBuilder) getCopyPathForLog(ctx context.Context, buildCtx *TaskBuild
 		}
 		cb(logPath, logMountFilePath)
 	}
+	if buildCtx.isUsedKeyLogVolume() {
+		keyLogDir, err := b.mgr.KeyLogDir()
+		if err != nil {
+			return err
+		}
+		cb(keyLogDir, logMountKeyDirPath)
+	}
 	return nil
 }
 
@@ -495,8 +737,8 @@ func (b *TaskBuilder) getCopyPathForReport(ctx context.Context, buildCtx *TaskBu
 	if b.runMode == RunModeDryRun {
 		return nil
 	}
-	if buildCtx.isUsedReportVolume() {
-		reportPath, err := b.mgr.ReportPath(ReportFormatTypeJSON)
+	for _, format := range buildCtx.reportFormats() {
+		reportPath, err := b.mgr.ReportPath(format)
 		if err != nil {
 			return err
 		}
@@ -510,6 +752,10 @@ type TaskBuildContext struct {
 	containers          *TaskContainerGroup
 	finalizerContainers *TaskContainerGroup
 	spec                TestJobPodSpec
+	// tokenRefresher refreshes the tokens copied to the containers before they expire.
+	tokenRefresher *tokenRefresher
+	// sharedStorage is nil if the repositories and the artifacts are copied into each container.
+	sharedStorage *sharedStorage
 }
 
 func (c *TaskBuildContext) taskContainer(name string, isInitContainer bool) *TaskContainer {
@@ -556,25 +802,45 @@ func (c *TaskBuildContext) isUsedLogVolume() bool {
 	return false
 }
 
-func (c *TaskBuildContext) isUsedReportVolume() bool {
+func (c *TaskBuildContext) isUsedKeyLogVolume() bool {
 	for _, container := range c.initContainers.containerMap {
-		if len(container.reportOrgMountPaths) != 0 {
+		if len(container.keyLogOrgMountPaths) != 0 {
 			return true
 		}
 	}
 	for _, container := range c.containers.containerMap {
-		if len(container.reportOrgMountPaths) != 0 {
+		if len(container.keyLogOrgMountPaths) != 0 {
 			return true
 		}
 	}
 	for _, container := range c.finalizerContainers.containerMap {
-		if len(container.reportOrgMountPaths) != 0 {
+		if len(container.keyLogOrgMountPaths) != 0 {
 			return true
 		}
 	}
 	return false
 }
 
+// reportFormats returns the formats of report used by report volumes.
+func (c *TaskBuildContext) reportFormats() []ReportFormatType {
+	formatMap := map[ReportFormatType]struct{}{}
+	for _, group := range []*TaskContainerGroup{c.initContainers, c.containers, c.finalizerContainers} {
+		for _, container := range group.containerMap {
+			for _, format := range container.reportOrgMountPathToFormat {
+				formatMap[format] = struct{}{}
+			}
+		}
+	}
+	formats := make([]ReportFormatType, 0, len(formatMap))
+	for format := range formatMap {
+		formats = append(formats, format)
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i] < formats[j]
+	})
+	return formats
+}
+
 func (c *TaskBuildContext) repoNames() []string {
 	repoNameMap := map[string]struct{}{}
 	for _, name := range c.initContainers.repoNames() {
@@ -632,6 +898,42 @@ func (c *TaskBuildContext) artifactNames() []string {
 	return artifactNames
 }
 
+// sharedRepoNames returns the names of repository staged on the shared storage.
+func (c *TaskBuildContext) sharedRepoNames() []string {
+	repoNameMap := map[string]struct{}{}
+	for _, group := range []*TaskContainerGroup{c.initContainers, c.containers, c.finalizerContainers} {
+		for _, container := range group.containerMap {
+			for name := range container.sharedRepoNames {
+				repoNameMap[name] = struct{}{}
+			}
+		}
+	}
+	repoNames := make([]string, 0, len(repoNameMap))
+	for name := range repoNameMap {
+		repoNames = append(repoNames, name)
+	}
+	sort.Strings(repoNames)
+	return repoNames
+}
+
+// sharedArtifactNames returns the names of artifact staged on the shared storage.
+func (c *TaskBuildContext) sharedArtifactNames() []string {
+	artifactNameMap := map[string]struct{}{}
+	for _, group := range []*TaskContainerGroup{c.initContainers, c.containers, c.finalizerContainers} {
+		for _, container := range group.containerMap {
+			for name := range container.sharedArtifactNames {
+				artifactNameMap[name] = struct{}{}
+			}
+		}
+	}
+	artifactNames := make([]string, 0, len(artifactNameMap))
+	for name := range artifactNameMap {
+		artifactNames = append(artifactNames, name)
+	}
+	sort.Strings(artifactNames)
+	return artifactNames
+}
+
 func (g *TaskBuildContext) repoNameToArchiveMountPath(name string) string {
 	path := g.initContainers.repoNameToArchiveMountPath(name)
 	if path != "" {
@@ -885,12 +1187,12 @@ func (g *TaskContainerGroup) preInitImagePullPolicy() corev1.PullPolicy {
 	return ""
 }
 
-func newTaskContainerGroup(containers []TestJobContainer, volumes []TestJobVolume) *TaskContainerGroup {
+func newTaskContainerGroup(containers []TestJobContainer, volumes []TestJobVolume, shared *sharedStorage) *TaskContainerGroup {
 	g := &TaskContainerGroup{
 		containerMap: map[string]*TaskContainer{},
 	}
 	for _, c := range containers {
-		g.containerMap[c.Name] = newTaskContainer(c, volumes)
+		g.containerMap[c.Name] = newTaskContainer(c, volumes, shared)
 	}
 	return g
 }
@@ -904,8 +1206,11 @@ type TaskContainer struct {
 	tokenNameToOrgMountPath    map[string]string
 	artifactNameToMountPath    map[string]string
 	artifactNameToOrgMountPath map[string]string
+	sharedRepoNames            map[string]struct{}
+	sharedArtifactNames        map[string]struct{}
 	logOrgMountPaths           []string
-	reportOrgMountPaths        []string
+	keyLogOrgMountPaths        []string
+	reportOrgMountPathToFormat map[string]ReportFormatType
 	podSpecVolumeMap           map[string]corev1.Volume
 	preInitVolumeMountMap      map[string]corev1.VolumeMount
 }
@@ -914,7 +1219,7 @@ func (c *TaskContainer) hasTestVolumeMount() bool {
 	return len(c.preInitVolumeMountMap) > 0
 }
 
-func newTaskContainer(c TestJobContainer, volumes []TestJobVolume) *TaskContainer {
+func newTaskContainer(c TestJobContainer, volumes []TestJobVolume, shared *sharedStorage) *TaskContainer {
 	repoNameToArchiveMountPath := map[string]string{}
 	repoNameToOrgMountPath := map[string]string{}
 
@@ -924,8 +1229,12 @@ func newTaskContainer(c TestJobContainer, volumes []TestJobVolume) *TaskContaine
 	artifactNameToMountPath := map[string]string{}
 	artifactNameToOrgMountPath := map[string]string{}
 
+	sharedRepoNames := map[string]struct{}{}
+	sharedArtifactNames := map[string]struct{}{}
+
 	logOrgMountPaths := []string{}
-	reportOrgMountPaths := []string{}
+	keyLogOrgMountPaths := []string{}
+	reportOrgMountPathToFormat := map[string]ReportFormatType{}
 
 	podSpecVolumeMap := map[string]corev1.Volume{}
 	preInitVolumeMountMap := map[string]corev1.VolumeMount{}
@@ -937,6 +1246,12 @@ func newTaskContainer(c TestJobContainer, volumes []TestJobVolume) *TaskContaine
 	for idx, vm := range c.VolumeMounts {
 		volume := volumeNameToVolume[vm.Name]
 		switch {
+		case volume.Repo != nil && shared != nil:
+			// the extracted repository files staged on the shared storage are mounted to the mount point directly.
+			sharedRepoNames[volume.Repo.Name] = struct{}{}
+			c.VolumeMounts[idx] = shared.volumeMount(vm.MountPath, shared.repoPath(volume.Repo.Name))
+			podSpecVolumeMap[sharedStorageVolumeName] = shared.volume()
+			preInitVolumeMountMap[sharedStorageVolumeName] = shared.preInitVolumeMount()
 		case volume.Repo != nil:
 			repoVolumeName := volume.Name
 			repoName := volume.Repo.Name
@@ -955,6 +1270,11 @@ func newTaskContainer(c TestJobContainer, volumes []TestJobVolume) *TaskContaine
 				Name:      repoVolumeName,
 				MountPath: archiveMountPath,
 			}
+		case volume.Artifact != nil && shared != nil:
+			sharedArtifactNames[volume.Artifact.Name] = struct{}{}
+			c.VolumeMounts[idx] = shared.volumeMount(vm.MountPath, shared.artifactPath(volume.Artifact.Name))
+			podSpecVolumeMap[sharedStorageVolumeName] = shared.volume()
+			preInitVolumeMountMap[sharedStorageVolumeName] = shared.preInitVolumeMount()
 		case volume.Artifact != nil:
 			artifactVolumeName := volume.Name
 			artifactName := volume.Artifact.Name
@@ -991,7 +1311,11 @@ func newTaskContainer(c TestJobContainer, volumes []TestJobVolume) *TaskContaine
 			}
 		case volume.Log != nil:
 			logVolumeName := volume.Name
-			logOrgMountPaths = append(logOrgMountPaths, vm.MountPath)
+			if volume.Log.PerKey {
+				keyLogOrgMountPaths = append(keyLogOrgMountPaths, vm.MountPath)
+			} else {
+				logOrgMountPaths = append(logOrgMountPaths, vm.MountPath)
+			}
 			c.VolumeMounts[idx].MountPath = logMountPath
 			podSpecVolumeMap[logVolumeName] = corev1.Volume{
 				Name: logVolumeName,
@@ -1005,7 +1329,7 @@ func newTaskContainer(c TestJobContainer, volumes []TestJobVolume) *TaskContaine
 			}
 		case volume.Report != nil:
 			reportVolumeName := volume.Name
-			reportOrgMountPaths = append(reportOrgMountPaths, vm.MountPath)
+			reportOrgMountPathToFormat[vm.MountPath] = volume.Report.Format
 			c.VolumeMounts[idx].MountPath = reportMountPath
 			podSpecVolumeMap[reportVolumeName] = corev1.Volume{
 				Name: reportVolumeName,
@@ -1032,8 +1356,11 @@ func newTaskContainer(c TestJobContainer, volumes []TestJobVolume) *TaskContaine
 		tokenNameToOrgMountPath:    tokenNameToOrgMountPath,
 		artifactNameToMountPath:    artifactNameToMountPath,
 		artifactNameToOrgMountPath: artifactNameToOrgMountPath,
+		sharedRepoNames:            sharedRepoNames,
+		sharedArtifactNames:        sharedArtifactNames,
 		logOrgMountPaths:           logOrgMountPaths,
-		reportOrgMountPaths:        reportOrgMountPaths,
+		keyLogOrgMountPaths:        keyLogOrgMountPaths,
+		reportOrgMountPathToFormat: reportOrgMountPathToFormat,
 		podSpecVolumeMap:           podSpecVolumeMap,
 		preInitVolumeMountMap:      preInitVolumeMountMap,
 	}
@@ -0,0 +1,172 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goccy/kubejob"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultTaskMaxAttempts     = 3
+	defaultTaskRetryBackoff    = time.Second
+	defaultTaskMaxRetryBackoff = time.Minute
+)
+
+// defaultRetryErrorClasses the classes retried if retryOn isn't specified.
+// eviction, nodeLost and imagePull must be specified explicitly.
+var defaultRetryErrorClasses = []RetryErrorClass{
+	RetryErrorClassPreInit,
+	RetryErrorClassPendingTimeout,
+	RetryErrorClassUnexpected,
+}
+
+// imagePullFailureReasons the reasons of the waiting container that cannot pull the image.
+var imagePullFailureReasons = map[string]struct{}{
+	"ErrImagePull":      {},
+	"ImagePullBackOff":  {},
+	"InvalidImageName":  {},
+	"ErrImageNeverPull": {},
+}
+
+type taskRetryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	retryOn     map[RetryErrorClass]struct{}
+}
+
+func newTaskRetryPolicy(policy *RetryPolicy) (*taskRetryPolicy, error) {
+	p := &taskRetryPolicy{
+		maxAttempts: defaultTaskMaxAttempts,
+		backoff:     defaultTaskRetryBackoff,
+		maxBackoff:  defaultTaskMaxRetryBackoff,
+		retryOn:     map[RetryErrorClass]struct{}{},
+	}
+	classes := defaultRetryErrorClasses
+	if policy != nil {
+		if policy.MaxAttempts > 0 {
+			p.maxAttempts = int(policy.MaxAttempts)
+		}
+		if policy.Backoff != "" {
+			backoff, err := time.ParseDuration(policy.Backoff)
+			if err != nil {
+				return nil, fmt.Errorf("kubetest: failed to parse backoff of retry policy: %w", err)
+			}
+			p.backoff = backoff
+		}
+		if policy.MaxBackoff != "" {
+			maxBackoff, err := time.ParseDuration(policy.MaxBackoff)
+			if err != nil {
+				return nil, fmt.Errorf("kubetest: failed to parse max backoff of retry policy: %w", err)
+			}
+			p.maxBackoff = maxBackoff
+		}
+		if len(policy.RetryOn) != 0 {
+			classes = policy.RetryOn
+		}
+	}
+	for _, class := range classes {
+		p.retryOn[class] = struct{}{}
+	}
+	return p, nil
+}
+
+func (p *taskRetryPolicy) retryable(class RetryErrorClass) bool {
+	if class == "" {
+		return false
+	}
+	_, exists := p.retryOn[class]
+	return exists
+}
+
+// podFailureError is the error that the pod failed by the reason unrelated to the tests ( e.g. the node was reclaimed ).
+type podFailureError struct {
+	class  RetryErrorClass
+	pod    string
+	reason string
+}
+
+func (e *podFailureError) Error() string {
+	return fmt.Sprintf("kubetest: pod %s failed by %s: %s", e.pod, e.class, e.reason)
+}
+
+func newPodFailureError(pod *corev1.Pod) *podFailureError {
+	class, reason := podFailureClass(pod)
+	if class == "" {
+		return nil
+	}
+	return &podFailureError{class: class, pod: pod.Name, reason: reason}
+}
+
+// podFailureClass classifies the failure of the pod and returns the class with the reason.
+// If the pod doesn't fail by eviction, node loss or image pull, returns empty class.
+func podFailureClass(pod *corev1.Pod) (RetryErrorClass, string) {
+	if pod == nil {
+		return "", ""
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type != corev1.DisruptionTarget || cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Reason {
+		case "DeletionByTaintManager", "DeletionByPodGC":
+			return RetryErrorClassNodeLost, cond.Reason
+		default:
+			return RetryErrorClassEviction, cond.Reason
+		}
+	}
+	switch pod.Status.Reason {
+	case "Evicted":
+		return RetryErrorClassEviction, pod.Status.Reason
+	case "NodeLost":
+		return RetryErrorClassNodeLost, pod.Status.Reason
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting == nil {
+			continue
+		}
+		if _, exists := imagePullFailureReasons[status.State.Waiting.Reason]; exists {
+			return RetryErrorClassImagePull, fmt.Sprintf("%s of %s container", status.State.Waiting.Reason, status.Name)
+		}
+	}
+	return "", ""
+}
+
+// errorClass classifies the error of running the task.
+// The failure of the pod is classified more specifically than the error of kubejob.
+// kubejob.JobUnexpectedError is classified by the failure of the pod only if the class is specified in retryOn,
+// so that it's retried as unexpected error by default even if the pod was evicted or lost.
+func (p *taskRetryPolicy) errorClass(err error) RetryErrorClass {
+	if err == nil {
+		return ""
+	}
+	var podErr *podFailureError
+	if errors.As(err, &podErr) {
+		return podErr.class
+	}
+	switch e := err.(type) {
+	case *kubejob.PreInitError:
+		return RetryErrorClassPreInit
+	case *kubejob.PendingPhaseTimeoutError:
+		return RetryErrorClassPendingTimeout
+	case *kubejob.JobUnexpectedError:
+		if class, _ := podFailureClass(e.Pod); p.retryable(class) {
+			return class
+		}
+		return RetryErrorClassUnexpected
+	case *kubejob.JobMultiError:
+		for _, err := range e.Errs {
+			if class := p.errorClass(err); class != "" {
+				return class
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,443 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/goccy/kubejob"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// failedJob returns err instead of running the containers.
+// If failedKeys is not nil, err is returned after running the containers, and the containers of failedKeys fail.
+// The commands of exitedKeys exit with non-zero exit code, and the others are interrupted.
+type failedJob struct {
+	*dryRunJob
+	err        error
+	failedKeys map[string]struct{}
+	exitedKeys map[string]struct{}
+}
+
+func (j *failedJob) RunWithExecutionHandler(ctx context.Context, handler func(context.Context, []JobExecutor) error, finalizer func(context.Context, JobExecutor) error) error {
+	if j.failedKeys == nil {
+		if j.err != nil {
+			return j.err
+		}
+		return j.dryRunJob.RunWithExecutionHandler(ctx, handler, finalizer)
+	}
+	execs := []JobExecutor{}
+	for _, container := range j.job.Spec.Template.Spec.Containers {
+		exec := &failedKeyJobExecutor{dryRunJobExecutor: &dryRunJobExecutor{container: container}}
+		for _, env := range container.Env {
+			if _, exists := j.failedKeys[env.Value]; exists {
+				exec.failed = true
+			}
+			if _, exists := j.exitedKeys[env.Value]; exists {
+				exec.exited = true
+			}
+		}
+		execs = append(execs, exec)
+	}
+	if err := handler(ctx, execs); err != nil {
+		return err
+	}
+	return j.err
+}
+
+type failedKeyJobExecutor struct {
+	*dryRunJobExecutor
+	failed bool
+	exited bool
+}
+
+func (e *failedKeyJobExecutor) OutputStream(ctx context.Context, w io.Writer) ([]byte, error) {
+	if e.exited {
+		return nil, &kubejob.FailedJob{Reason: &kubejob.CommandError{WriterErr: exitError{code: 1}}}
+	}
+	if e.failed {
+		return nil, errors.New("failed")
+	}
+	return e.dryRunJobExecutor.OutputStream(ctx, w)
+}
+
+func TestRetryErrorClass(t *testing.T) {
+	evictedPod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}}
+	preemptedPod := &corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		Conditions: []corev1.PodCondition{
+			{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue, Reason: "PreemptionByScheduler"},
+		},
+	}}
+	lostPod := &corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		Conditions: []corev1.PodCondition{
+			{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue, Reason: "DeletionByTaintManager"},
+		},
+	}}
+	imagePullPod := &corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodPending,
+		ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "test", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+		},
+	}}
+	for _, test := range []struct {
+		name     string
+		err      error
+		retryOn  []RetryErrorClass
+		expected RetryErrorClass
+	}{
+		{name: "nil", err: nil, expected: ""},
+		{name: "unknown error", err: errors.New("failed"), expected: ""},
+		{name: "preinit", err: &kubejob.PreInitError{Err: errors.New("failed")}, expected: RetryErrorClassPreInit},
+		{name: "pending timeout", err: &kubejob.PendingPhaseTimeoutError{}, expected: RetryErrorClassPendingTimeout},
+		{name: "unexpected", err: &kubejob.JobUnexpectedError{Pod: &corev1.Pod{}}, expected: RetryErrorClassUnexpected},
+		{name: "evicted", err: &kubejob.JobUnexpectedError{Pod: evictedPod}, expected: RetryErrorClassUnexpected},
+		{
+			name:     "evicted with retryOn",
+			err:      &kubejob.JobUnexpectedError{Pod: evictedPod},
+			retryOn:  []RetryErrorClass{RetryErrorClassEviction},
+			expected: RetryErrorClassEviction,
+		},
+		{
+			name:     "preempted with retryOn",
+			err:      &kubejob.JobUnexpectedError{Pod: preemptedPod},
+			retryOn:  []RetryErrorClass{RetryErrorClassEviction},
+			expected: RetryErrorClassEviction,
+		},
+		{name: "node lost", err: &kubejob.JobUnexpectedError{Pod: lostPod}, expected: RetryErrorClassUnexpected},
+		{
+			name:     "node lost with retryOn",
+			err:      &kubejob.JobUnexpectedError{Pod: lostPod},
+			retryOn:  []RetryErrorClass{RetryErrorClassNodeLost},
+			expected: RetryErrorClassNodeLost,
+		},
+		{name: "image pull", err: newPodFailureError(imagePullPod), expected: RetryErrorClassImagePull},
+		{
+			name:     "multi error",
+			err:      &kubejob.JobMultiError{Errs: []error{errors.New("failed"), &kubejob.JobUnexpectedError{Pod: evictedPod}}},
+			retryOn:  []RetryErrorClass{RetryErrorClassEviction},
+			expected: RetryErrorClassEviction,
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := newTaskRetryPolicy(&RetryPolicy{RetryOn: test.retryOn})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if class := policy.errorClass(test.err); class != test.expected {
+				t.Fatalf("expected %q but got %q", test.expected, class)
+			}
+		})
+	}
+}
+
+func TestTaskRetry(t *testing.T) {
+	ctx := WithLogger(context.Background(), NewLogger(io.Discard, LogLevelInfo))
+	evictedErr := &kubejob.JobUnexpectedError{Pod: &corev1.Pod{Status: corev1.PodStatus{Reason: "Evicted"}}}
+	newTask := func(t *testing.T, policy *RetryPolicy, errs ...error) *Task {
+		t.Helper()
+		retryPolicy, err := newTaskRetryPolicy(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newJob := func() Job {
+			job := &failedJob{dryRunJob: &dryRunJob{job: &batchv1.Job{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "test"}}},
+					},
+				},
+			}}}
+			if len(errs) != 0 {
+				job.err = errs[0]
+				errs = errs[1:]
+			}
+			return job
+		}
+		return &Task{
+			Name:              "task",
+			StepType:          PreStepType,
+			job:               newJob(),
+			copyArtifact:      func(context.Context, *SubTask, TaskResultStatus) error { return nil },
+			mainContainerName: "test",
+			createJob:         func(context.Context, *StrategyKey) (Job, error) { return newJob(), nil },
+			retryPolicy:       retryPolicy,
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		task := newTask(t, &RetryPolicy{Backoff: "1ms"}, &kubejob.PreInitError{Err: errors.New("failed")}, &kubejob.PendingPhaseTimeoutError{})
+		result, err := task.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attempts := result.ToReportAttempts()
+		if len(attempts) != 3 {
+			t.Fatalf("expected 3 attempts but got %d", len(attempts))
+		}
+		for idx, class := range []RetryErrorClass{RetryErrorClassPreInit, RetryErrorClassPendingTimeout, ""} {
+			if attempts[idx].Attempt != idx+1 {
+				t.Fatalf("unexpected attempt number: %d", attempts[idx].Attempt)
+			}
+			if attempts[idx].ErrorClass != class {
+				t.Fatalf("expected %q but got %q", class, attempts[idx].ErrorClass)
+			}
+			if attempts[idx].Step != PreStepType || attempts[idx].Task != "task" {
+				t.Fatalf("unexpected task of attempt: %+v", attempts[idx])
+			}
+		}
+		if attempts[2].Error != "" {
+			t.Fatalf("unexpected error of last attempt: %s", attempts[2].Error)
+		}
+	})
+	t.Run("eviction is retried as unexpected error by default", func(t *testing.T) {
+		task := newTask(t, &RetryPolicy{Backoff: "1ms"}, evictedErr)
+		result, err := task.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attempts := result.ToReportAttempts()
+		if len(attempts) != 2 {
+			t.Fatalf("expected 2 attempts but got %d", len(attempts))
+		}
+		if attempts[0].ErrorClass != RetryErrorClassUnexpected {
+			t.Fatalf("expected %q but got %q", RetryErrorClassUnexpected, attempts[0].ErrorClass)
+		}
+	})
+	t.Run("retry on eviction", func(t *testing.T) {
+		task := newTask(t, &RetryPolicy{
+			MaxAttempts: 5,
+			Backoff:     "1ms",
+			RetryOn:     []RetryErrorClass{RetryErrorClassEviction},
+		}, evictedErr, evictedErr, evictedErr, evictedErr)
+		result, err := task.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.ToReportAttempts()) != 5 {
+			t.Fatalf("expected 5 attempts but got %d", len(result.ToReportAttempts()))
+		}
+	})
+	t.Run("exceeds max attempts", func(t *testing.T) {
+		task := newTask(t, &RetryPolicy{
+			MaxAttempts: 2,
+			Backoff:     "1ms",
+			RetryOn:     []RetryErrorClass{RetryErrorClassEviction},
+		}, evictedErr, evictedErr, evictedErr)
+		_, err := task.Run(ctx)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !errors.Is(err, evictedErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	t.Run("failed job by node lost", func(t *testing.T) {
+		lostPod := &corev1.Pod{Status: corev1.PodStatus{Reason: "NodeLost"}}
+		task := newTask(t, &RetryPolicy{
+			Backoff: "1ms",
+			RetryOn: []RetryErrorClass{RetryErrorClassNodeLost},
+		}, &kubejob.FailedJob{Pod: lostPod})
+		result, err := task.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attempts := result.ToReportAttempts()
+		if len(attempts) != 2 {
+			t.Fatalf("expected 2 attempts but got %d", len(attempts))
+		}
+		if attempts[0].ErrorClass != RetryErrorClassNodeLost || !strings.Contains(attempts[0].Error, "NodeLost") {
+			t.Fatalf("unexpected attempt: %+v", attempts[0])
+		}
+	})
+	t.Run("reschedule unfinished keys", func(t *testing.T) {
+		retryPolicy, err := newTaskRetryPolicy(&RetryPolicy{
+			Backoff: "1ms",
+			RetryOn: []RetryErrorClass{RetryErrorClassEviction},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			scheduledKeys  [][]string
+			containerNames []string
+		)
+		createJob := func(_ context.Context, key *StrategyKey) (Job, error) {
+			scheduledKeys = append(scheduledKeys, key.Keys)
+			containers := []corev1.Container{}
+			for idx, k := range key.Keys {
+				name := key.containerName("test", idx)
+				containerNames = append(containerNames, name)
+				containers = append(containers, corev1.Container{
+					Name: name,
+					Env:  []corev1.EnvVar{{Name: "KEY", Value: k}},
+				})
+			}
+			job := &failedJob{
+				dryRunJob: &dryRunJob{job: &batchv1.Job{
+					Spec: batchv1.JobSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{Containers: containers},
+						},
+					},
+				}},
+				failedKeys: map[string]struct{}{},
+			}
+			if len(scheduledKeys) == 1 {
+				// b fails because the pod is evicted.
+				job.failedKeys["b"] = struct{}{}
+				job.err = evictedErr
+			}
+			return job, nil
+		}
+		var progress bytes.Buffer
+		progressCtx := WithLogger(context.Background(), NewLogger(&progress, LogLevelInfo))
+		strategyKey := &StrategyKey{
+			Keys:             []string{"a", "b", "c"},
+			Env:              "KEY",
+			SubTaskScheduler: NewSubTaskScheduler(0),
+		}
+		job, err := createJob(ctx, strategyKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		task := &Task{
+			Name:              "task",
+			StepType:          MainStepType,
+			job:               job,
+			copyArtifact:      func(context.Context, *SubTask, TaskResultStatus) error { return nil },
+			strategyKey:       strategyKey,
+			mainContainerName: "test",
+			createJob:         createJob,
+			retryPolicy:       retryPolicy,
+			OnFinishSubTask:   (&TaskScheduler{}).keyProgressLogger(progressCtx, 3),
+		}
+		result, err := task.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(scheduledKeys) != 2 || len(scheduledKeys[1]) != 1 || scheduledKeys[1][0] != "b" {
+			t.Fatalf("only unfinished key must be rescheduled: %v", scheduledKeys)
+		}
+		if containerNames[len(containerNames)-1] != "test0-1" {
+			t.Fatalf("rescheduled container must keep the name: %v", containerNames)
+		}
+		results := result.MainTaskResults()
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results but got %d", len(results))
+		}
+		for _, r := range results {
+			if r.Status != TaskResultSuccess {
+				t.Fatalf("unexpected result of %s: %s", r.Name, r.Status)
+			}
+		}
+		attempts := result.ToReportAttempts()
+		if len(attempts) != 2 || len(attempts[0].Keys) != 3 || len(attempts[1].Keys) != 1 {
+			t.Fatalf("unexpected attempts: %+v", attempts)
+		}
+		if !strings.Contains(progress.String(), "3/3 (100.000000%) finished.") || strings.Contains(progress.String(), "4/3") {
+			t.Fatalf("rescheduled key must be counted only once: %s", progress.String())
+		}
+	})
+	t.Run("keep failed keys", func(t *testing.T) {
+		retryPolicy, err := newTaskRetryPolicy(&RetryPolicy{
+			Backoff: "1ms",
+			RetryOn: []RetryErrorClass{RetryErrorClassEviction},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var scheduledKeys [][]string
+		createJob := func(_ context.Context, key *StrategyKey) (Job, error) {
+			scheduledKeys = append(scheduledKeys, key.Keys)
+			containers := []corev1.Container{}
+			for idx, k := range key.Keys {
+				containers = append(containers, corev1.Container{
+					Name: key.containerName("test", idx),
+					Env:  []corev1.EnvVar{{Name: "KEY", Value: k}},
+				})
+			}
+			job := &failedJob{
+				dryRunJob: &dryRunJob{job: &batchv1.Job{
+					Spec: batchv1.JobSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{Containers: containers},
+						},
+					},
+				}},
+				failedKeys: map[string]struct{}{},
+			}
+			if len(scheduledKeys) == 1 {
+				// the test of a fails, and b is interrupted because the pod is evicted.
+				job.exitedKeys = map[string]struct{}{"a": {}}
+				job.failedKeys["b"] = struct{}{}
+				job.err = evictedErr
+			}
+			return job, nil
+		}
+		strategyKey := &StrategyKey{
+			Keys:             []string{"a", "b", "c"},
+			Env:              "KEY",
+			SubTaskScheduler: NewSubTaskScheduler(0),
+		}
+		job, err := createJob(ctx, strategyKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		task := &Task{
+			Name:              "task",
+			StepType:          MainStepType,
+			job:               job,
+			copyArtifact:      func(context.Context, *SubTask, TaskResultStatus) error { return nil },
+			strategyKey:       strategyKey,
+			mainContainerName: "test",
+			createJob:         createJob,
+			retryPolicy:       retryPolicy,
+		}
+		result, err := task.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(scheduledKeys) != 2 || strings.Join(scheduledKeys[1], ",") != "b" {
+			t.Fatalf("failed key must not be rescheduled: %v", scheduledKeys)
+		}
+		statuses := map[string]TaskResultStatus{}
+		for _, r := range result.MainTaskResults() {
+			statuses[r.Name] = r.Status
+		}
+		expected := map[string]TaskResultStatus{"a": TaskResultFailure, "b": TaskResultSuccess, "c": TaskResultSuccess}
+		if len(statuses) != len(expected) {
+			t.Fatalf("unexpected results: %v", statuses)
+		}
+		for name, status := range expected {
+			if statuses[name] != status {
+				t.Fatalf("expected %s of %s but got %s", status, name, statuses[name])
+			}
+		}
+	})
+	t.Run("all keys have passed", func(t *testing.T) {
+		task := newTask(t, &RetryPolicy{
+			Backoff: "1ms",
+			RetryOn: []RetryErrorClass{RetryErrorClassEviction},
+		})
+		task.job.(*failedJob).failedKeys = map[string]struct{}{}
+		task.job.(*failedJob).err = evictedErr
+		task.createJob = func(context.Context, *StrategyKey) (Job, error) {
+			t.Fatal("passed task must not be run again")
+			return nil, nil
+		}
+		result, err := task.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.MainTaskResults()) != 1 {
+			t.Fatalf("failed to keep the passed result")
+		}
+	})
+}
@@ -4,27 +4,46 @@
 package v1
 
 import (
+	"bytes"
 	"context"
+	"encoding/pem"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/google/go-github/v54/github"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 type Token struct {
+	// Name of the token specified by TokenSpec.
+	Name  string
 	File  string
 	Value string
+	// Username to authenticate by the token. If empty, the token doesn't require the specific username.
+	Username string
+	// ExpiresAt is the time when the token expires. If zero, the token doesn't expire.
+	ExpiresAt time.Time
 }
 
+// TokenManager mints the token by the source and caches it per name for its lifetime.
+// The cached token shares the token file, so the token is minted once even if it's used by many tasks.
 type TokenManager struct {
 	tokenMap map[string]TokenSource
 	cli      *TokenClient
+	mu       sync.Mutex
+	tokens   map[string]*Token
+	sshKeys  map[string]*SSHKey
+	// dirs temporary directories that have token files. They are removed by Cleanup.
+	dirs []string
 }
 
 func NewTokenManager(tokens []TokenSpec, cli *TokenClient) *TokenManager {
@@ -35,32 +54,250 @@ func NewTokenManager(tokens []TokenSpec, cli *TokenClient) *TokenManager {
 	return &TokenManager{
 		tokenMap: tokenMap,
 		cli:      cli,
+		tokens:   map[string]*Token{},
+		sshKeys:  map[string]*SSHKey{},
 	}
 }
 
+// TokenByName returns the token by name. The token is cached until it expires.
+// If the cached token expires soon, the token is re-minted and the token file is rewritten.
 func (m *TokenManager) TokenByName(ctx context.Context, name string) (*Token, error) {
-	dir, err := os.MkdirTemp("", "token")
-	if err != nil {
-		return nil, fmt.Errorf("kubetest: failed to create temporary directory for token: %w", err)
-	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	if cached, exists := m.tokens[name]; exists {
+		if !cached.expiresSoon(time.Now()) {
+			return cached, nil
+		}
+		return m.refreshToken(ctx, cached)
+	}
 	source, exists := m.tokenMap[name]
 	if !exists {
 		return nil, fmt.Errorf("kubetest: failed to find token name %s", name)
 	}
-	value, err := m.cli.AccessToken(ctx, source)
+	if source.SSHKey != nil {
+		// the token file is readable by everyone and mountable to the pods, so the private key is never written to it.
+		return nil, fmt.Errorf("kubetest: token %s is ssh key. it can be used to access the repository only", name)
+	}
+	value, expiresAt, err := m.issueToken(ctx, source)
 	if err != nil {
 		return nil, err
 	}
+	var username string
+	if provider, ok := source.Provider().(tokenUsernameProvider); ok {
+		username = provider.TokenUsername()
+	}
+	dir, err := m.createTempDir("token")
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to create temporary directory for token: %w", err)
+	}
 	file := filepath.Join(dir, "token")
 	if err := os.WriteFile(file, []byte(value), 0666); err != nil {
 		return nil, fmt.Errorf("kubetest: failed to write token to %s: %w", file, err)
 	}
-	LoggerFromContext(ctx).AddMask(value)
-	return &Token{
-		File:  file,
-		Value: value,
-	}, nil
+	addTokenMasks(ctx, value)
+	token := &Token{
+		Name:      name,
+		File:      file,
+		Value:     value,
+		Username:  username,
+		ExpiresAt: expiresAt,
+	}
+	m.tokens[name] = token
+	return token, nil
+}
+
+// RefreshToken re-mints the token and rewrites the token file, then returns the refreshed token.
+// If the token has already been refreshed by the other caller, returns the cached token without minting.
+func (m *TokenManager) RefreshToken(ctx context.Context, token *Token) (*Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cached, exists := m.tokens[token.Name]; exists && cached != token && !cached.expiresSoon(time.Now()) {
+		return cached, nil
+	}
+	return m.refreshToken(ctx, token)
+}
+
+// refreshToken mints the token and replaces the token file atomically, so the reader never reads the partially written token.
+// The caller must hold the lock.
+func (m *TokenManager) refreshToken(ctx context.Context, token *Token) (*Token, error) {
+	source, exists := m.tokenMap[token.Name]
+	if !exists {
+		return nil, fmt.Errorf("kubetest: failed to find token name %s", token.Name)
+	}
+	value, expiresAt, err := m.issueToken(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	addTokenMasks(ctx, value)
+	tmpFile, err := os.CreateTemp(filepath.Dir(token.File), "token")
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to create temporary file for token: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmpFile.WriteString(value); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("kubetest: failed to write token to %s: %w", tmpPath, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("kubetest: failed to write token to %s: %w", tmpPath, err)
+	}
+	if err := os.Chmod(tmpPath, 0666); err != nil {
+		return nil, fmt.Errorf("kubetest: failed to change mode of token file: %w", err)
+	}
+	if err := os.Rename(tmpPath, token.File); err != nil {
+		return nil, fmt.Errorf("kubetest: failed to replace token file %s: %w", token.File, err)
+	}
+	// the token may be referenced by the other goroutines, so create the new token instead of updating it.
+	refreshed := *token
+	refreshed.Value = value
+	refreshed.ExpiresAt = expiresAt
+	m.tokens[token.Name] = &refreshed
+	return &refreshed, nil
+}
+
+// Cleanup removes all files of the tokens and SSH keys.
+func (m *TokenManager) Cleanup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := []string{}
+	for _, dir := range m.dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to remove token directory %s: %s", dir, err.Error()))
+		}
+	}
+	m.dirs = nil
+	m.tokens = map[string]*Token{}
+	m.sshKeys = map[string]*SSHKey{}
+	if len(errs) > 0 {
+		return fmt.Errorf("kubetest: failed to cleanup %s", strings.Join(errs, ":"))
+	}
+	return nil
+}
+
+func (m *TokenManager) createTempDir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	m.dirs = append(m.dirs, dir)
+	return dir, nil
+}
+
+// expiresSoon returns true if the token expires within the refresh margin.
+func (t *Token) expiresSoon(now time.Time) bool {
+	if t.ExpiresAt.IsZero() {
+		return false
+	}
+	return !now.Add(defaultTokenRefreshMargin).Before(t.ExpiresAt)
+}
+
+// issueToken returns the token value and the expiration time. If the token doesn't expire, the expiration time is zero.
+func (m *TokenManager) issueToken(ctx context.Context, source TokenSource) (string, time.Time, error) {
+	if provider, ok := source.Provider().(expiringTokenProvider); ok {
+		return provider.AccessTokenWithExpiry(ctx, m.cli)
+	}
+	value, err := m.cli.AccessToken(ctx, source)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return value, time.Time{}, nil
+}
+
+func addTokenMasks(ctx context.Context, value string) {
+	logger := LoggerFromContext(ctx)
+	for _, mask := range secretMaskVariants(value) {
+		logger.AddMask(mask)
+	}
+}
+
+// SSHKey is the credential to access the repository by SSH.
+type SSHKey struct {
+	// PrivateKeyFile path to the private key file that is readable by the owner only ( required by ssh command ).
+	PrivateKeyFile string
+	// PrivateKey the private key that isn't protected by passphrase.
+	PrivateKey []byte
+	// KnownHostsFile path to known_hosts file. If empty, the default known_hosts is used.
+	KnownHostsFile        string
+	InsecureIgnoreHostKey bool
+}
+
+// SSHKeyByName returns SSH key by token name. If the token isn't based on SSH key, returns nil.
+func (m *TokenManager) SSHKeyByName(ctx context.Context, name string) (*SSHKey, error) {
+	source, exists := m.tokenMap[name]
+	if !exists {
+		return nil, fmt.Errorf("kubetest: failed to find token name %s", name)
+	}
+	if source.SSHKey == nil {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, exists := m.sshKeys[name]; exists {
+		return key, nil
+	}
+	privateKey, err := m.cli.AccessToken(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	addTokenMasks(ctx, privateKey)
+	dir, err := m.createTempDir("ssh")
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to create temporary directory for ssh key: %w", err)
+	}
+	key := &SSHKey{
+		PrivateKeyFile:        filepath.Join(dir, "id"),
+		PrivateKey:            []byte(privateKey),
+		InsecureIgnoreHostKey: source.SSHKey.InsecureIgnoreHostKey,
+	}
+	if source.SSHKey.Passphrase != nil {
+		passphrase, err := m.cli.secretData(ctx, source.SSHKey.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		logger := LoggerFromContext(ctx)
+		for _, mask := range secretMaskVariants(string(passphrase)) {
+			logger.AddMask(mask)
+		}
+		// ssh command cannot read the passphrase non-interactively, so decrypt the private key in advance.
+		privateKey, err := decryptSSHPrivateKey(key.PrivateKey, bytes.TrimSpace(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = privateKey
+	}
+	if err := os.WriteFile(key.PrivateKeyFile, key.PrivateKey, 0600); err != nil {
+		return nil, fmt.Errorf("kubetest: failed to write ssh private key to %s: %w", key.PrivateKeyFile, err)
+	}
+	if source.SSHKey.KnownHosts != nil {
+		knownHosts, err := m.cli.secretData(ctx, source.SSHKey.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+		key.KnownHostsFile = filepath.Join(dir, "known_hosts")
+		if err := os.WriteFile(key.KnownHostsFile, knownHosts, 0644); err != nil {
+			return nil, fmt.Errorf("kubetest: failed to write known_hosts to %s: %w", key.KnownHostsFile, err)
+		}
+	}
+	m.sshKeys[name] = key
+	return key, nil
+}
+
+func decryptSSHPrivateKey(privateKey, passphrase []byte) ([]byte, error) {
+	rawKey, err := ssh.ParseRawPrivateKeyWithPassphrase(privateKey, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to decrypt ssh private key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(rawKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to encode ssh private key: %w", err)
+	}
+	return pem.EncodeToMemory(block), nil
 }
 
 type TokenClient struct {
@@ -76,15 +313,36 @@ func NewTokenClient(clientset *kubernetes.Clientset, namespace string) *TokenCli
 }
 
 func (c *TokenClient) AccessToken(ctx context.Context, token TokenSource) (string, error) {
-	switch {
-	case token.GitHubApp != nil:
-		return c.tokenFromGitHubApp(ctx, token.GitHubApp)
-	case token.GitHubToken != nil:
-		return c.tokenFromGitHubToken(ctx, token.GitHubToken)
-	case token.FilePath != nil:
-		return c.tokenFromFilePath(ctx, token.FilePath)
+	provider := token.Provider()
+	if provider == nil {
+		return "", nil
+	}
+	return provider.AccessToken(ctx, c)
+}
+
+func (c *TokenClient) tokenFromSSHKey(ctx context.Context, source *SSHKeyTokenSource) (string, error) {
+	if err := NewValidator().ValidateSSHKeyTokenSource(source); err != nil {
+		return "", err
+	}
+	privateKey, err := c.secretData(ctx, source.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return string(privateKey), nil
+}
+
+func (c *TokenClient) secretData(ctx context.Context, selector *corev1.SecretKeySelector) ([]byte, error) {
+	secret, err := c.clientset.CoreV1().
+		Secrets(c.namespace).
+		Get(ctx, selector.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to read secret %s: %w", selector.Name, err)
+	}
+	data, exists := secret.Data[selector.Key]
+	if !exists {
+		return nil, fmt.Errorf("kubetest: failed to find secret data: %s", selector.Key)
 	}
-	return "", nil
+	return data, nil
 }
 
 func (c *TokenClient) tokenFromGitHubToken(ctx context.Context, source *GitHubTokenSource) (string, error) {
@@ -101,25 +359,25 @@ func (c *TokenClient) tokenFromGitHubToken(ctx context.Context, source *GitHubTo
 	return strings.TrimSpace(string(data)), nil
 }
 
-func (c *TokenClient) tokenFromGitHubApp(ctx context.Context, source *GitHubAppTokenSource) (string, error) {
+func (c *TokenClient) tokenFromGitHubApp(ctx context.Context, source *GitHubAppTokenSource) (string, time.Time, error) {
 	if err := NewValidator().ValidateGitHubAppTokenSource(source); err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 	privateKey, err := c.clientset.CoreV1().
 		Secrets(c.namespace).
 		Get(ctx, source.KeyFile.Name, metav1.GetOptions{})
 	if err != nil {
-		return "", fmt.Errorf("kubetest: failed to read private key from secret %s: %w", source.KeyFile.Name, err)
+		return "", time.Time{}, fmt.Errorf("kubetest: failed to read private key from secret %s: %w", source.KeyFile.Name, err)
 	}
 	privateKeyData, exists := privateKey.Data[source.KeyFile.Key]
 	if !exists {
-		return "", fmt.Errorf("kubetest: failed to find private key data: %s", source.KeyFile.Key)
+		return "", time.Time{}, fmt.Errorf("kubetest: failed to find private key data: %s", source.KeyFile.Key)
 	}
-	token, err := c.tokenFromGitHubAppWithParam(ctx, source.AppID, source.InstallationID, source.Organization, privateKeyData)
+	token, err := c.installationTokenFromGitHubAppWithParam(ctx, source.AppID, source.InstallationID, source.Organization, privateKeyData)
 	if err != nil {
-		return "", fmt.Errorf("kubetset: failed to get token from github app params: %w", err)
+		return "", time.Time{}, fmt.Errorf("kubetset: failed to get token from github app params: %w", err)
 	}
-	return token, nil
+	return token.GetToken(), token.GetExpiresAt().Time, nil
 }
 
 func (c *TokenClient) tokenFromFilePath(ctx context.Context, source *string) (string, error) {
@@ -131,23 +389,32 @@ func (c *TokenClient) tokenFromFilePath(ctx context.Context, source *string) (st
 }
 
 func (c *TokenClient) tokenFromGitHubAppWithParam(ctx context.Context, appID, installationID int64, org string, privateKey []byte) (string, error) {
+	token, err := c.installationTokenFromGitHubAppWithParam(ctx, appID, installationID, org, privateKey)
+	if err != nil {
+		return "", err
+	}
+	return token.GetToken(), nil
+}
+
+// installationTokenFromGitHubAppWithParam creates the installation token. The installation token expires after an hour.
+func (c *TokenClient) installationTokenFromGitHubAppWithParam(ctx context.Context, appID, installationID int64, org string, privateKey []byte) (*github.InstallationToken, error) {
 	appsTransport, err := ghinstallation.NewAppsTransport(http.DefaultTransport, appID, privateKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to initialize apps transport from %d: %w", appID, err)
+		return nil, fmt.Errorf("failed to initialize apps transport from %d: %w", appID, err)
 	}
 	githubClient := github.NewClient(&http.Client{Transport: appsTransport})
 	if installationID == 0 {
 		id, err := c.getInstallationID(ctx, githubClient, org)
 		if err != nil {
-			return "", fmt.Errorf("failed to get installation id by %s: %w", org, err)
+			return nil, fmt.Errorf("failed to get installation id by %s: %w", org, err)
 		}
 		installationID = id
 	}
 	token, _, err := githubClient.Apps.CreateInstallationToken(ctx, installationID, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create installation token: %w", err)
+		return nil, fmt.Errorf("failed to create installation token: %w", err)
 	}
-	return token.GetToken(), nil
+	return token, nil
 }
 
 func (c *TokenClient) getInstallationID(ctx context.Context, githubClient *github.Client, org string) (int64, error) {
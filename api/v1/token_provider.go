@@ -0,0 +1,137 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// TokenProvider provides the token value. Each token source implements this interface.
+type TokenProvider interface {
+	AccessToken(ctx context.Context, cli *TokenClient) (string, error)
+}
+
+// tokenUsernameProvider is implemented by the token provider that requires the specific username to authenticate by the token.
+type tokenUsernameProvider interface {
+	TokenUsername() string
+}
+
+// expiringTokenProvider is implemented by the token provider that issues the token with the expiration time.
+type expiringTokenProvider interface {
+	AccessTokenWithExpiry(ctx context.Context, cli *TokenClient) (string, time.Time, error)
+}
+
+// Provider returns the token provider specified by the source. If no source is specified, returns nil.
+func (s TokenSource) Provider() TokenProvider {
+	switch {
+	case s.GitHubApp != nil:
+		return s.GitHubApp
+	case s.GitHubToken != nil:
+		return s.GitHubToken
+	case s.FilePath != nil:
+		return filePathTokenProvider(*s.FilePath)
+	case s.SSHKey != nil:
+		return s.SSHKey
+	case s.Vault != nil:
+		return s.Vault
+	case s.Env != nil:
+		return envTokenProvider(*s.Env)
+	case s.GitLab != nil:
+		return s.GitLab
+	case s.Exec != nil:
+		return s.Exec
+	}
+	return nil
+}
+
+func (s *GitHubAppTokenSource) AccessToken(ctx context.Context, cli *TokenClient) (string, error) {
+	token, _, err := cli.tokenFromGitHubApp(ctx, s)
+	return token, err
+}
+
+func (s *GitHubAppTokenSource) AccessTokenWithExpiry(ctx context.Context, cli *TokenClient) (string, time.Time, error) {
+	return cli.tokenFromGitHubApp(ctx, s)
+}
+
+func (s *GitHubTokenSource) AccessToken(ctx context.Context, cli *TokenClient) (string, error) {
+	return cli.tokenFromGitHubToken(ctx, s)
+}
+
+func (s *SSHKeyTokenSource) AccessToken(ctx context.Context, cli *TokenClient) (string, error) {
+	return cli.tokenFromSSHKey(ctx, s)
+}
+
+type filePathTokenProvider string
+
+func (p filePathTokenProvider) AccessToken(ctx context.Context, cli *TokenClient) (string, error) {
+	path := string(p)
+	return cli.tokenFromFilePath(ctx, &path)
+}
+
+type envTokenProvider string
+
+func (p envTokenProvider) AccessToken(ctx context.Context, cli *TokenClient) (string, error) {
+	name := string(p)
+	if err := NewValidator().ValidateEnvTokenSource(&name); err != nil {
+		return "", err
+	}
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return "", fmt.Errorf("kubetest: failed to find environment variable %s for token", name)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+const defaultGitLabTokenUsername = "oauth2"
+
+func (s *GitLabTokenSource) AccessToken(ctx context.Context, cli *TokenClient) (string, error) {
+	if err := NewValidator().ValidateGitLabTokenSource(s); err != nil {
+		return "", err
+	}
+	token, err := cli.secretData(ctx, s.Token)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+func (s *GitLabTokenSource) TokenUsername() string {
+	if s.Username != "" {
+		return s.Username
+	}
+	return defaultGitLabTokenUsername
+}
+
+const defaultExecTokenTimeout = 60 * time.Second
+
+func (s *ExecTokenSource) AccessToken(ctx context.Context, cli *TokenClient) (string, error) {
+	if err := NewValidator().ValidateExecTokenSource(s); err != nil {
+		return "", err
+	}
+	timeout := defaultExecTokenTimeout
+	if s.TimeoutSeconds > 0 {
+		timeout = time.Duration(s.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("kubetest: failed to get token by command %q: %s: %w", strings.Join(s.Command, " "), stderr.String(), err)
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return "", fmt.Errorf("kubetest: failed to get token by command %q: stdout is empty", strings.Join(s.Command, " "))
+	}
+	return token, nil
+}
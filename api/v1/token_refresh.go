@@ -0,0 +1,235 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenRefreshMargin is the duration before the expiration to refresh the token.
+	defaultTokenRefreshMargin = 5 * time.Minute
+	// defaultTokenRefreshRetryInterval is the interval to retry when the refresh fails.
+	defaultTokenRefreshRetryInterval = 30 * time.Second
+)
+
+// tokenRefresher re-mints the tokens used by the job before they expire,
+// and rewrites the token files mounted on the running containers through the executor.
+type tokenRefresher struct {
+	logger        Logger
+	margin        time.Duration
+	retryInterval time.Duration
+	refreshToken  func(context.Context, *Token) (*Token, error)
+	mu            sync.Mutex
+	tokens        []*refreshingToken
+}
+
+type refreshingToken struct {
+	token    *Token
+	issuedAt time.Time
+	// retryAt is the time to retry the refresh. If zero, the refresh hasn't failed.
+	retryAt time.Time
+	targets []*tokenMountTarget
+}
+
+// tokenMountTarget is the token file path on the container.
+type tokenMountTarget struct {
+	exec JobExecutor
+	path string
+}
+
+func newTokenRefresher(logger Logger, mgr *TokenManager) *tokenRefresher {
+	return &tokenRefresher{
+		logger:        logger,
+		margin:        defaultTokenRefreshMargin,
+		retryInterval: defaultTokenRefreshRetryInterval,
+		refreshToken:  mgr.RefreshToken,
+	}
+}
+
+// addToken adds the token to refresh. If the token doesn't expire, it's ignored.
+func (r *tokenRefresher) addToken(token *Token) {
+	if token.ExpiresAt.IsZero() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = append(r.tokens, &refreshingToken{
+		token:    token,
+		issuedAt: time.Now(),
+	})
+}
+
+// addMountTarget adds the path on the container to rewrite when the token is refreshed.
+func (r *tokenRefresher) addMountTarget(name string, exec JobExecutor, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.token.Name == name {
+			t.targets = append(t.targets, &tokenMountTarget{exec: exec, path: path})
+		}
+	}
+}
+
+func (r *tokenRefresher) needsToRefresh() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.tokens) != 0
+}
+
+// refreshAt returns the time to refresh the token.
+// If the lifetime of the token is shorter than the margin, the token is refreshed at the half of the lifetime.
+func (r *tokenRefresher) refreshAt(t *refreshingToken) time.Time {
+	if !t.retryAt.IsZero() {
+		return t.retryAt
+	}
+	margin := r.margin
+	if lifetime := t.token.ExpiresAt.Sub(t.issuedAt); lifetime < margin*2 {
+		margin = lifetime / 2
+	}
+	return t.token.ExpiresAt.Add(-margin)
+}
+
+func (r *tokenRefresher) nextToken() (*refreshingToken, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		next   *refreshingToken
+		nextAt time.Time
+	)
+	for _, t := range r.tokens {
+		at := r.refreshAt(t)
+		if next == nil || at.Before(nextAt) {
+			next = t
+			nextAt = at
+		}
+	}
+	return next, nextAt
+}
+
+// run refreshes the tokens until the context is done.
+func (r *tokenRefresher) run(ctx context.Context) {
+	ctx = WithLogger(ctx, r.logger)
+	for {
+		t, at := r.nextToken()
+		if t == nil {
+			return
+		}
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		refreshed, err := r.refresh(ctx, t)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.logger.Warn("failed to refresh token: %s. retry after %s", err, r.retryInterval)
+			r.mu.Lock()
+			t.retryAt = time.Now().Add(r.retryInterval)
+			r.mu.Unlock()
+			continue
+		}
+		// the token has been re-minted, so the failure to rewrite it doesn't retry to re-mint it.
+		if err := r.rewrite(ctx, t, refreshed); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.logger.Warn("failed to rewrite token: %s", err)
+		}
+	}
+}
+
+// refresh re-mints the token.
+func (r *tokenRefresher) refresh(ctx context.Context, t *refreshingToken) (*Token, error) {
+	issuedAt := time.Now()
+	r.mu.Lock()
+	token := t.token
+	r.mu.Unlock()
+	refreshed, err := r.refreshToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("kubetest: failed to refresh token %s: %w", token.Name, err)
+	}
+	r.mu.Lock()
+	t.token = refreshed
+	t.issuedAt = issuedAt
+	t.retryAt = time.Time{}
+	r.mu.Unlock()
+	r.logger.Debug("refreshed token %s. the token expires at %s", refreshed.Name, refreshed.ExpiresAt)
+	return refreshed, nil
+}
+
+// rewrite copies the refreshed token to the mount targets.
+// The targets whose container has terminated are removed, and the errors of the other targets are combined.
+func (r *tokenRefresher) rewrite(ctx context.Context, t *refreshingToken, refreshed *Token) error {
+	r.mu.Lock()
+	targets := append([]*tokenMountTarget{}, t.targets...)
+	r.mu.Unlock()
+	var (
+		errs       []error
+		terminated = map[*tokenMountTarget]struct{}{}
+	)
+	for _, target := range targets {
+		containerName := target.exec.Container().Name
+		if exec, ok := target.exec.(runningJobExecutor); ok {
+			running, err := exec.isRunning(ctx)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !running {
+				r.logger.Debug("%s container has terminated. stop rewriting token %s", containerName, refreshed.Name)
+				terminated[target] = struct{}{}
+				continue
+			}
+		}
+		if err := target.exec.CopyTo(ctx, refreshed.File, target.path); err != nil {
+			errs = append(errs, fmt.Errorf(
+				"kubetest: failed to rewrite token %s on %s container: %w",
+				refreshed.Name, containerName, err,
+			))
+		}
+	}
+	if len(terminated) != 0 {
+		r.mu.Lock()
+		running := make([]*tokenMountTarget, 0, len(t.targets))
+		for _, target := range t.targets {
+			if _, exists := terminated[target]; !exists {
+				running = append(running, target)
+			}
+		}
+		t.targets = running
+		r.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// tokenRefreshJob refreshes the tokens while the containers of the job are running.
+type tokenRefreshJob struct {
+	Job
+	refresher *tokenRefresher
+}
+
+func (j *tokenRefreshJob) RunWithExecutionHandler(ctx context.Context, handler func(context.Context, []JobExecutor) error, finalizerHandler func(context.Context, JobExecutor) error) error {
+	return j.Job.RunWithExecutionHandler(ctx, func(ctx context.Context, execs []JobExecutor) error {
+		refreshCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			j.refresher.run(refreshCtx)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+		return handler(ctx, execs)
+	}, finalizerHandler)
+}
@@ -1,12 +1,22 @@
 package v1
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -120,3 +130,423 @@ func TestTokenFromFilePath(t *testing.T) {
 		t.Fatalf("failed to get token from file. expected %s but got %s", string(tokenContent), token.Value)
 	}
 }
+
+func TestSSHKeyToken(t *testing.T) {
+	sshKey := TokenSource{
+		SSHKey: &SSHKeyTokenSource{
+			PrivateKey: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "ssh"},
+				Key:                  "id",
+			},
+			InsecureIgnoreHostKey: true,
+		},
+	}
+	t.Run("not written to token file", func(t *testing.T) {
+		mgr := NewTokenManager([]TokenSpec{{Name: "sshKey", Value: sshKey}}, NewTokenClient(nil, "default"))
+		ctx := WithLogger(context.Background(), NewLogger(io.Discard, LogLevelInfo))
+		if _, err := mgr.TokenByName(ctx, "sshKey"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+	t.Run("cannot be mounted", func(t *testing.T) {
+		v := NewValidator()
+		// the main step isn't specified, so the validation fails after the tokens are registered.
+		_ = v.ValidateTestJobSpec(TestJobSpec{Tokens: []TokenSpec{{Name: "sshKey", Value: sshKey}}})
+		err := v.ValidateTokenVolumeSource(&TokenVolumeSource{Name: "sshKey"})
+		if err == nil || !strings.Contains(err.Error(), "ssh key cannot be mounted") {
+			t.Fatalf("expected error for mounting ssh key but got %v", err)
+		}
+	})
+}
+
+func TestLocalTokenProviders(t *testing.T) {
+	envName := "KUBETEST_TEST_TOKEN"
+	tokens := []TokenSpec{
+		{Name: "env", Value: TokenSource{Env: &envName}},
+		{Name: "exec", Value: TokenSource{Exec: &ExecTokenSource{Command: []string{"echo", "dummytoken"}}}},
+		{Name: "vault", Value: TokenSource{Vault: &VaultTokenSource{
+			Address: "http://127.0.0.1:8200",
+			KV:      &VaultKVSource{Path: "kubetest", Key: "token"},
+		}}},
+	}
+	t.Run("disabled by default", func(t *testing.T) {
+		v := NewValidator()
+		for _, token := range tokens {
+			if err := v.ValidateToken(token); err == nil {
+				t.Fatalf("expected error for %s token source", token.Name)
+			}
+		}
+	})
+	t.Run("enabled", func(t *testing.T) {
+		v := NewValidator()
+		v.EnableLocalTokenProviders()
+		for _, token := range tokens {
+			if err := v.ValidateToken(token); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestTokenFromEnv(t *testing.T) {
+	t.Setenv("KUBETEST_TEST_TOKEN", "dummytoken\n")
+	envName := "KUBETEST_TEST_TOKEN"
+	mgr := NewTokenManager([]TokenSpec{
+		{
+			Name: "envToken",
+			Value: TokenSource{
+				Env: &envName,
+			},
+		},
+	}, NewTokenClient(nil, "default"))
+	ctx := WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelInfo))
+	token, err := mgr.TokenByName(ctx, "envToken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Value != "dummytoken" {
+		t.Fatalf("failed to get token from env. expected dummytoken but got %s", token.Value)
+	}
+}
+
+func TestTokenFromExec(t *testing.T) {
+	mgr := NewTokenManager([]TokenSpec{
+		{
+			Name: "execToken",
+			Value: TokenSource{
+				Exec: &ExecTokenSource{
+					Command: []string{"sh", "-c", "echo dummytoken"},
+				},
+			},
+		},
+		{
+			Name: "failedExecToken",
+			Value: TokenSource{
+				Exec: &ExecTokenSource{
+					Command: []string{"sh", "-c", "echo error >&2; exit 1"},
+				},
+			},
+		},
+	}, NewTokenClient(nil, "default"))
+	ctx := WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelInfo))
+	token, err := mgr.TokenByName(ctx, "execToken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Value != "dummytoken" {
+		t.Fatalf("failed to get token by command. expected dummytoken but got %s", token.Value)
+	}
+	if _, err := mgr.TokenByName(ctx, "failedExecToken"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestTokenFromVault(t *testing.T) {
+	const vaultToken = "dev-root-token"
+
+	// stand-in of Vault server running in dev mode.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != vaultToken {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/kubetest":
+			fmt.Fprint(w, `{"data":{"data":{"token":"kv2token"},"metadata":{"version":1}}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/kv/kubetest":
+			fmt.Fprint(w, `{"data":{"token":"kv1token"}}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/transit/decrypt/kubetest":
+			var req struct {
+				Ciphertext string `json:"ciphertext"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Ciphertext != "vault:v1:encrypted" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"data":{"plaintext":%q}}`, base64.StdEncoding.EncodeToString([]byte("transittoken")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("VAULT_TOKEN", vaultToken)
+
+	mgr := NewTokenManager([]TokenSpec{
+		{
+			Name: "kv2",
+			Value: TokenSource{
+				Vault: &VaultTokenSource{
+					Address: srv.URL,
+					KV:      &VaultKVSource{Path: "kubetest", Key: "token"},
+				},
+			},
+		},
+		{
+			Name: "kv1",
+			Value: TokenSource{
+				Vault: &VaultTokenSource{
+					Address: srv.URL,
+					KV:      &VaultKVSource{Mount: "kv", Path: "kubetest", Key: "token", Version: 1},
+				},
+			},
+		},
+		{
+			Name: "transit",
+			Value: TokenSource{
+				Vault: &VaultTokenSource{
+					Address: srv.URL,
+					Transit: &VaultTransitSource{KeyName: "kubetest", Ciphertext: "vault:v1:encrypted"},
+				},
+			},
+		},
+		{
+			Name: "unknown",
+			Value: TokenSource{
+				Vault: &VaultTokenSource{
+					Address: srv.URL,
+					KV:      &VaultKVSource{Path: "unknown", Key: "token"},
+				},
+			},
+		},
+	}, NewTokenClient(nil, "default"))
+	ctx := WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelInfo))
+	for name, expected := range map[string]string{
+		"kv2":     "kv2token",
+		"kv1":     "kv1token",
+		"transit": "transittoken",
+	} {
+		token, err := mgr.TokenByName(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Value != expected {
+			t.Fatalf("failed to get token from vault. expected %s but got %s", expected, token.Value)
+		}
+	}
+	if _, err := mgr.TokenByName(ctx, "unknown"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// tokenTargetJobExecutor is the mount target of the token that reports its status and the result of the copy.
+type tokenTargetJobExecutor struct {
+	*localJobExecutor
+	running bool
+	copyErr error
+	copied  chan struct{}
+}
+
+func (e *tokenTargetJobExecutor) isRunning(_ context.Context) (bool, error) {
+	return e.running, nil
+}
+
+func (e *tokenTargetJobExecutor) CopyTo(ctx context.Context, src string, dst string) error {
+	defer func() { e.copied <- struct{}{} }()
+	if e.copyErr != nil {
+		return e.copyErr
+	}
+	return e.localJobExecutor.CopyTo(ctx, src, dst)
+}
+
+func TestTokenRefresher(t *testing.T) {
+	envName := "KUBETEST_TEST_REFRESH_TOKEN"
+	t.Setenv(envName, "oldtoken")
+	mgr := NewTokenManager([]TokenSpec{
+		{
+			Name: "envToken",
+			Value: TokenSource{
+				Env: &envName,
+			},
+		},
+	}, NewTokenClient(nil, "default"))
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, LogLevelInfo)
+	ctx := WithLogger(context.Background(), logger)
+	token, err := mgr.TokenByName(ctx, "envToken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.ExpiresAt = time.Now().Add(200 * time.Millisecond)
+
+	rootDir := t.TempDir()
+	mountPath := filepath.Join("/", "etc", "token")
+	if err := os.MkdirAll(filepath.Join(rootDir, filepath.Dir(mountPath)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootDir, mountPath), []byte(token.Value), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed := make(chan struct{}, 1)
+	var refreshCount int32
+	refresher := newTokenRefresher(logger, mgr)
+	refresher.retryInterval = 10 * time.Millisecond
+	refresher.refreshToken = func(ctx context.Context, token *Token) (*Token, error) {
+		if atomic.AddInt32(&refreshCount, 1) > 1 {
+			return nil, errors.New("re-minted token")
+		}
+		refreshedToken, err := mgr.RefreshToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		// the environment variable token doesn't expire, so set the expiration time to stop refreshing.
+		newToken := *refreshedToken
+		newToken.ExpiresAt = time.Now().Add(time.Hour)
+		refreshed <- struct{}{}
+		return &newToken, nil
+	}
+	refresher.addToken(token)
+	exitedTarget := &tokenTargetJobExecutor{
+		localJobExecutor: &localJobExecutor{rootDir: t.TempDir()},
+		running:          true,
+		copyErr:          errors.New("container not found"),
+		copied:           make(chan struct{}, 1),
+	}
+	terminatedTarget := &tokenTargetJobExecutor{
+		localJobExecutor: &localJobExecutor{rootDir: t.TempDir()},
+		copied:           make(chan struct{}, 1),
+	}
+	runningTarget := &tokenTargetJobExecutor{
+		localJobExecutor: &localJobExecutor{rootDir: rootDir},
+		running:          true,
+		copied:           make(chan struct{}, 1),
+	}
+	refresher.addMountTarget("envToken", exitedTarget, mountPath)
+	refresher.addMountTarget("envToken", terminatedTarget, mountPath)
+	refresher.addMountTarget("envToken", runningTarget, mountPath)
+	if !refresher.needsToRefresh() {
+		t.Fatal("failed to add token to refresh")
+	}
+
+	t.Setenv(envName, "newtoken")
+	refreshCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		refresher.run(refreshCtx)
+	}()
+	select {
+	case <-refreshed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("failed to refresh token")
+	}
+	select {
+	case <-runningTarget.copied:
+	case <-time.After(10 * time.Second):
+		t.Fatal("failed to rewrite token after the failure of the other target")
+	}
+	// the failure to rewrite the token must not re-mint it.
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+	if count := atomic.LoadInt32(&refreshCount); count != 1 {
+		t.Fatalf("unexpected refresh count: %d", count)
+	}
+	if len(exitedTarget.copied) != 1 {
+		t.Fatal("failed to try to rewrite token on the first target")
+	}
+	if len(terminatedTarget.copied) != 0 {
+		t.Fatal("rewrote token on the terminated container")
+	}
+	if targets := refresher.tokens[0].targets; len(targets) != 2 {
+		t.Fatalf("failed to remove the terminated target: %d", len(targets))
+	}
+	if !strings.Contains(buf.String(), "container not found") {
+		t.Fatalf("failed to report the failure to rewrite token: %s", buf.String())
+	}
+
+	cached, err := mgr.TokenByName(ctx, "envToken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Value != "newtoken" {
+		t.Fatalf("failed to refresh token value: %s", cached.Value)
+	}
+	local, err := os.ReadFile(token.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(local) != "newtoken" {
+		t.Fatalf("failed to rewrite local token file: %s", string(local))
+	}
+	mounted, err := os.ReadFile(filepath.Join(rootDir, mountPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(mounted) != "newtoken" {
+		t.Fatalf("failed to rewrite mounted token file: %s", string(mounted))
+	}
+	logger.Info("token is newtoken")
+	if strings.Contains(buf.String(), "newtoken") {
+		t.Fatalf("failed to mask refreshed token: %s", buf.String())
+	}
+}
+
+func TestTokenManagerCache(t *testing.T) {
+	mgr := NewTokenManager([]TokenSpec{
+		{
+			Name: "execToken",
+			Value: TokenSource{
+				Exec: &ExecTokenSource{
+					Command: []string{"sh", "-c", "date +%s%N"},
+				},
+			},
+		},
+	}, NewTokenClient(nil, "default"))
+	ctx := WithLogger(context.Background(), NewLogger(os.Stdout, LogLevelInfo))
+	token, err := mgr.TokenByName(ctx, "execToken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("reuse cached token", func(t *testing.T) {
+		cached, err := mgr.TokenByName(ctx, "execToken")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached != token {
+			t.Fatalf("failed to reuse token: %s and %s", token.Value, cached.Value)
+		}
+	})
+	t.Run("re-mint the token that expires soon", func(t *testing.T) {
+		expiring := *token
+		expiring.ExpiresAt = time.Now().Add(time.Minute)
+		mgr.tokens["execToken"] = &expiring
+
+		refreshed, err := mgr.TokenByName(ctx, "execToken")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refreshed.Value == token.Value {
+			t.Fatal("failed to re-mint token")
+		}
+		if refreshed.File != token.File {
+			t.Fatalf("failed to share token file: %s and %s", token.File, refreshed.File)
+		}
+		content, err := os.ReadFile(refreshed.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != refreshed.Value {
+			t.Fatalf("failed to rewrite token file: %s", string(content))
+		}
+		// the token has already been refreshed, so refreshing by the old token returns the cached token.
+		again, err := mgr.RefreshToken(ctx, &expiring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != refreshed {
+			t.Fatal("failed to deduplicate refresh")
+		}
+	})
+	t.Run("cleanup", func(t *testing.T) {
+		if err := mgr.Cleanup(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Dir(token.File)); !os.IsNotExist(err) {
+			t.Fatalf("failed to remove token directory: %v", err)
+		}
+	})
+}
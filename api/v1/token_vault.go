@@ -0,0 +1,191 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	defaultVaultKVMount      = "secret"
+	defaultVaultKVVersion    = 2
+	defaultVaultTransitMount = "transit"
+)
+
+// AccessToken reads the token from Vault by HTTP API.
+// see also: https://developer.hashicorp.com/vault/api-docs
+func (s *VaultTokenSource) AccessToken(ctx context.Context, cli *TokenClient) (string, error) {
+	if err := NewValidator().ValidateVaultTokenSource(s); err != nil {
+		return "", err
+	}
+	client, err := s.client(ctx, cli)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case s.KV != nil:
+		return client.readKV(ctx, s.KV)
+	case s.Transit != nil:
+		return client.decrypt(ctx, s.Transit)
+	}
+	return "", nil
+}
+
+func (s *VaultTokenSource) client(ctx context.Context, cli *TokenClient) (*vaultClient, error) {
+	address := s.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("kubetest: vault.address or $VAULT_ADDR must be specified")
+	}
+	var token string
+	if s.Token != nil {
+		data, err := cli.secretData(ctx, s.Token)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	} else {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("kubetest: vault.token or $VAULT_TOKEN must be specified")
+	}
+	// Vault token is also a secret.
+	addTokenMasks(ctx, token)
+	return &vaultClient{
+		address:   strings.TrimSuffix(address, "/"),
+		token:     token,
+		namespace: s.Namespace,
+	}, nil
+}
+
+type vaultClient struct {
+	address   string
+	token     string
+	namespace string
+}
+
+func (c *vaultClient) readKV(ctx context.Context, kv *VaultKVSource) (string, error) {
+	mount := kv.Mount
+	if mount == "" {
+		mount = defaultVaultKVMount
+	}
+	version := kv.Version
+	if version == 0 {
+		version = defaultVaultKVVersion
+	}
+	var apiPath string
+	if version == 1 {
+		apiPath = path.Join(mount, kv.Path)
+	} else {
+		apiPath = path.Join(mount, "data", kv.Path)
+	}
+	var res struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := c.request(ctx, http.MethodGet, apiPath, nil, &res); err != nil {
+		return "", err
+	}
+	data := res.Data
+	if version != 1 {
+		// KV version 2 wraps the secret data with metadata.
+		var v2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return "", fmt.Errorf("kubetest: failed to decode vault kv data: %w", err)
+		}
+		data = v2.Data
+	}
+	var secret map[string]interface{}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return "", fmt.Errorf("kubetest: failed to decode vault kv data: %w", err)
+	}
+	value, exists := secret[kv.Key]
+	if !exists {
+		return "", fmt.Errorf("kubetest: failed to find key %s in vault secret %s", kv.Key, kv.Path)
+	}
+	token, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("kubetest: vault secret value of %s must be string but got %T", kv.Key, value)
+	}
+	return strings.TrimSpace(token), nil
+}
+
+func (c *vaultClient) decrypt(ctx context.Context, transit *VaultTransitSource) (string, error) {
+	mount := transit.Mount
+	if mount == "" {
+		mount = defaultVaultTransitMount
+	}
+	var res struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := c.request(
+		ctx,
+		http.MethodPost,
+		path.Join(mount, "decrypt", transit.KeyName),
+		map[string]string{"ciphertext": transit.Ciphertext},
+		&res,
+	); err != nil {
+		return "", err
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(res.Data.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("kubetest: failed to decode plaintext decrypted by vault: %w", err)
+	}
+	return strings.TrimSpace(string(plaintext)), nil
+}
+
+func (c *vaultClient) request(ctx context.Context, method, apiPath string, body interface{}, res interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("kubetest: failed to encode vault request: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	reqURL := c.address + "/v1/" + (&url.URL{Path: apiPath}).EscapedPath()
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to request to vault %s: %w", apiPath, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kubetest: failed to request to vault %s: status %d: %s", apiPath, resp.StatusCode, string(b))
+	}
+	if err := json.Unmarshal(b, res); err != nil {
+		return fmt.Errorf("kubetest: failed to decode vault response: %w", err)
+	}
+	return nil
+}
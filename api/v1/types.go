@@ -2,6 +2,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -30,6 +31,64 @@ type TestJobSpec struct {
 	// Log extend parameter to output log.
 	// +optional
 	Log LogSpec `json:"log,omitempty"`
+	// PreInit extend parameter to copy the repositories, tokens, artifacts, log and report into each pod.
+	// +optional
+	PreInit PreInitSpec `json:"preInit,omitempty"`
+	// SharedStorage stages the repositories and the artifacts once on the volume shared by the pods,
+	// and the containers mount them as read-only instead of copying them into each pod.
+	// If it isn't specified, they are copied into each pod.
+	// +optional
+	SharedStorage *SharedStorageSpec `json:"sharedStorage,omitempty"`
+}
+
+// PreInitSpec describes how to copy the files into the pod before the containers start.
+type PreInitSpec struct {
+	// Parallelism the number of copies executed concurrently for each pod. default is 4.
+	// +optional
+	Parallelism int32 `json:"parallelism,omitempty"`
+	// Timeout timeout of each copy by the type of resource.
+	// +optional
+	Timeout PreInitTimeout `json:"timeout,omitempty"`
+	// Retry retry the failed copy.
+	// +optional
+	Retry PreInitRetry `json:"retry,omitempty"`
+}
+
+// PreInitTimeout timeout of the copy by the type of resource ( e.g. 30s, 10m ). default is 10m.
+type PreInitTimeout struct {
+	// +optional
+	Repo string `json:"repo,omitempty"`
+	// +optional
+	Token string `json:"token,omitempty"`
+	// +optional
+	Artifact string `json:"artifact,omitempty"`
+	// +optional
+	Log string `json:"log,omitempty"`
+	// +optional
+	Report string `json:"report,omitempty"`
+}
+
+// PreInitRetry describes the retry of the failed copy. The interval of retry is doubled for each retry.
+type PreInitRetry struct {
+	// Limit the maximum number of retries. default is 3. If 0 is specified, the failed copy isn't retried.
+	// +optional
+	Limit *int32 `json:"limit,omitempty"`
+	// Backoff the interval before the first retry ( e.g. 1s ). default is 1s.
+	// +optional
+	Backoff string `json:"backoff,omitempty"`
+}
+
+// SharedStorageSpec describes the volume to stage the repositories and the artifacts.
+// Either persistentVolumeClaim or hostPath must be specified.
+type SharedStorageSpec struct {
+	// PersistentVolumeClaim the claim of the volume whose access mode is ReadWriteMany.
+	// The repositories and the artifacts are staged once for all pods.
+	// +optional
+	PersistentVolumeClaim *corev1.PersistentVolumeClaimVolumeSource `json:"persistentVolumeClaim,omitempty"`
+	// HostPath the directory on the node used as node-local cache.
+	// The repositories and the artifacts are staged once for each node.
+	// +optional
+	HostPath *corev1.HostPathVolumeSource `json:"hostPath,omitempty"`
 }
 
 // RepositorySpec describes the specification of repository.
@@ -55,9 +114,38 @@ type Repository struct {
 	Merge *MergeSpec `json:"merge,omitempty"`
 	// ClonedPath specify the clone destination directory for repository.
 	// If the target repository has already been cloned and the directory is not empty,
-	// it will be reused ( doesn't clone ).
+	// it will be reused ( fetches the latest commits instead of cloning ).
 	ClonedPath string `json:"clonedPath,omitempty"`
-}
+	// Depth create a shallow clone with a history truncated to the specified number of commits.
+	Depth int `json:"depth,omitempty"`
+	// SingleBranch clone only the history leading to the tip of the specified branch ( or the default branch ).
+	SingleBranch bool `json:"singleBranch,omitempty"`
+	// SparseCheckout paths to checkout. If specified, only these paths are checked out and archived.
+	SparseCheckout []string `json:"sparseCheckout,omitempty"`
+	// Submodules specify how to fetch submodules (none/shallow/recursive). default is none.
+	Submodules SubmoduleMode `json:"submodules,omitempty"`
+	// LFS fetch Git LFS objects. git-lfs command is required.
+	LFS bool `json:"lfs,omitempty"`
+	// MergeRefs refs to fetch and merge in order after checkout ( and merging the base branch ). e.g.) refs/pull/123/head
+	MergeRefs []string `json:"mergeRefs,omitempty"`
+	// CherryPick commits to cherry-pick in order after merging refs.
+	CherryPick []string `json:"cherryPick,omitempty"`
+	// Patches paths to the patch files to apply in order after cherry-picking.
+	// Each patch is committed, so the resolved HEAD contains all changes.
+	Patches []string `json:"patches,omitempty"`
+}
+
+// SubmoduleMode specify how to fetch submodules.
+type SubmoduleMode string
+
+const (
+	// SubmoduleModeNone doesn't fetch submodules.
+	SubmoduleModeNone SubmoduleMode = "none"
+	// SubmoduleModeShallow fetches the submodules of the repository ( not nested ) with the history truncated to the recorded commit.
+	SubmoduleModeShallow SubmoduleMode = "shallow"
+	// SubmoduleModeRecursive fetches all submodules recursively.
+	SubmoduleModeRecursive SubmoduleMode = "recursive"
+)
 
 // MergeSpec describes the specification of merge behavior.
 type MergeSpec struct {
@@ -79,6 +167,15 @@ type TokenSource struct {
 	GitHubApp   *GitHubAppTokenSource `json:"githubApp,omitempty"`
 	GitHubToken *GitHubTokenSource    `json:"githubToken,omitempty"`
 	FilePath    *string               `json:"filePath,omitempty"`
+	SSHKey      *SSHKeyTokenSource    `json:"sshKey,omitempty"`
+	// Vault reads the token from HashiCorp Vault.
+	Vault *VaultTokenSource `json:"vault,omitempty"`
+	// Env name of the environment variable of kubetest process that has the token.
+	Env *string `json:"env,omitempty"`
+	// GitLab project access token or deploy token.
+	GitLab *GitLabTokenSource `json:"gitlab,omitempty"`
+	// Exec runs the command by kubetest process and uses the stdout as the token.
+	Exec *ExecTokenSource `json:"exec,omitempty"`
 }
 
 // GitHubAppTokenSource describes the specification of github app based token.
@@ -92,11 +189,82 @@ type GitHubAppTokenSource struct {
 // GitHubTokenSource describes the specification of github token.
 type GitHubTokenSource corev1.SecretKeySelector
 
+// SSHKeyTokenSource describes the specification of SSH private key to access the repository by SSH.
+// The token value is the private key.
+type SSHKeyTokenSource struct {
+	// PrivateKey secret key selector of the private key.
+	PrivateKey *corev1.SecretKeySelector `json:"privateKey"`
+	// Passphrase secret key selector of the passphrase for the private key.
+	Passphrase *corev1.SecretKeySelector `json:"passphrase,omitempty"`
+	// KnownHosts secret key selector of known_hosts to verify the host key.
+	// If not specified, the known_hosts of the environment running kubetest is used ( $SSH_KNOWN_HOSTS or ~/.ssh/known_hosts ).
+	KnownHosts *corev1.SecretKeySelector `json:"knownHosts,omitempty"`
+	// InsecureIgnoreHostKey skip host key verification. This is insecure and should be used for testing only.
+	InsecureIgnoreHostKey bool `json:"insecureIgnoreHostKey,omitempty"`
+}
+
+// VaultTokenSource describes the specification of the token stored in HashiCorp Vault.
+// Either KV or Transit must be specified.
+type VaultTokenSource struct {
+	// Address of Vault server like https://vault.example.com:8200 . If empty, $VAULT_ADDR is used.
+	Address string `json:"address,omitempty"`
+	// Token secret key selector of the Vault token to authenticate. If not specified, $VAULT_TOKEN is used.
+	Token *corev1.SecretKeySelector `json:"token,omitempty"`
+	// Namespace of Vault Enterprise.
+	Namespace string `json:"namespace,omitempty"`
+	// KV reads the token from the KV secrets engine.
+	KV *VaultKVSource `json:"kv,omitempty"`
+	// Transit decrypts the token by the transit secrets engine.
+	Transit *VaultTransitSource `json:"transit,omitempty"`
+}
+
+// VaultKVSource describes the secret of the KV secrets engine.
+type VaultKVSource struct {
+	// Mount path of the KV secrets engine. default is "secret".
+	Mount string `json:"mount,omitempty"`
+	// Path to the secret.
+	Path string `json:"path"`
+	// Key of the secret data.
+	Key string `json:"key"`
+	// Version of the KV secrets engine (1 or 2). default is 2.
+	Version int `json:"version,omitempty"`
+}
+
+// VaultTransitSource describes the ciphertext decrypted by the transit secrets engine.
+type VaultTransitSource struct {
+	// Mount path of the transit secrets engine. default is "transit".
+	Mount string `json:"mount,omitempty"`
+	// KeyName name of the encryption key.
+	KeyName string `json:"keyName"`
+	// Ciphertext the encrypted token like vault:v1:... .
+	Ciphertext string `json:"ciphertext"`
+}
+
+// GitLabTokenSource describes the specification of GitLab project access token or deploy token.
+type GitLabTokenSource struct {
+	// Token secret key selector of the token.
+	Token *corev1.SecretKeySelector `json:"token"`
+	// Username to authenticate by the token. The deploy token requires its username.
+	// If empty, "oauth2" is used ( it is available for project access token ).
+	Username string `json:"username,omitempty"`
+}
+
+// ExecTokenSource describes the command to get the token.
+type ExecTokenSource struct {
+	// Command to run. The stdout of the command is used as the token.
+	Command []string `json:"command"`
+	// TimeoutSeconds timeout of the command. default is 60 seconds.
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+}
+
 // PreStep defines pre-processing to prepare files for testing that are not included in the repository.
 type PreStep struct {
 	Name                    string              `json:"name"`
 	TTLSecondsAfterFinished *int32              `json:"ttlSecondsAfterFinished,omitempty"`
 	Template                TestJobTemplateSpec `json:"template"`
+	// RetryPolicy the policy to retry the failed task.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
 }
 
 func (s *PreStep) GetName() string {
@@ -115,6 +283,10 @@ func (s *PreStep) GetTemplate() TestJobTemplateSpec {
 	return s.Template
 }
 
+func (s *PreStep) GetRetryPolicy() *RetryPolicy {
+	return s.RetryPolicy
+}
+
 // MainStep defines main process
 type MainStep struct {
 	// Strategy strategy for distributed task
@@ -122,6 +294,9 @@ type MainStep struct {
 	Strategy                *Strategy           `json:"strategy,omitempty"`
 	TTLSecondsAfterFinished *int32              `json:"ttlSecondsAfterFinished,omitempty"`
 	Template                TestJobTemplateSpec `json:"template"`
+	// RetryPolicy the policy to retry the failed task.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
 }
 
 func (s *MainStep) GetName() string {
@@ -140,11 +315,18 @@ func (s *MainStep) GetTemplate() TestJobTemplateSpec {
 	return s.Template
 }
 
+func (s *MainStep) GetRetryPolicy() *RetryPolicy {
+	return s.RetryPolicy
+}
+
 // PostStep defines post-processing to export artifacts.
 type PostStep struct {
 	Name                    string              `json:"name"`
 	TTLSecondsAfterFinished *int32              `json:"ttlSecondsAfterFinished,omitempty"`
 	Template                TestJobTemplateSpec `json:"template"`
+	// RetryPolicy the policy to retry the failed task.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
 }
 
 func (s *PostStep) GetName() string {
@@ -163,6 +345,44 @@ func (s *PostStep) GetTemplate() TestJobTemplateSpec {
 	return s.Template
 }
 
+func (s *PostStep) GetRetryPolicy() *RetryPolicy {
+	return s.RetryPolicy
+}
+
+// RetryPolicy describes the retry of the failed task. The task is recreated as the new job for each attempt.
+type RetryPolicy struct {
+	// MaxAttempts the maximum number of attempts including the first one. default is 3.
+	// +optional
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+	// Backoff the interval before the first retry ( e.g. 1s ). The interval is doubled for each retry. default is 1s.
+	// +optional
+	Backoff string `json:"backoff,omitempty"`
+	// MaxBackoff the upper limit of the interval ( e.g. 1m ). default is 1m.
+	// +optional
+	MaxBackoff string `json:"maxBackoff,omitempty"`
+	// RetryOn the classes of the error to retry. default is preInit, pendingTimeout and unexpected.
+	// +optional
+	RetryOn []RetryErrorClass `json:"retryOn,omitempty"`
+}
+
+// RetryErrorClass the class of the error that fails the task.
+type RetryErrorClass string
+
+const (
+	// RetryErrorClassPreInit the failure of copying the files into the pod.
+	RetryErrorClassPreInit RetryErrorClass = "preInit"
+	// RetryErrorClassPendingTimeout the pod is still pending after the timeout.
+	RetryErrorClassPendingTimeout RetryErrorClass = "pendingTimeout"
+	// RetryErrorClassUnexpected the pod failed unexpectedly before running the tests.
+	RetryErrorClassUnexpected RetryErrorClass = "unexpected"
+	// RetryErrorClassEviction the pod was evicted or preempted ( e.g. spot node was reclaimed ).
+	RetryErrorClassEviction RetryErrorClass = "eviction"
+	// RetryErrorClassNodeLost the node running the pod was lost.
+	RetryErrorClassNodeLost RetryErrorClass = "nodeLost"
+	// RetryErrorClassImagePull the image of the container couldn't be pulled.
+	RetryErrorClassImagePull RetryErrorClass = "imagePull"
+)
+
 // TestJobTemplateSpec
 type TestJobTemplateSpec struct {
 	// ObjectMeta standard object's metadata.
@@ -213,14 +433,75 @@ type ArtifactSpec struct {
 	Name string `json:"name"`
 	// Container
 	Container ArtifactContainer `json:"container"`
-}
+	// Type of the artifact. If log is specified, secrets in the artifact are masked.
+	Type ArtifactType `json:"type,omitempty"`
+	// Merge strategy to merge the artifacts created by multiple containers ( e.g. the containers of each strategy key ) into one artifact.
+	// If not specified, the artifact referenced by the subsequent steps has the intermediate directory for each container.
+	Merge ArtifactMergeType `json:"merge,omitempty"`
+	// Policy when the artifact is collected. The default is always.
+	// If the artifact is written on the volume ( e.g. emptyDir ), the artifact is collected through the helper container
+	// that mounts the same volume even if the main container was killed ( e.g. OOMKilled ).
+	Policy ArtifactPolicy `json:"policy,omitempty"`
+	// MaxSize is the maximum total size of the files transferred from the container for the artifact.
+	// If the artifact exceeds it, the transfer is stopped and the error is reported.
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// Compression compresses the artifact on the container while transferring it. gzip is supported.
+	Compression ArtifactCompressionType `json:"compression,omitempty"`
+}
+
+type ArtifactType string
+
+const (
+	ArtifactTypeLog ArtifactType = "log"
+)
+
+type ArtifactPolicy string
+
+const (
+	// ArtifactPolicyAlways collects the artifact regardless of the result.
+	ArtifactPolicyAlways ArtifactPolicy = "always"
+	// ArtifactPolicyOnSuccess collects the artifact only if the test succeeded.
+	ArtifactPolicyOnSuccess ArtifactPolicy = "onSuccess"
+	// ArtifactPolicyOnFailure collects the artifact only if the test failed.
+	ArtifactPolicyOnFailure ArtifactPolicy = "onFailure"
+)
+
+type ArtifactCompressionType string
+
+const (
+	ArtifactCompressionTypeGzip ArtifactCompressionType = "gzip"
+)
+
+type ArtifactMergeType string
+
+const (
+	// ArtifactMergeTypeConcat concatenates the files in order of the container name.
+	ArtifactMergeTypeConcat ArtifactMergeType = "concat"
+	// ArtifactMergeTypeGoCoverage merges Go coverage profiles created by `go test -coverprofile`.
+	ArtifactMergeTypeGoCoverage ArtifactMergeType = "gocover"
+	// ArtifactMergeTypeJUnit merges JUnit XML files into one testsuites element.
+	ArtifactMergeTypeJUnit ArtifactMergeType = "junit"
+	// ArtifactMergeTypeUnion unions the directory trees. If the same file has different contents, the file of the first container is used.
+	ArtifactMergeTypeUnion ArtifactMergeType = "union"
+)
 
 // ArtifactContainer
 type ArtifactContainer struct {
 	// Name for the container
 	Name string `json:"name"`
 	// Path to the artifact.
-	Path string `json:"path"`
+	// The path can be the glob pattern like `coverage/*.out` or `**/junit-*.xml` ( `**` matches any directories ).
+	Path string `json:"path,omitempty"`
+	// Paths to the artifacts. Each path can be the glob pattern.
+	// If multiple paths or glob patterns are specified, the artifact is the directory that preserves the directory structure
+	// under the common base directory of the paths.
+	Paths []string `json:"paths,omitempty"`
+	// Include collects only the files that match any of the patterns.
+	// The pattern without '/' matches the name of the file or the parent directories,
+	// otherwise the pattern matches the path relative to the common base directory.
+	Include []string `json:"include,omitempty"`
+	// Exclude doesn't collect the files that match any of the patterns. The pattern is the same format as Include.
+	Exclude []string `json:"exclude,omitempty"`
 }
 
 // TestJobVolume describes volume for TestJob.
@@ -263,13 +544,18 @@ type TokenVolumeSource struct {
 }
 
 // LogVolumeSource
-type LogVolumeSource struct{}
+type LogVolumeSource struct {
+	// PerKey mounts the directory that has the log file of each strategy key instead of kubetest.log.
+	// Each file is named after the strategy key ( characters that cannot be used for file name are replaced with '_' ).
+	PerKey bool `json:"perKey,omitempty"`
+}
 
 // ReportFormatType format type of report
 type ReportFormatType string
 
 const (
 	ReportFormatTypeJSON ReportFormatType = "json"
+	ReportFormatTypeHTML ReportFormatType = "html"
 )
 
 // ResultStatus execution result of task
@@ -291,12 +577,61 @@ type Report struct {
 	UnknownNum     int               `json:"unknownNum,omitempty"`
 	Details        []*ReportDetail   `json:"details"`
 	ExtParam       map[string]string `json:"ext,omitempty"`
+	Repos          []*ReportRepo     `json:"repos,omitempty"`
+	// RunID is the identifier of the run. It's the UID of TestJob if exists, otherwise generated by kubetest.
+	RunID string `json:"runId,omitempty"`
+	// Artifacts is the result of exporting artifacts.
+	Artifacts []*ReportArtifact `json:"artifacts,omitempty"`
+	// Attempts is the history of the attempts of the tasks that have been retried.
+	Attempts []*ReportAttempt `json:"attempts,omitempty"`
+}
+
+// ReportAttempt is the result of an attempt to run the task.
+type ReportAttempt struct {
+	Step StepType `json:"step"`
+	// Task is the name of the step. It's empty for the main step.
+	Task string `json:"task,omitempty"`
+	// Keys the strategy keys run by the task.
+	Keys []string `json:"keys,omitempty"`
+	// Attempt the number of the attempt starting from 1.
+	Attempt        int         `json:"attempt"`
+	StartedAt      metav1.Time `json:"startedAt"`
+	ElapsedTimeSec int64       `json:"elapsedTimeSec"`
+	// Error is the error of the attempt. It's empty if the attempt finished without the retryable error.
+	Error string `json:"error,omitempty"`
+	// ErrorClass is the class of the error.
+	ErrorClass RetryErrorClass `json:"errorClass,omitempty"`
+}
+
+// ReportArtifact is the result of exporting the artifact.
+type ReportArtifact struct {
+	Name string `json:"name"`
+	// URLs of the objects uploaded to the object storage.
+	URLs []string `json:"urls,omitempty"`
+}
+
+// ReportRepo is the result of checkout of the repository.
+type ReportRepo struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+	// Ref is the requested branch or revision.
+	Ref string `json:"ref,omitempty"`
+	// ResolvedSHA is the commit hash of HEAD after merging and applying patches.
+	ResolvedSHA string `json:"resolvedSHA"`
+	// MergeBaseSHA is the commit hash of the merged base branch.
+	MergeBaseSHA string `json:"mergeBaseSHA,omitempty"`
+	// CloneElapsedTimeSec is the time to clone the repository and create the archive.
+	CloneElapsedTimeSec float64 `json:"cloneElapsedTimeSec"`
 }
 
 type ReportDetail struct {
 	Status         ResultStatus `json:"status"`
 	Name           string       `json:"name"`
+	StartedAt      metav1.Time  `json:"startedAt,omitempty"`
 	ElapsedTimeSec int64        `json:"elapsedTimeSec"`
+	Pod            string       `json:"pod,omitempty"`
+	// ArtifactError is the error of collecting the artifacts. It doesn't affect the status.
+	ArtifactError string `json:"artifactError,omitempty"`
 }
 
 // ReportVolumeSource
@@ -307,9 +642,45 @@ type ReportVolumeSource struct {
 // ExportArtifact
 type ExportArtifact struct {
 	// This must match the Name of a ArtifactSpec.
+	// If kubetest-log is specified, exports the log directory that contains kubetest.log and the log file of each strategy key.
 	Name string `json:"name"`
 	// Path path to the artifact.
-	Path string `json:"path"`
+	Path string `json:"path,omitempty"`
+	// S3 uploads the artifact to S3 compatible object storage.
+	S3 *S3ExportDestination `json:"s3,omitempty"`
+}
+
+// S3ExportDestination describes S3 compatible object storage to upload the artifact.
+type S3ExportDestination struct {
+	// Endpoint URL of S3 compatible API like `http://minio.default.svc:9000` .
+	// If empty, `https://s3.<region>.amazonaws.com` is used.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region of the bucket. If empty, us-east-1 is used.
+	Region string `json:"region,omitempty"`
+	// Bucket name.
+	Bucket string `json:"bucket"`
+	// Prefix of the object key. The prefix is the template of text/template package,
+	// and {{ .Name }} ( TestJob name ), {{ .RunID }}, {{ .Key }} ( strategy key or container name ),
+	// {{ .Artifact }} and {{ .Container }} can be used.
+	// If empty, `{{ .Name }}/{{ .RunID }}/{{ .Artifact }}/{{ .Key }}` is used.
+	Prefix string `json:"prefix,omitempty"`
+	// PathStyle uses the path style URL ( `<endpoint>/<bucket>/<key>` ) instead of the virtual hosted style URL.
+	// Most S3 compatible storages like MinIO require this.
+	PathStyle bool `json:"pathStyle,omitempty"`
+	// Credentials to access the storage.
+	// If not specified, $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN are used.
+	Credentials *S3Credentials `json:"credentials,omitempty"`
+}
+
+// S3Credentials describes the credentials to access S3 compatible object storage.
+// Either Token or AccessKeyID and SecretAccessKey must be specified.
+type S3Credentials struct {
+	// Token name of TokenSpec. The token value must be `<access key id>:<secret access key>` .
+	Token string `json:"token,omitempty"`
+	// AccessKeyID secret key selector of the access key id.
+	AccessKeyID *corev1.SecretKeySelector `json:"accessKeyId,omitempty"`
+	// SecretAccessKey secret key selector of the secret access key.
+	SecretAccessKey *corev1.SecretKeySelector `json:"secretAccessKey,omitempty"`
 }
 
 // LogLevel
@@ -327,6 +698,8 @@ func (l LogLevel) String() string {
 	switch l {
 	case LogLevelNone:
 		return "none"
+	case LogLevelError:
+		return "error"
 	case LogLevelWarn:
 		return "warn"
 	case LogLevelInfo:
@@ -337,10 +710,28 @@ func (l LogLevel) String() string {
 	return ""
 }
 
+// LogFormatType format type of log
+type LogFormatType string
+
+const (
+	LogFormatTypeText LogFormatType = "text"
+	LogFormatTypeJSON LogFormatType = "json"
+)
+
 // LogSpec
 type LogSpec struct {
 	// Level set the logger's log level (debug/info/warn/error).
 	Level LogLevel `json:"level"`
+	// Format set the logger's output format (text/json). default is text.
+	// If json is specified, each record is written as a single JSON line with step, task, strategy key, container and pod.
+	Format LogFormatType `json:"format,omitempty"`
+	// Stream output each line of the subtask as soon as it arrives ( prefixed by strategy key ).
+	// The output of each subtask is still grouped in the log file.
+	Stream bool `json:"stream,omitempty"`
+	// MaskPatterns regular expressions to mask the matched text in log, report and artifacts of type log.
+	// If the pattern has a capturing group, only the first group is masked.
+	// Private key blocks, credentials in URL and well-known tokens are always masked.
+	MaskPatterns []string `json:"maskPatterns,omitempty"`
 	// ExtParam add arbitrary key/value to report log.
 	ExtParam map[string]string `json:"extParam"`
 }
@@ -353,6 +744,53 @@ type Strategy struct {
 	Scheduler Scheduler `json:"scheduler"`
 	// Restart testing for failed tests
 	Retest bool `json:"retest,omitempty"`
+	// Placement places the pods of the strategy on the nodes.
+	// +optional
+	Placement *Placement `json:"placement,omitempty"`
+}
+
+// Placement describes how the pods of the strategy are placed on the nodes.
+type Placement struct {
+	// Spread spreads the pods of the run across the nodes.
+	// The pods are selected by the run label of TestJob ( kubetest.io/run ).
+	// +optional
+	Spread *PlacementSpread `json:"spread,omitempty"`
+	// NodeSelectors pins the keys to the nodes. The first selector whose pattern matches the key is used.
+	// The pinned keys are scheduled on the pods separated from the other keys.
+	// +optional
+	NodeSelectors []KeyNodeSelector `json:"nodeSelectors,omitempty"`
+}
+
+// PlacementSpreadType type of spreading the pods.
+type PlacementSpreadType string
+
+const (
+	PlacementSpreadTypeTopologySpread PlacementSpreadType = "topologySpread"
+	PlacementSpreadTypeAntiAffinity   PlacementSpreadType = "antiAffinity"
+)
+
+// PlacementSpread spreads the pods of the run across the topologies of the nodes.
+type PlacementSpread struct {
+	// Type topologySpread or antiAffinity. default is topologySpread.
+	Type PlacementSpreadType `json:"type,omitempty"`
+	// TopologyKey the label of the node to spread the pods across. default is kubernetes.io/hostname.
+	TopologyKey string `json:"topologyKey,omitempty"`
+	// MaxSkew the maximum difference of the number of the pods between the topologies. default is 1.
+	// It's used by topologySpread only.
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+	// Required if true, the pod isn't scheduled until it can be spread. Otherwise, spreading is preferred.
+	Required bool `json:"required,omitempty"`
+}
+
+// KeyNodeSelector pins the keys matched by the pattern to the nodes.
+type KeyNodeSelector struct {
+	// Pattern regular expression to match the strategy keys.
+	Pattern string `json:"pattern"`
+	// NodeSelector the labels of the nodes to run the matched keys.
+	NodeSelector map[string]string `json:"nodeSelector"`
+	// Tolerations for the taints of the nodes ( e.g. dedicated node pool ).
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
 }
 
 // StrategyKeySpec
@@ -392,6 +830,28 @@ type Scheduler struct {
 	MaxContainersPerPod int `json:"maxContainersPerPod"`
 	// MaxConcurrentNumPerPod maximum number of concurrent per pod.
 	MaxConcurrentNumPerPod int `json:"maxConcurrentNumPerPod"`
+	// Resources the resources of the main containers sized by the number of the containers per pod.
+	// +optional
+	Resources *SchedulerResources `json:"resources,omitempty"`
+}
+
+// SchedulerResources describes the resources of the pod to run the keys.
+// podBudget and perKey cannot both be set.
+type SchedulerResources struct {
+	// PodBudget the total resources of the main containers in the pod.
+	// The requests and limits are divided equally among the main containers.
+	// +optional
+	PodBudget *corev1.ResourceRequirements `json:"podBudget,omitempty"`
+	// PerKey the resources to run a key.
+	// The pod requests them for maxConcurrentNumPerPod keys because only those keys run at the same time,
+	// and the requests are divided equally among the main containers. The limits are applied to each main container.
+	// +optional
+	PerKey *corev1.ResourceRequirements `json:"perKey,omitempty"`
+	// NodeSize the allocatable resources of the node to run the pod ( e.g. cpu: 8, memory: 32Gi ).
+	// If specified, the number of the containers per pod is picked to fit the node,
+	// and the pods that cannot be scheduled are reported before they are created.
+	// +optional
+	NodeSize corev1.ResourceList `json:"nodeSize,omitempty"`
 }
 
 // TestJobStatus defines the observed state of TestJob
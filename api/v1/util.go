@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 func existsDir(path string) bool {
@@ -18,6 +19,14 @@ func existsDir(path string) bool {
 	return info.IsDir()
 }
 
+func existsFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
 func getMainContainerFromTmpl(tmpl TestJobTemplateSpec) (TestJobContainer, error) {
 	if tmpl.Main != "" {
 		for _, container := range tmpl.Spec.Containers {
@@ -112,3 +121,25 @@ func copyDir(src, dst string, mode os.FileMode) error {
 	}
 	return nil
 }
+
+// formatBytes formats the size in binary units ( e.g. 1.5 MiB ).
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// formatRate formats the transfer rate per second.
+func formatRate(size int64, elapsedTime time.Duration) string {
+	if elapsedTime <= 0 {
+		return "-"
+	}
+	return formatBytes(int64(float64(size)/elapsedTime.Seconds())) + "/s"
+}
@@ -5,23 +5,42 @@ package v1
 
 import (
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
 	"time"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
 type Validator struct {
 	tokenNameMap    map[string]struct{}
 	repoNameMap     map[string]struct{}
 	artifactNameMap map[string]struct{}
+	// sshKeyTokenNameMap names of the tokens based on SSH key. They can be used to access the repository only.
+	sshKeyTokenNameMap map[string]struct{}
+	// localTokenProviders whether the tokens can be read from the environment of kubetest process ( env, exec and $VAULT_TOKEN ).
+	localTokenProviders bool
 }
 
 func NewValidator() *Validator {
 	return &Validator{
-		tokenNameMap:    map[string]struct{}{},
-		repoNameMap:     map[string]struct{}{},
-		artifactNameMap: map[string]struct{}{},
+		tokenNameMap:       map[string]struct{}{},
+		repoNameMap:        map[string]struct{}{},
+		artifactNameMap:    map[string]struct{}{},
+		sshKeyTokenNameMap: map[string]struct{}{},
 	}
 }
 
+// EnableLocalTokenProviders allows the tokens read from the environment of kubetest process.
+// It must not be enabled if TestJob is created by the other users ( e.g. the controller ),
+// because they can run any command or read any environment variable of the process through the token.
+func (v *Validator) EnableLocalTokenProviders() {
+	v.localTokenProviders = true
+}
+
 func (v *Validator) ValidateTestJob(job TestJob) error {
 	if err := v.ValidateTestJobSpec(job.Spec); err != nil {
 		return err
@@ -41,6 +60,9 @@ func (v *Validator) ValidateTestJobSpec(spec TestJobSpec) error {
 			return fmt.Errorf("kubetest: specified token name '%s' is duplicated", token.Name)
 		}
 		v.tokenNameMap[token.Name] = struct{}{}
+		if token.Value.SSHKey != nil {
+			v.sshKeyTokenNameMap[token.Name] = struct{}{}
+		}
 	}
 	for _, repo := range spec.Repos {
 		if err := v.ValidateRepositorySpec(repo); err != nil {
@@ -69,6 +91,14 @@ func (v *Validator) ValidateTestJobSpec(spec TestJobSpec) error {
 			return err
 		}
 	}
+	if err := v.ValidatePreInit(spec.PreInit); err != nil {
+		return err
+	}
+	if spec.SharedStorage != nil {
+		if err := v.ValidateSharedStorage(spec.SharedStorage); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -80,6 +110,16 @@ func (v *Validator) ValidateLog(spec LogSpec) error {
 			return fmt.Errorf("kubetest: unknown log level %d", spec.Level)
 		}
 	}
+	switch spec.Format {
+	case "", LogFormatTypeText, LogFormatTypeJSON:
+	default:
+		return fmt.Errorf("kubetest: unknown log format %s", spec.Format)
+	}
+	for _, pattern := range spec.MaskPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("kubetest: invalid mask pattern %s: %w", pattern, err)
+		}
+	}
 	return nil
 }
 
@@ -88,20 +128,26 @@ func (v *Validator) ValidateToken(token TokenSpec) error {
 		return fmt.Errorf("kubetest: token name must be specified")
 	}
 	var foundSource int
-	if token.Value.GitHubApp != nil {
-		foundSource++
-	}
-	if token.Value.GitHubToken != nil {
-		foundSource++
-	}
-	if token.Value.FilePath != nil {
-		foundSource++
+	for _, found := range []bool{
+		token.Value.GitHubApp != nil,
+		token.Value.GitHubToken != nil,
+		token.Value.FilePath != nil,
+		token.Value.SSHKey != nil,
+		token.Value.Vault != nil,
+		token.Value.Env != nil,
+		token.Value.GitLab != nil,
+		token.Value.Exec != nil,
+	} {
+		if found {
+			foundSource++
+		}
 	}
+	const sourceNames = "githubApp or githubToken or filePath or sshKey or vault or env or gitlab or exec"
 	if foundSource == 0 {
-		return fmt.Errorf("kubetest: githubApp or githubToken or filePath must be specified")
+		return fmt.Errorf("kubetest: %s must be specified", sourceNames)
 	}
 	if foundSource > 1 {
-		return fmt.Errorf("kubetest: only one of githubApp or githubToken or filePath needs to be specified")
+		return fmt.Errorf("kubetest: only one of %s needs to be specified", sourceNames)
 	}
 	switch {
 	case token.Value.GitHubApp != nil:
@@ -110,6 +156,25 @@ func (v *Validator) ValidateToken(token TokenSpec) error {
 		return v.ValidateGitHubTokenSource(token.Value.GitHubToken)
 	case token.Value.FilePath != nil:
 		return v.ValidateFilePathTokenSource(token.Value.FilePath)
+	case token.Value.SSHKey != nil:
+		return v.ValidateSSHKeyTokenSource(token.Value.SSHKey)
+	case token.Value.Vault != nil:
+		if token.Value.Vault.Token == nil && !v.localTokenProviders {
+			return fmt.Errorf("kubetest: vault.token of %s must be specified. $VAULT_TOKEN is used by kubetest command only", token.Name)
+		}
+		return v.ValidateVaultTokenSource(token.Value.Vault)
+	case token.Value.Env != nil:
+		if !v.localTokenProviders {
+			return fmt.Errorf("kubetest: env token source %s is disabled. it's enabled by kubetest command only", token.Name)
+		}
+		return v.ValidateEnvTokenSource(token.Value.Env)
+	case token.Value.GitLab != nil:
+		return v.ValidateGitLabTokenSource(token.Value.GitLab)
+	case token.Value.Exec != nil:
+		if !v.localTokenProviders {
+			return fmt.Errorf("kubetest: exec token source %s is disabled. it's enabled by kubetest command only", token.Name)
+		}
+		return v.ValidateExecTokenSource(token.Value.Exec)
 	}
 	return nil
 }
@@ -137,6 +202,95 @@ func (v *Validator) ValidateGitHubTokenSource(source *GitHubTokenSource) error {
 	return nil
 }
 
+func (v *Validator) ValidateSSHKeyTokenSource(source *SSHKeyTokenSource) error {
+	if source.PrivateKey == nil {
+		return fmt.Errorf("kubetest: sshKey.privateKey must be specified")
+	}
+	for _, field := range []struct {
+		name     string
+		selector *corev1.SecretKeySelector
+	}{
+		{name: "privateKey", selector: source.PrivateKey},
+		{name: "passphrase", selector: source.Passphrase},
+		{name: "knownHosts", selector: source.KnownHosts},
+	} {
+		if field.selector == nil {
+			continue
+		}
+		if field.selector.Name == "" {
+			return fmt.Errorf("kubetest: sshKey.%s.name must be specified", field.name)
+		}
+		if field.selector.Key == "" {
+			return fmt.Errorf("kubetest: sshKey.%s.key must be specified", field.name)
+		}
+	}
+	if source.KnownHosts != nil && source.InsecureIgnoreHostKey {
+		return fmt.Errorf("kubetest: only one of sshKey.knownHosts or sshKey.insecureIgnoreHostKey needs to be specified")
+	}
+	return nil
+}
+
+func (v *Validator) ValidateVaultTokenSource(source *VaultTokenSource) error {
+	if source.Token != nil && (source.Token.Name == "" || source.Token.Key == "") {
+		return fmt.Errorf("kubetest: vault.token.name and vault.token.key must be specified")
+	}
+	if (source.KV == nil) == (source.Transit == nil) {
+		return fmt.Errorf("kubetest: only one of vault.kv or vault.transit needs to be specified")
+	}
+	if kv := source.KV; kv != nil {
+		if kv.Path == "" {
+			return fmt.Errorf("kubetest: vault.kv.path must be specified")
+		}
+		if kv.Key == "" {
+			return fmt.Errorf("kubetest: vault.kv.key must be specified")
+		}
+		switch kv.Version {
+		case 0, 1, 2:
+		default:
+			return fmt.Errorf("kubetest: vault.kv.version must be 1 or 2")
+		}
+	}
+	if transit := source.Transit; transit != nil {
+		if transit.KeyName == "" {
+			return fmt.Errorf("kubetest: vault.transit.keyName must be specified")
+		}
+		if transit.Ciphertext == "" {
+			return fmt.Errorf("kubetest: vault.transit.ciphertext must be specified")
+		}
+	}
+	return nil
+}
+
+func (v *Validator) ValidateEnvTokenSource(source *string) error {
+	if source == nil || *source == "" {
+		return fmt.Errorf("kubetest: env must be not empty string")
+	}
+	return nil
+}
+
+func (v *Validator) ValidateGitLabTokenSource(source *GitLabTokenSource) error {
+	if source.Token == nil {
+		return fmt.Errorf("kubetest: gitlab.token must be specified")
+	}
+	if source.Token.Name == "" {
+		return fmt.Errorf("kubetest: gitlab.token.name must be specified")
+	}
+	if source.Token.Key == "" {
+		return fmt.Errorf("kubetest: gitlab.token.key must be specified")
+	}
+	return nil
+}
+
+func (v *Validator) ValidateExecTokenSource(source *ExecTokenSource) error {
+	if len(source.Command) == 0 || source.Command[0] == "" {
+		return fmt.Errorf("kubetest: exec.command must be specified")
+	}
+	if source.TimeoutSeconds < 0 {
+		return fmt.Errorf("kubetest: exec.timeoutSeconds must be positive number")
+	}
+	return nil
+}
+
 func (v *Validator) ValidateFilePathTokenSource(source *string) error {
 	if source == nil || *source == "" {
 		return fmt.Errorf("kubetest: filePath must be not empty string")
@@ -155,6 +309,43 @@ func (v *Validator) ValidateRepositorySpec(spec RepositorySpec) error {
 }
 
 func (v *Validator) ValidateRepository(repo Repository) error {
+	if repo.Depth < 0 {
+		return fmt.Errorf("kubetest: repository depth must be positive number")
+	}
+	if repo.Depth > 0 && repo.Merge != nil {
+		return fmt.Errorf("kubetest: repository depth cannot be used with merge. merge requires the history to find the merge base")
+	}
+	if repo.Depth > 0 && repo.Rev != "" {
+		return fmt.Errorf("kubetest: repository depth cannot be used with rev. the shallow clone cannot checkout the commit that isn't the branch tip")
+	}
+	if repo.Depth > 0 && (len(repo.MergeRefs) != 0 || len(repo.CherryPick) != 0) {
+		return fmt.Errorf("kubetest: repository depth cannot be used with mergeRefs or cherryPick. they require the history of the commits")
+	}
+	for _, ref := range repo.MergeRefs {
+		if ref == "" {
+			return fmt.Errorf("kubetest: repository merge ref must be specified")
+		}
+	}
+	for _, commit := range repo.CherryPick {
+		if commit == "" {
+			return fmt.Errorf("kubetest: repository cherry-pick commit must be specified")
+		}
+	}
+	for _, patch := range repo.Patches {
+		if patch == "" {
+			return fmt.Errorf("kubetest: repository patch file path must be specified")
+		}
+	}
+	for _, path := range repo.SparseCheckout {
+		if err := v.validateSparseCheckoutPath(path); err != nil {
+			return err
+		}
+	}
+	switch repo.Submodules {
+	case "", SubmoduleModeNone, SubmoduleModeShallow, SubmoduleModeRecursive:
+	default:
+		return fmt.Errorf("kubetest: unknown repository submodules mode %s", repo.Submodules)
+	}
 	if repo.ClonedPath != "" {
 		return nil
 	}
@@ -172,6 +363,21 @@ func (v *Validator) ValidateRepository(repo Repository) error {
 	return nil
 }
 
+func (v *Validator) validateSparseCheckoutPath(path string) error {
+	if path == "" {
+		return fmt.Errorf("kubetest: repository sparse checkout path must be specified")
+	}
+	if filepath.IsAbs(path) {
+		return fmt.Errorf("kubetest: repository sparse checkout path must be relative path: %s", path)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if elem == ".." {
+			return fmt.Errorf("kubetest: repository sparse checkout path must not contain '..': %s", path)
+		}
+	}
+	return nil
+}
+
 func (v *Validator) ValidatePreStep(prestep PreStep) error {
 	if prestep.Name == "" {
 		return fmt.Errorf("kubetest: prestep name must be specified")
@@ -179,6 +385,9 @@ func (v *Validator) ValidatePreStep(prestep PreStep) error {
 	if err := v.ValidateTestJobTemplateSpec(prestep.Template, PreStepType); err != nil {
 		return err
 	}
+	if err := v.ValidateRetryPolicy(prestep.RetryPolicy); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -189,6 +398,9 @@ func (v *Validator) ValidateMainStep(step MainStep) error {
 	if err := v.ValidateTestJobTemplateSpec(step.Template, MainStepType); err != nil {
 		return err
 	}
+	if err := v.ValidateRetryPolicy(step.RetryPolicy); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -199,6 +411,9 @@ func (v *Validator) ValidatePostStep(poststep PostStep) error {
 	if err := v.ValidateTestJobTemplateSpec(poststep.Template, PostStepType); err != nil {
 		return err
 	}
+	if err := v.ValidateRetryPolicy(poststep.RetryPolicy); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -287,9 +502,35 @@ func (v *Validator) ValidateArtifactSpec(spec ArtifactSpec) error {
 	if spec.Name == "" {
 		return fmt.Errorf("kubetest: template.spec.artifact.name must be specified")
 	}
+	if spec.Name == LogArtifactName {
+		return fmt.Errorf("kubetest: template.spec.artifact.name %s is reserved", LogArtifactName)
+	}
 	if err := v.ValidateArtifactContainer(spec.Container); err != nil {
 		return err
 	}
+	switch spec.Type {
+	case "", ArtifactTypeLog:
+	default:
+		return fmt.Errorf("kubetest: unknown artifact type %s", spec.Type)
+	}
+	switch spec.Merge {
+	case "", ArtifactMergeTypeConcat, ArtifactMergeTypeGoCoverage, ArtifactMergeTypeJUnit, ArtifactMergeTypeUnion:
+	default:
+		return fmt.Errorf("kubetest: unknown artifact merge type %s", spec.Merge)
+	}
+	switch spec.Policy {
+	case "", ArtifactPolicyAlways, ArtifactPolicyOnSuccess, ArtifactPolicyOnFailure:
+	default:
+		return fmt.Errorf("kubetest: unknown artifact policy %s", spec.Policy)
+	}
+	if spec.MaxSize != nil && spec.MaxSize.Sign() <= 0 {
+		return fmt.Errorf("kubetest: artifact maxSize must be greater than zero")
+	}
+	switch spec.Compression {
+	case "", ArtifactCompressionTypeGzip:
+	default:
+		return fmt.Errorf("kubetest: unknown artifact compression type %s", spec.Compression)
+	}
 	return nil
 }
 
@@ -297,8 +538,24 @@ func (v *Validator) ValidateArtifactContainer(container ArtifactContainer) error
 	if container.Name == "" {
 		return fmt.Errorf("kubetest: template.spec.artifact.container.name must be specified")
 	}
-	if container.Path == "" {
-		return fmt.Errorf("kubetest: template.spec.artifact.container.path must be specified")
+	if container.Path == "" && len(container.Paths) == 0 {
+		return fmt.Errorf("kubetest: template.spec.artifact.container.path or paths must be specified")
+	}
+	for _, p := range container.artifactPaths() {
+		if p == "" {
+			return fmt.Errorf("kubetest: template.spec.artifact.container.paths must not contain empty path")
+		}
+		if err := validateArtifactPattern(p); err != nil {
+			return fmt.Errorf("kubetest: invalid template.spec.artifact.container path %q: %w", p, err)
+		}
+	}
+	for _, pattern := range append(append([]string{}, container.Include...), container.Exclude...) {
+		if pattern == "" {
+			return fmt.Errorf("kubetest: template.spec.artifact.container include and exclude must not contain empty pattern")
+		}
+		if err := validateArtifactPattern(pattern); err != nil {
+			return fmt.Errorf("kubetest: invalid template.spec.artifact.container filter pattern %q: %w", pattern, err)
+		}
 	}
 	return nil
 }
@@ -356,6 +613,9 @@ func (v *Validator) ValidateTokenVolumeSource(source *TokenVolumeSource) error {
 	if _, exists := v.tokenNameMap[source.Name]; !exists {
 		return fmt.Errorf("kubetest: token volume source name %s is undefined", source.Name)
 	}
+	if _, exists := v.sshKeyTokenNameMap[source.Name]; exists {
+		return fmt.Errorf("kubetest: token volume source %s is ssh key. ssh key cannot be mounted as token", source.Name)
+	}
 	return nil
 }
 
@@ -371,7 +631,7 @@ func (v *Validator) ValidateReportVolumeSource(report *ReportVolumeSource, stepT
 		return fmt.Errorf("kubetest: report volume source must be specified postSteps only")
 	}
 	switch report.Format {
-	case ReportFormatTypeJSON:
+	case ReportFormatTypeJSON, ReportFormatTypeHTML:
 		return nil
 	default:
 		return fmt.Errorf("kubetest: unknown report format %s", report.Format)
@@ -388,6 +648,37 @@ func (v *Validator) ValidateStrategy(strategy *Strategy) error {
 	if err := v.ValidateScheduler(strategy.Scheduler); err != nil {
 		return err
 	}
+	if err := v.ValidatePlacement(strategy.Placement); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *Validator) ValidatePlacement(placement *Placement) error {
+	if placement == nil {
+		return nil
+	}
+	if spread := placement.Spread; spread != nil {
+		switch spread.Type {
+		case "", PlacementSpreadTypeTopologySpread, PlacementSpreadTypeAntiAffinity:
+		default:
+			return fmt.Errorf("kubetest: unknown strategy.placement.spread.type %s", spread.Type)
+		}
+		if spread.MaxSkew < 0 {
+			return fmt.Errorf("kubetest: strategy.placement.spread.maxSkew must be a number greater than zero")
+		}
+	}
+	for _, selector := range placement.NodeSelectors {
+		if selector.Pattern == "" {
+			return fmt.Errorf("kubetest: strategy.placement.nodeSelectors.pattern must be specified")
+		}
+		if _, err := regexp.Compile(selector.Pattern); err != nil {
+			return fmt.Errorf("kubetest: invalid strategy.placement.nodeSelectors.pattern %q: %w", selector.Pattern, err)
+		}
+		if len(selector.NodeSelector) == 0 {
+			return fmt.Errorf("kubetest: strategy.placement.nodeSelectors.nodeSelector must be specified")
+		}
+	}
 	return nil
 }
 
@@ -422,7 +713,8 @@ func (v *Validator) ValidateStrategyDynamicKeySource(source *StrategyDynamicKeyS
 }
 
 func (v *Validator) ValidateScheduler(scheduler Scheduler) error {
-	if scheduler.MaxPodNum == 0 && scheduler.MaxContainersPerPod == 0 {
+	hasNodeSize := scheduler.Resources != nil && len(scheduler.Resources.NodeSize) != 0
+	if scheduler.MaxPodNum == 0 && scheduler.MaxContainersPerPod == 0 && !hasNodeSize {
 		return fmt.Errorf("kubetest: strategy.scheduler's maxPodNum or maxContainersPerPod must be specified")
 	}
 	if scheduler.MaxPodNum != 0 && scheduler.MaxContainersPerPod != 0 {
@@ -434,12 +726,34 @@ func (v *Validator) ValidateScheduler(scheduler Scheduler) error {
 	if scheduler.MaxContainersPerPod < 0 {
 		return fmt.Errorf("kubetest: strategy.scheduler.maxContainersPerPod must be a number greater than zero")
 	}
+	if hasNodeSize && scheduler.Resources.PodBudget != nil && scheduler.MaxPodNum == 0 && scheduler.MaxContainersPerPod == 0 {
+		// the requests of the pod by podBudget don't depend on the number of the containers, so it cannot be picked by the node size.
+		return fmt.Errorf("kubetest: strategy.scheduler.maxContainersPerPod must be specified to use podBudget with nodeSize")
+	}
 	if scheduler.MaxConcurrentNumPerPod == 0 {
 		return fmt.Errorf("kubetest: strategy.scheduler.maxConcurrentNumPerPod must be specified")
 	}
 	if scheduler.MaxConcurrentNumPerPod < 0 {
 		return fmt.Errorf("kubetest: strategy.scheduler.ConcurrentNumPerPod must be a number greater than zero")
 	}
+	if err := v.ValidateSchedulerResources(scheduler.Resources); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *Validator) ValidateSchedulerResources(resources *SchedulerResources) error {
+	if resources == nil {
+		return nil
+	}
+	if resources.PodBudget != nil && resources.PerKey != nil {
+		return fmt.Errorf("kubetest: strategy.scheduler.resources's podBudget and perKey cannot both be set")
+	}
+	for name, quantity := range resources.NodeSize {
+		if quantity.Sign() <= 0 {
+			return fmt.Errorf("kubetest: strategy.scheduler.resources.nodeSize.%s must be positive quantity but got %s", name, quantity.String())
+		}
+	}
 	return nil
 }
 
@@ -447,11 +761,146 @@ func (v *Validator) ValidateExportArtifact(artifact ExportArtifact) error {
 	if artifact.Name == "" {
 		return fmt.Errorf("kubetest: exportArtifact.name must be specified")
 	}
-	if _, exists := v.artifactNameMap[artifact.Name]; !exists {
+	if _, exists := v.artifactNameMap[artifact.Name]; !exists && artifact.Name != LogArtifactName {
 		return fmt.Errorf("kubetest: export artifact name %s is undefined", artifact.Name)
 	}
-	if artifact.Path == "" {
-		return fmt.Errorf("kubetest: exportArtifact.path must be specified")
+	if artifact.Path == "" && artifact.S3 == nil {
+		return fmt.Errorf("kubetest: exportArtifact.path or exportArtifact.s3 must be specified")
+	}
+	if artifact.S3 != nil {
+		if err := v.ValidateS3ExportDestination(artifact.S3); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Validator) ValidateS3ExportDestination(dest *S3ExportDestination) error {
+	if dest.Bucket == "" {
+		return fmt.Errorf("kubetest: exportArtifact.s3.bucket must be specified")
+	}
+	if dest.Endpoint != "" {
+		u, err := url.Parse(dest.Endpoint)
+		if err != nil {
+			return fmt.Errorf("kubetest: invalid exportArtifact.s3.endpoint %s: %w", dest.Endpoint, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("kubetest: exportArtifact.s3.endpoint must be http or https url but got %s", dest.Endpoint)
+		}
+	}
+	if _, err := template.New("").Parse(dest.Prefix); err != nil {
+		return fmt.Errorf("kubetest: invalid exportArtifact.s3.prefix template %s: %w", dest.Prefix, err)
+	}
+	if creds := dest.Credentials; creds != nil {
+		switch {
+		case creds.Token != "":
+			if creds.AccessKeyID != nil || creds.SecretAccessKey != nil {
+				return fmt.Errorf("kubetest: exportArtifact.s3.credentials.token cannot be used with accessKeyId and secretAccessKey")
+			}
+			if _, exists := v.tokenNameMap[creds.Token]; !exists {
+				return fmt.Errorf("kubetest: exportArtifact.s3.credentials token name %s is undefined", creds.Token)
+			}
+			if _, exists := v.sshKeyTokenNameMap[creds.Token]; exists {
+				return fmt.Errorf("kubetest: exportArtifact.s3.credentials token %s is ssh key", creds.Token)
+			}
+		case creds.AccessKeyID == nil || creds.SecretAccessKey == nil:
+			return fmt.Errorf("kubetest: exportArtifact.s3.credentials requires token or both of accessKeyId and secretAccessKey")
+		}
+	}
+	return nil
+}
+
+func (v *Validator) ValidatePreInit(spec PreInitSpec) error {
+	if spec.Parallelism < 0 {
+		return fmt.Errorf("kubetest: preInit.parallelism must not be negative number but got %d", spec.Parallelism)
+	}
+	for name, timeout := range map[string]string{
+		"repo":     spec.Timeout.Repo,
+		"token":    spec.Timeout.Token,
+		"artifact": spec.Timeout.Artifact,
+		"log":      spec.Timeout.Log,
+		"report":   spec.Timeout.Report,
+	} {
+		if timeout == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("kubetest: invalid preInit.timeout.%s %s: %w", name, timeout, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("kubetest: preInit.timeout.%s must be positive duration but got %s", name, timeout)
+		}
+	}
+	if spec.Retry.Limit != nil && *spec.Retry.Limit < 0 {
+		return fmt.Errorf("kubetest: preInit.retry.limit must not be negative number but got %d", *spec.Retry.Limit)
+	}
+	if spec.Retry.Backoff != "" {
+		backoff, err := time.ParseDuration(spec.Retry.Backoff)
+		if err != nil {
+			return fmt.Errorf("kubetest: invalid preInit.retry.backoff %s: %w", spec.Retry.Backoff, err)
+		}
+		if backoff < 0 {
+			return fmt.Errorf("kubetest: preInit.retry.backoff must not be negative duration but got %s", spec.Retry.Backoff)
+		}
+	}
+	return nil
+}
+
+func (v *Validator) ValidateRetryPolicy(policy *RetryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxAttempts < 0 {
+		return fmt.Errorf("kubetest: retryPolicy.maxAttempts must not be negative number but got %d", policy.MaxAttempts)
+	}
+	for name, duration := range map[string]string{
+		"backoff":    policy.Backoff,
+		"maxBackoff": policy.MaxBackoff,
+	} {
+		if duration == "" {
+			continue
+		}
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return fmt.Errorf("kubetest: invalid retryPolicy.%s %s: %w", name, duration, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("kubetest: retryPolicy.%s must not be negative duration but got %s", name, duration)
+		}
+	}
+	for _, class := range policy.RetryOn {
+		switch class {
+		case RetryErrorClassPreInit,
+			RetryErrorClassPendingTimeout,
+			RetryErrorClassUnexpected,
+			RetryErrorClassEviction,
+			RetryErrorClassNodeLost,
+			RetryErrorClassImagePull:
+		default:
+			return fmt.Errorf("kubetest: unknown retryPolicy.retryOn class %s", class)
+		}
+	}
+	return nil
+}
+
+func (v *Validator) ValidateSharedStorage(spec *SharedStorageSpec) error {
+	switch {
+	case spec.PersistentVolumeClaim != nil && spec.HostPath != nil:
+		return fmt.Errorf("kubetest: sharedStorage.persistentVolumeClaim and sharedStorage.hostPath cannot be specified at the same time")
+	case spec.PersistentVolumeClaim != nil:
+		if spec.PersistentVolumeClaim.ClaimName == "" {
+			return fmt.Errorf("kubetest: sharedStorage.persistentVolumeClaim.claimName must be specified")
+		}
+		if spec.PersistentVolumeClaim.ReadOnly {
+			return fmt.Errorf("kubetest: sharedStorage.persistentVolumeClaim must be writable to stage files")
+		}
+	case spec.HostPath != nil:
+		if !filepath.IsAbs(spec.HostPath.Path) {
+			return fmt.Errorf("kubetest: sharedStorage.hostPath.path must be absolute path but got %q", spec.HostPath.Path)
+		}
+	default:
+		return fmt.Errorf("kubetest: sharedStorage.persistentVolumeClaim or sharedStorage.hostPath must be specified")
 	}
 	return nil
 }
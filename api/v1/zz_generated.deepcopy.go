@@ -12,6 +12,21 @@ import (
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ArtifactContainer) DeepCopyInto(out *ArtifactContainer) {
 	*out = *in
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArtifactContainer.
@@ -27,7 +42,12 @@ func (in *ArtifactContainer) DeepCopy() *ArtifactContainer {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ArtifactSpec) DeepCopyInto(out *ArtifactSpec) {
 	*out = *in
-	out.Container = in.Container
+	in.Container.DeepCopyInto(&out.Container)
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArtifactSpec.
@@ -55,9 +75,34 @@ func (in *ArtifactVolumeSource) DeepCopy() *ArtifactVolumeSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecTokenSource) DeepCopyInto(out *ExecTokenSource) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecTokenSource.
+func (in *ExecTokenSource) DeepCopy() *ExecTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExportArtifact) DeepCopyInto(out *ExportArtifact) {
 	*out = *in
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(S3ExportDestination)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExportArtifact.
@@ -111,9 +156,63 @@ func (in *GitHubTokenSource) DeepCopy() *GitHubTokenSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitLabTokenSource) DeepCopyInto(out *GitLabTokenSource) {
+	*out = *in
+	if in.Token != nil {
+		in, out := &in.Token, &out.Token
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitLabTokenSource.
+func (in *GitLabTokenSource) DeepCopy() *GitLabTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(GitLabTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeyNodeSelector) DeepCopyInto(out *KeyNodeSelector) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeyNodeSelector.
+func (in *KeyNodeSelector) DeepCopy() *KeyNodeSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(KeyNodeSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LogSpec) DeepCopyInto(out *LogSpec) {
 	*out = *in
+	if in.MaskPatterns != nil {
+		in, out := &in.MaskPatterns, &out.MaskPatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.ExtParam != nil {
 		in, out := &in.ExtParam, &out.ExtParam
 		*out = make(map[string]string, len(*in))
@@ -157,6 +256,11 @@ func (in *MainStep) DeepCopyInto(out *MainStep) {
 		(*in).DeepCopyInto(*out)
 	}
 	in.Template.DeepCopyInto(&out.Template)
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MainStep.
@@ -184,10 +288,57 @@ func (in *MergeSpec) DeepCopy() *MergeSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Placement) DeepCopyInto(out *Placement) {
+	*out = *in
+	if in.Spread != nil {
+		in, out := &in.Spread, &out.Spread
+		*out = new(PlacementSpread)
+		**out = **in
+	}
+	if in.NodeSelectors != nil {
+		in, out := &in.NodeSelectors, &out.NodeSelectors
+		*out = make([]KeyNodeSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Placement.
+func (in *Placement) DeepCopy() *Placement {
+	if in == nil {
+		return nil
+	}
+	out := new(Placement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlacementSpread) DeepCopyInto(out *PlacementSpread) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlacementSpread.
+func (in *PlacementSpread) DeepCopy() *PlacementSpread {
+	if in == nil {
+		return nil
+	}
+	out := new(PlacementSpread)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PostStep) DeepCopyInto(out *PostStep) {
 	*out = *in
 	in.Template.DeepCopyInto(&out.Template)
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostStep.
@@ -204,6 +355,11 @@ func (in *PostStep) DeepCopy() *PostStep {
 func (in *PreStep) DeepCopyInto(out *PreStep) {
 	*out = *in
 	in.Template.DeepCopyInto(&out.Template)
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreStep.
@@ -227,7 +383,7 @@ func (in *Report) DeepCopyInto(out *Report) {
 			if (*in)[i] != nil {
 				in, out := &(*in)[i], &(*out)[i]
 				*out = new(ReportDetail)
-				**out = **in
+				(*in).DeepCopyInto(*out)
 			}
 		}
 	}
@@ -238,6 +394,80 @@ func (in *Report) DeepCopyInto(out *Report) {
 			(*out)[key] = val
 		}
 	}
+	if in.Repos != nil {
+		in, out := &in.Repos, &out.Repos
+		*out = make([]*ReportRepo, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(ReportRepo)
+				**out = **in
+			}
+		}
+	}
+	if in.Artifacts != nil {
+		in, out := &in.Artifacts, &out.Artifacts
+		*out = make([]*ReportArtifact, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(ReportArtifact)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.Attempts != nil {
+		in, out := &in.Attempts, &out.Attempts
+		*out = make([]*ReportAttempt, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(ReportAttempt)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReportArtifact) DeepCopyInto(out *ReportArtifact) {
+	*out = *in
+	if in.URLs != nil {
+		in, out := &in.URLs, &out.URLs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReportArtifact.
+func (in *ReportArtifact) DeepCopy() *ReportArtifact {
+	if in == nil {
+		return nil
+	}
+	out := new(ReportArtifact)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReportAttempt) DeepCopyInto(out *ReportAttempt) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReportAttempt.
+func (in *ReportAttempt) DeepCopy() *ReportAttempt {
+	if in == nil {
+		return nil
+	}
+	out := new(ReportAttempt)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Report.
@@ -253,6 +483,7 @@ func (in *Report) DeepCopy() *Report {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReportDetail) DeepCopyInto(out *ReportDetail) {
 	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReportDetail.
@@ -265,6 +496,21 @@ func (in *ReportDetail) DeepCopy() *ReportDetail {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReportRepo) DeepCopyInto(out *ReportRepo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReportRepo.
+func (in *ReportRepo) DeepCopy() *ReportRepo {
+	if in == nil {
+		return nil
+	}
+	out := new(ReportRepo)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReportVolumeSource) DeepCopyInto(out *ReportVolumeSource) {
 	*out = *in
@@ -288,6 +534,26 @@ func (in *Repository) DeepCopyInto(out *Repository) {
 		*out = new(MergeSpec)
 		**out = **in
 	}
+	if in.SparseCheckout != nil {
+		in, out := &in.SparseCheckout, &out.SparseCheckout
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MergeRefs != nil {
+		in, out := &in.MergeRefs, &out.MergeRefs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CherryPick != nil {
+		in, out := &in.CherryPick, &out.CherryPick
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Patches != nil {
+		in, out := &in.Patches, &out.Patches
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Repository.
@@ -331,9 +597,186 @@ func (in *RepositoryVolumeSource) DeepCopy() *RepositoryVolumeSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3Credentials) DeepCopyInto(out *S3Credentials) {
+	*out = *in
+	if in.AccessKeyID != nil {
+		in, out := &in.AccessKeyID, &out.AccessKeyID
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretAccessKey != nil {
+		in, out := &in.SecretAccessKey, &out.SecretAccessKey
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3Credentials.
+func (in *S3Credentials) DeepCopy() *S3Credentials {
+	if in == nil {
+		return nil
+	}
+	out := new(S3Credentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreInitRetry) DeepCopyInto(out *PreInitRetry) {
+	*out = *in
+	if in.Limit != nil {
+		in, out := &in.Limit, &out.Limit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreInitRetry.
+func (in *PreInitRetry) DeepCopy() *PreInitRetry {
+	if in == nil {
+		return nil
+	}
+	out := new(PreInitRetry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreInitSpec) DeepCopyInto(out *PreInitSpec) {
+	*out = *in
+	out.Timeout = in.Timeout
+	in.Retry.DeepCopyInto(&out.Retry)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreInitSpec.
+func (in *PreInitSpec) DeepCopy() *PreInitSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PreInitSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreInitTimeout) DeepCopyInto(out *PreInitTimeout) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreInitTimeout.
+func (in *PreInitTimeout) DeepCopy() *PreInitTimeout {
+	if in == nil {
+		return nil
+	}
+	out := new(PreInitTimeout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3ExportDestination) DeepCopyInto(out *S3ExportDestination) {
+	*out = *in
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(S3Credentials)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3ExportDestination.
+func (in *S3ExportDestination) DeepCopy() *S3ExportDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(S3ExportDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.RetryOn != nil {
+		in, out := &in.RetryOn, &out.RetryOn
+		*out = make([]RetryErrorClass, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SharedStorageSpec) DeepCopyInto(out *SharedStorageSpec) {
+	*out = *in
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(corev1.PersistentVolumeClaimVolumeSource)
+		**out = **in
+	}
+	if in.HostPath != nil {
+		in, out := &in.HostPath, &out.HostPath
+		*out = new(corev1.HostPathVolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SharedStorageSpec.
+func (in *SharedStorageSpec) DeepCopy() *SharedStorageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SharedStorageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHKeyTokenSource) DeepCopyInto(out *SSHKeyTokenSource) {
+	*out = *in
+	if in.PrivateKey != nil {
+		in, out := &in.PrivateKey, &out.PrivateKey
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Passphrase != nil {
+		in, out := &in.Passphrase, &out.Passphrase
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KnownHosts != nil {
+		in, out := &in.KnownHosts, &out.KnownHosts
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHKeyTokenSource.
+func (in *SSHKeyTokenSource) DeepCopy() *SSHKeyTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHKeyTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Scheduler) DeepCopyInto(out *Scheduler) {
 	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(SchedulerResources)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Scheduler.
@@ -346,11 +789,48 @@ func (in *Scheduler) DeepCopy() *Scheduler {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchedulerResources) DeepCopyInto(out *SchedulerResources) {
+	*out = *in
+	if in.PodBudget != nil {
+		in, out := &in.PodBudget, &out.PodBudget
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PerKey != nil {
+		in, out := &in.PerKey, &out.PerKey
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSize != nil {
+		in, out := &in.NodeSize, &out.NodeSize
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchedulerResources.
+func (in *SchedulerResources) DeepCopy() *SchedulerResources {
+	if in == nil {
+		return nil
+	}
+	out := new(SchedulerResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Strategy) DeepCopyInto(out *Strategy) {
 	*out = *in
 	in.Key.DeepCopyInto(&out.Key)
-	out.Scheduler = in.Scheduler
+	in.Scheduler.DeepCopyInto(&out.Scheduler)
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(Placement)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Strategy.
@@ -553,7 +1033,9 @@ func (in *TestJobPodSpec) DeepCopyInto(out *TestJobPodSpec) {
 	if in.Artifacts != nil {
 		in, out := &in.Artifacts, &out.Artifacts
 		*out = make([]ArtifactSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -602,9 +1084,17 @@ func (in *TestJobSpec) DeepCopyInto(out *TestJobSpec) {
 	if in.ExportArtifacts != nil {
 		in, out := &in.ExportArtifacts, &out.ExportArtifacts
 		*out = make([]ExportArtifact, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	in.Log.DeepCopyInto(&out.Log)
+	in.PreInit.DeepCopyInto(&out.PreInit)
+	if in.SharedStorage != nil {
+		in, out := &in.SharedStorage, &out.SharedStorage
+		*out = new(SharedStorageSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TestJobSpec.
@@ -724,6 +1214,31 @@ func (in *TokenSource) DeepCopyInto(out *TokenSource) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.SSHKey != nil {
+		in, out := &in.SSHKey, &out.SSHKey
+		*out = new(SSHKeyTokenSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultTokenSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = new(string)
+		**out = **in
+	}
+	if in.GitLab != nil {
+		in, out := &in.GitLab, &out.GitLab
+		*out = new(GitLabTokenSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = new(ExecTokenSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenSource.
@@ -766,3 +1281,63 @@ func (in *TokenVolumeSource) DeepCopy() *TokenVolumeSource {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultKVSource) DeepCopyInto(out *VaultKVSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultKVSource.
+func (in *VaultKVSource) DeepCopy() *VaultKVSource {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultKVSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultTokenSource) DeepCopyInto(out *VaultTokenSource) {
+	*out = *in
+	if in.Token != nil {
+		in, out := &in.Token, &out.Token
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KV != nil {
+		in, out := &in.KV, &out.KV
+		*out = new(VaultKVSource)
+		**out = **in
+	}
+	if in.Transit != nil {
+		in, out := &in.Transit, &out.Transit
+		*out = new(VaultTransitSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultTokenSource.
+func (in *VaultTokenSource) DeepCopy() *VaultTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultTransitSource) DeepCopyInto(out *VaultTransitSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultTransitSource.
+func (in *VaultTransitSource) DeepCopy() *VaultTransitSource {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultTransitSource)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -21,14 +21,18 @@ import (
 )
 
 type option struct {
-	Namespace string            `description:"specify namespace" short:"n" long:"namespace" default:"default"`
-	InCluster bool              `description:"specify whether in cluster" long:"in-cluster"`
-	Config    string            `description:"specify local kubeconfig path. ( default: $HOME/.kube/config )" short:"c" long:"config"`
-	List      string            `description:"specify path to get the list for test" long:"list"`
-	LogLevel  string            `description:"specify log level (debug/info/warn/error)" long:"log-level"`
-	DryRun    bool              `description:"specify dry run mode" long:"dry-run"`
-	Template  map[string]string `description:"specify template parameter for testjob file" long:"template"`
-	Output    string            `description:"specify output path of report" short:"o" long:"output"`
+	Namespace    string            `description:"specify namespace" short:"n" long:"namespace" default:"default"`
+	InCluster    bool              `description:"specify whether in cluster" long:"in-cluster"`
+	Config       string            `description:"specify local kubeconfig path. ( default: $HOME/.kube/config )" short:"c" long:"config"`
+	List         string            `description:"specify path to get the list for test" long:"list"`
+	LogLevel     string            `description:"specify log level (debug/info/warn/error)" long:"log-level"`
+	LogFormat    string            `description:"specify log format (text/json)" long:"log-format"`
+	LogStream    bool              `description:"specify whether to output each line of tasks as soon as it arrives" long:"log-stream"`
+	DryRun       bool              `description:"specify dry run mode" long:"dry-run"`
+	Template     map[string]string `description:"specify template parameter for testjob file" long:"template"`
+	Output       string            `description:"specify output path of report" short:"o" long:"output"`
+	OutputFormat string            `description:"specify format of report written to output path (json/html)" long:"output-format" default:"json" choice:"json" choice:"html"`
+	RepoCacheDir string            `description:"specify directory to cache repositories across runs" long:"repo-cache-dir"`
 }
 
 const (
@@ -112,16 +116,30 @@ func _main(args []string, opt option) (*kubetestv1.Report, error) {
 	if opt.DryRun {
 		runMode = kubetestv1.RunModeDryRun
 	}
+	if opt.LogFormat != "" {
+		job.Spec.Log.Format = kubetestv1.LogFormatType(opt.LogFormat)
+	}
+	if opt.LogStream {
+		job.Spec.Log.Stream = true
+	}
+	logSpec := job.Spec.Log
 	runner := kubetestv1.NewRunner(cfg, runMode)
+	runner.SetRepositoryCacheDir(opt.RepoCacheDir)
+	// TestJob is written by the user who runs the command, so the tokens can be read from the environment of the command.
+	runner.EnableLocalTokenProviders()
 	switch opt.LogLevel {
 	case "debug":
-		runner.SetLogger(kubetestv1.NewLogger(os.Stdout, kubetestv1.LogLevelDebug))
+		logSpec.Level = kubetestv1.LogLevelDebug
+		runner.SetLogger(kubetestv1.NewLoggerWithSpec(os.Stdout, logSpec))
 	case "", "info":
-		runner.SetLogger(kubetestv1.NewLogger(os.Stdout, kubetestv1.LogLevelInfo))
+		logSpec.Level = kubetestv1.LogLevelInfo
+		runner.SetLogger(kubetestv1.NewLoggerWithSpec(os.Stdout, logSpec))
 	case "warn":
-		runner.SetLogger(kubetestv1.NewLogger(os.Stdout, kubetestv1.LogLevelWarn))
+		logSpec.Level = kubetestv1.LogLevelWarn
+		runner.SetLogger(kubetestv1.NewLoggerWithSpec(os.Stdout, logSpec))
 	case "error":
-		runner.SetLogger(kubetestv1.NewLogger(os.Stdout, kubetestv1.LogLevelError))
+		logSpec.Level = kubetestv1.LogLevelError
+		runner.SetLogger(kubetestv1.NewLoggerWithSpec(os.Stdout, logSpec))
 	default:
 	}
 	ctx, cancel := context.WithCancel(context.Background())
@@ -146,9 +164,23 @@ func _main(args []string, opt option) (*kubetestv1.Report, error) {
 		}
 		return nil, err
 	}
+	if opt.Output != "" {
+		if err := writeOutput(runner, report, opt); err != nil {
+			return nil, err
+		}
+	}
 	return report, nil
 }
 
+func writeOutput(runner *kubetestv1.Runner, report *kubetestv1.Report, opt option) error {
+	f, err := os.Create(opt.Output)
+	if err != nil {
+		return fmt.Errorf("kubetest: failed to create %s: %w", opt.Output, err)
+	}
+	defer f.Close()
+	return runner.WriteReport(f, report, kubetestv1.ReportFormatType(opt.OutputFormat))
+}
+
 func parseOpt() ([]string, option, error) {
 	var opt option
 	parser := flags.NewParser(&opt, flags.Default)
@@ -184,15 +216,6 @@ func main() {
 		fatalError(err)
 	}
 	fmt.Fprintln(os.Stdout, string(b))
-	if opt.Output != "" {
-		b, err := json.Marshal(report)
-		if err != nil {
-			fatalError(err)
-		}
-		if err := os.WriteFile(opt.Output, b, 0644); err != nil {
-			fatalError(err)
-		}
-	}
 	if report.Status != kubetestv1.ResultStatusSuccess {
 		os.Exit(ExitWithFailureTestJob)
 	}
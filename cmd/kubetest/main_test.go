@@ -84,3 +84,31 @@ func TestListOpt(t *testing.T) {
 		}
 	})
 }
+
+func TestOutputFormatOpt(t *testing.T) {
+	t.Run("valid format", func(t *testing.T) {
+		os.Args = []string{
+			"kubetest",
+			"--output-format",
+			"html",
+		}
+		_, opt, err := parseOpt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opt.OutputFormat != "html" {
+			t.Fatalf("unexpected output format %s", opt.OutputFormat)
+		}
+	})
+	t.Run("invalid format", func(t *testing.T) {
+		// the format must be rejected before the run starts.
+		os.Args = []string{
+			"kubetest",
+			"--output-format",
+			"htm",
+		}
+		if _, _, err := parseOpt(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}